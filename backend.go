@@ -0,0 +1,86 @@
+package dquely
+
+import (
+	"context"
+
+	"github.com/dgraph-io/dgo/v250"
+	"github.com/dgraph-io/dgo/v250/protos/api"
+)
+
+// Client is the set of operations services need from a Dgraph client. *Dgo
+// implements it; depend on Client to swap in a client backed by a fake (see the
+// dquelytest package) in unit tests.
+type Client interface {
+	SetSchema(ctx context.Context, schema string) error
+	Schema(ctx context.Context) (*Schema, error)
+	SchemaOf(models ...any) (*Schema, error)
+	Mutate(ctx context.Context, data any, deep ...bool) error
+	MutateMany(ctx context.Context, items any, opts ...BatchOptions) error
+	NewBulkWriter(ctx context.Context, opts BulkOptions) *BulkWriter
+	Update(ctx context.Context, data any, fields ...string) error
+	Upsert(ctx context.Context, model any, policy ConflictPolicy) (created bool, err error)
+	Query(ctx context.Context, query string, opts TxnOptions) (*api.Response, error)
+	NewTxn() *Txn
+	DoTxn(ctx context.Context, fn func(txn *Txn) error) error
+	Close()
+}
+
+var _ Client = (*Dgo)(nil)
+
+// TxnOptions selects the kind of transaction a Backend opens.
+type TxnOptions struct {
+	ReadOnly   bool
+	BestEffort bool // only meaningful together with ReadOnly
+}
+
+// Backend executes requests on behalf of *Dgo. The default backend talks to Dgraph
+// through dgo; NewClientWithBackend plugs in any other implementation.
+type Backend interface {
+	NewTxn(opts TxnOptions) TxnBackend
+	Alter(ctx context.Context, op *api.Operation) error
+	Close()
+}
+
+// TxnBackend is a single transaction opened by a Backend.
+type TxnBackend interface {
+	Do(ctx context.Context, req *api.Request) (*api.Response, error)
+	Commit(ctx context.Context) error
+	Discard(ctx context.Context) error
+}
+
+// NewClientWithBackend returns a client that sends every request to b.
+func NewClientWithBackend(b Backend) *Dgo {
+	return &Dgo{be: b}
+}
+
+// dgraphBackend is the Backend backed by a dgo client.
+type dgraphBackend struct {
+	dg *dgo.Dgraph
+}
+
+func (b dgraphBackend) NewTxn(opts TxnOptions) TxnBackend {
+	if !opts.ReadOnly {
+		return b.dg.NewTxn()
+	}
+	txn := b.dg.NewReadOnlyTxn()
+	if opts.BestEffort {
+		txn = txn.BestEffort()
+	}
+	return txn
+}
+
+func (b dgraphBackend) Alter(ctx context.Context, op *api.Operation) error {
+	return b.dg.Alter(ctx, op)
+}
+
+func (b dgraphBackend) Close() {
+	b.dg.Close()
+}
+
+// backend returns the Backend requests are sent to.
+func (d *Dgo) backend() Backend {
+	if d.be != nil {
+		return d.be
+	}
+	return dgraphBackend{dg: d.DG}
+}
@@ -0,0 +1,223 @@
+package dquely
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultHealthCheckInterval is used when Config.HealthCheckInterval is zero.
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// EndpointStatus reports the health of one Alpha endpoint as seen by the client.
+type EndpointStatus struct {
+	Addr    string
+	Healthy bool
+}
+
+// endpoint is a single Alpha connection tracked by the balancer.
+type endpoint struct {
+	addr    string
+	conn    *grpc.ClientConn
+	client  api.DgraphClient
+	healthy atomic.Bool
+}
+
+// balancer is an api.DgraphClient that spreads calls round-robin over several Alpha
+// endpoints. Endpoints that fail a health check or return codes.Unavailable are
+// skipped until a later health check succeeds. A failed call that is safe to repeat
+// is retried on the next endpoint; writes and commits are not, since the failed
+// endpoint may have applied them before the reply was lost.
+type balancer struct {
+	endpoints []*endpoint
+	next      atomic.Uint64
+	stop      chan struct{}
+	done      sync.WaitGroup
+}
+
+var _ api.DgraphClient = (*balancer)(nil)
+
+// newBalancer dials every address. Dialing is lazy, so unreachable endpoints only
+// surface on the first call or health check.
+func newBalancer(addrs []string, opts ...grpc.DialOption) (*balancer, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("dgo: at least one endpoint is required")
+	}
+	b := &balancer{stop: make(chan struct{})}
+	for _, addr := range addrs {
+		conn, err := grpc.NewClient(addr, opts...)
+		if err != nil {
+			b.close()
+			return nil, err
+		}
+		ep := &endpoint{addr: addr, conn: conn, client: api.NewDgraphClient(conn)}
+		ep.healthy.Store(true)
+		b.endpoints = append(b.endpoints, ep)
+	}
+	return b, nil
+}
+
+// startHealthChecks probes every endpoint with CheckVersion at the given interval.
+func (b *balancer) startHealthChecks(interval time.Duration) {
+	b.done.Add(1)
+	go func() {
+		defer b.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+				b.checkHealth(interval)
+			}
+		}
+	}()
+}
+
+func (b *balancer) checkHealth(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, ep := range b.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			_, err := ep.client.CheckVersion(ctx, &api.Check{})
+			ep.healthy.Store(err == nil)
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// status returns a snapshot of the endpoint health.
+func (b *balancer) status() []EndpointStatus {
+	out := make([]EndpointStatus, len(b.endpoints))
+	for i, ep := range b.endpoints {
+		out[i] = EndpointStatus{Addr: ep.addr, Healthy: ep.healthy.Load()}
+	}
+	return out
+}
+
+// candidates returns the endpoints in the order they should be tried: healthy
+// endpoints in round-robin order, followed by unhealthy ones as a last resort.
+func (b *balancer) candidates() []*endpoint {
+	n := len(b.endpoints)
+	start := (b.next.Add(1) - 1) % uint64(n)
+	healthy := make([]*endpoint, 0, n)
+	var unhealthy []*endpoint
+	for i := 0; i < n; i++ {
+		ep := b.endpoints[(start+uint64(i))%uint64(n)]
+		if ep.healthy.Load() {
+			healthy = append(healthy, ep)
+		} else {
+			unhealthy = append(unhealthy, ep)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// isUnavailable reports whether err means the endpoint could not serve the call.
+func isUnavailable(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.Unavailable
+}
+
+// invoke runs call against the candidate endpoints until one does not fail with
+// codes.Unavailable. Endpoints that fail are marked unhealthy. Unless the call is
+// repeatable, only the first endpoint is tried.
+func invoke[T any](ctx context.Context, b *balancer, repeatable bool, call func(api.DgraphClient) (T, error)) (T, error) {
+	var (
+		resp T
+		err  error
+	)
+	for _, ep := range b.candidates() {
+		resp, err = call(ep.client)
+		if !isUnavailable(err) {
+			if err == nil {
+				ep.healthy.Store(true)
+			}
+			return resp, err
+		}
+		ep.healthy.Store(false)
+		if !repeatable || ctx.Err() != nil {
+			break
+		}
+	}
+	return resp, err
+}
+
+func (b *balancer) close() {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	b.done.Wait()
+	for _, ep := range b.endpoints {
+		_ = ep.conn.Close()
+	}
+}
+
+func (b *balancer) Login(ctx context.Context, in *api.LoginRequest, opts ...grpc.CallOption) (*api.Response, error) {
+	return invoke(ctx, b, true, func(c api.DgraphClient) (*api.Response, error) { return c.Login(ctx, in, opts...) })
+}
+
+func (b *balancer) Query(ctx context.Context, in *api.Request, opts ...grpc.CallOption) (*api.Response, error) {
+	return invoke(ctx, b, len(in.Mutations) == 0, func(c api.DgraphClient) (*api.Response, error) { return c.Query(ctx, in, opts...) })
+}
+
+func (b *balancer) Alter(ctx context.Context, in *api.Operation, opts ...grpc.CallOption) (*api.Payload, error) {
+	return invoke(ctx, b, true, func(c api.DgraphClient) (*api.Payload, error) { return c.Alter(ctx, in, opts...) })
+}
+
+func (b *balancer) CommitOrAbort(ctx context.Context, in *api.TxnContext, opts ...grpc.CallOption) (*api.TxnContext, error) {
+	return invoke(ctx, b, in.Aborted, func(c api.DgraphClient) (*api.TxnContext, error) { return c.CommitOrAbort(ctx, in, opts...) })
+}
+
+func (b *balancer) CheckVersion(ctx context.Context, in *api.Check, opts ...grpc.CallOption) (*api.Version, error) {
+	return invoke(ctx, b, true, func(c api.DgraphClient) (*api.Version, error) { return c.CheckVersion(ctx, in, opts...) })
+}
+
+func (b *balancer) RunDQL(ctx context.Context, in *api.RunDQLRequest, opts ...grpc.CallOption) (*api.Response, error) {
+	return invoke(ctx, b, false, func(c api.DgraphClient) (*api.Response, error) { return c.RunDQL(ctx, in, opts...) })
+}
+
+func (b *balancer) AllocateIDs(ctx context.Context, in *api.AllocateIDsRequest, opts ...grpc.CallOption) (*api.AllocateIDsResponse, error) {
+	return invoke(ctx, b, false, func(c api.DgraphClient) (*api.AllocateIDsResponse, error) { return c.AllocateIDs(ctx, in, opts...) })
+}
+
+func (b *balancer) UpdateExtSnapshotStreamingState(ctx context.Context, in *api.UpdateExtSnapshotStreamingStateRequest, opts ...grpc.CallOption) (*api.UpdateExtSnapshotStreamingStateResponse, error) {
+	return invoke(ctx, b, false, func(c api.DgraphClient) (*api.UpdateExtSnapshotStreamingStateResponse, error) {
+		return c.UpdateExtSnapshotStreamingState(ctx, in, opts...)
+	})
+}
+
+func (b *balancer) StreamExtSnapshot(ctx context.Context, opts ...grpc.CallOption) (api.Dgraph_StreamExtSnapshotClient, error) {
+	return invoke(ctx, b, false, func(c api.DgraphClient) (api.Dgraph_StreamExtSnapshotClient, error) {
+		return c.StreamExtSnapshot(ctx, opts...)
+	})
+}
+
+func (b *balancer) CreateNamespace(ctx context.Context, in *api.CreateNamespaceRequest, opts ...grpc.CallOption) (*api.CreateNamespaceResponse, error) {
+	return invoke(ctx, b, false, func(c api.DgraphClient) (*api.CreateNamespaceResponse, error) {
+		return c.CreateNamespace(ctx, in, opts...)
+	})
+}
+
+func (b *balancer) DropNamespace(ctx context.Context, in *api.DropNamespaceRequest, opts ...grpc.CallOption) (*api.DropNamespaceResponse, error) {
+	return invoke(ctx, b, false, func(c api.DgraphClient) (*api.DropNamespaceResponse, error) { return c.DropNamespace(ctx, in, opts...) })
+}
+
+func (b *balancer) ListNamespaces(ctx context.Context, in *api.ListNamespacesRequest, opts ...grpc.CallOption) (*api.ListNamespacesResponse, error) {
+	return invoke(ctx, b, true, func(c api.DgraphClient) (*api.ListNamespacesResponse, error) {
+		return c.ListNamespaces(ctx, in, opts...)
+	})
+}
@@ -0,0 +1,286 @@
+package dquely
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+)
+
+// DefaultChunkSize is the number of items MutateMany sends per request when
+// BatchOptions.ChunkSize is zero.
+const DefaultChunkSize = 1000
+
+// BatchOptions tunes MutateMany.
+type BatchOptions struct {
+	ChunkSize int  // items per request; zero uses DefaultChunkSize
+	Deep      bool // mutate nested structs, as Mutate(ctx, data, true)
+}
+
+// BatchError reports the items of a MutateMany call that were not written. The
+// other items were written and have their uids set.
+type BatchError struct {
+	Errors map[int]error // index in the items slice -> error
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	parts := make([]string, len(indexes))
+	for n, i := range indexes {
+		parts[n] = fmt.Sprintf("item %d: %v", i, e.Errors[i])
+	}
+	return fmt.Sprintf("dgo: %d items failed: %s", len(indexes), strings.Join(parts, "; "))
+}
+
+// Unwrap returns the per-item errors, so errors.Is sees through a BatchError.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// errDuplicated is the per-item error of an insert whose uniqueness condition failed.
+var errDuplicated = errors.New("mutate failed: duplicated")
+
+// MutateMany inserts or updates a slice of struct pointers, sending ChunkSize items
+// per request instead of one request per item:
+//
+//	users := []*User{{Name: "Alice", Email: "a@x"}, {Name: "Bob", Email: "b@x"}}
+//	err := client.MutateMany(ctx, users)
+//
+// Each item is generated as by Mutate, with its blank nodes and query variables
+// renamed so items cannot collide (item 3's "_:user" becomes "_:m3.user"), and its
+// own uniqueness condition. UIDs are written back into every inserted item. Items
+// that were not written are reported in a *BatchError; an item whose unique values
+// repeat an earlier item of the same request fails as a duplicate. Requests already
+// committed stay committed when a later one fails. Under UniqueServer a taken value
+// fails its whole request with a *DuplicateError.
+func (d *Dgo) MutateMany(ctx context.Context, items any, opts ...BatchOptions) (err error) {
+	var opt BatchOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	list, err := batchItems(items)
+	if err != nil {
+		return fmt.Errorf("dgo: mutate many: %w", err)
+	}
+	typeName := ""
+	if len(list) > 0 {
+		typeName = dgraphTypeOf(list[0].data)
+	}
+	ctx, span := d.startOperation(ctx, "MutateMany", AttrDgraphType.String(typeName))
+	defer func() { span.end(ctx, err) }()
+	size := opt.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	for start := 0; start < len(list); start += size {
+		chunk := list[start:min(start+size, len(list))]
+		if err := d.sendBatch(ctx, span, "MutateMany", chunk, opt.Deep, d.Retry); err != nil {
+			return fmt.Errorf("dgo: mutate many: items %d-%d: %w", start, start+len(chunk)-1, err)
+		}
+	}
+	failed := map[int]error{}
+	for _, it := range list {
+		if it.err != nil {
+			failed[it.index] = it.err
+		}
+	}
+	if len(failed) > 0 {
+		return &BatchError{Errors: failed}
+	}
+	return nil
+}
+
+// sendBatch writes one chunk in a single request, retried with policy, and records
+// per-item failures on the items.
+func (d *Dgo) sendBatch(ctx context.Context, span *operation, op string, chunk []*batchItem, deep bool, policy RetryPolicy) error {
+	req, err := d.batchRequest(chunk, deep)
+	if err != nil {
+		return fmt.Errorf("build mutation: %w", err)
+	}
+	if req == nil {
+		return nil
+	}
+	span.recordMutations(ctx, req.Mutations)
+	var resp *api.Response
+	err = policy.retryCommit(ctx, op, func() (err error) {
+		resp, err = d.backend().NewTxn(TxnOptions{}).Do(ctx, req)
+		return err
+	})
+	if err != nil {
+		// Dgraph rejects the whole request when a value of a @unique predicate is taken.
+		if dup := duplicateOfServer(err, pendingData(chunk)...); dup != nil {
+			return dup
+		}
+		return err
+	}
+	span.recordResponse(ctx, resp)
+	if d.Debug {
+		fmt.Printf("resp Uids: %+v\n", resp.Uids)
+	}
+	return applyBatch(chunk, resp)
+}
+
+// pendingData returns the data of the items of chunk that have no error yet.
+func pendingData(chunk []*batchItem) []any {
+	var out []any
+	for _, it := range chunk {
+		if it.err == nil {
+			out = append(out, it.data)
+		}
+	}
+	return out
+}
+
+// batchItem is one element of a MutateMany call.
+type batchItem struct {
+	index  int
+	data   any
+	names  mutationNames // "m3." blank nodes and "_3" variables and blocks
+	insert bool          // the item has no uid, so its root blank node must come back
+	err    error
+}
+
+// newBatchItem returns the item at index of a request, with names of its own.
+func newBatchItem(index int, data any) *batchItem {
+	i := strconv.Itoa(index)
+	return &batchItem{index: index, data: data, names: mutationNames{prefix: "m" + i + ".", suffix: "_" + i}}
+}
+
+// batchItems checks that items is a slice of struct pointers.
+func batchItems(items any) ([]*batchItem, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Ptr || v.Type().Elem().Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dquely: MutateMany expects a slice of pointers to structs, got %T", items)
+	}
+	list := make([]*batchItem, v.Len())
+	for i := range list {
+		if v.Index(i).IsNil() {
+			return nil, fmt.Errorf("dquely: MutateMany item %d is nil", i)
+		}
+		list[i] = newBatchItem(i, v.Index(i).Interface())
+	}
+	return list, nil
+}
+
+// batchRequest combines the mutations of the items that have no error yet into
+// one request. It returns nil when no item is left to send.
+func (d *Dgo) batchRequest(chunk []*batchItem, deep bool) (*api.Request, error) {
+	var blocks []string
+	var mus []*api.Mutation
+	seen := map[string]bool{}
+	for _, it := range chunk {
+		if it.err != nil {
+			continue
+		}
+		uid := structUID(reflect.ValueOf(it.data).Elem(), reflect.TypeOf(it.data).Elem())
+		it.insert = uid == ""
+		if it.insert {
+			// Conditions only see the data committed before the request, so a
+			// unique value repeated within the request is caught here.
+			if key, dup := batchDuplicate(it.data, seen); dup {
+				it.err = fmt.Errorf("%w: %s repeats an earlier item", errDuplicated, key)
+				continue
+			}
+		}
+		query, itemMus, err := parseMutation(it.data, d.Unique, it.names, deep)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", it.index, err)
+		}
+		if query = strings.TrimSpace(query); query != "" {
+			query = strings.TrimSuffix(strings.TrimPrefix(query, "{"), "}")
+			blocks = append(blocks, strings.Trim(query, "\n"))
+		}
+		if itemMus, err = d.encode(it.data, itemMus); err != nil {
+			return nil, fmt.Errorf("item %d: %w", it.index, err)
+		}
+		if d.Debug {
+			d.debugMutation(query, itemMus[0])
+		}
+		mus = append(mus, itemMus...)
+	}
+	if len(mus) == 0 {
+		return nil, nil
+	}
+	req := &api.Request{Mutations: mus, CommitNow: true}
+	if len(blocks) > 0 {
+		req.Query = "{\n" + strings.Join(blocks, "\n\n") + "\n}"
+	}
+	return req, nil
+}
+
+// batchDuplicate records the unique keys of data in seen and reports the first one
+// an earlier item already used.
+func batchDuplicate(data any, seen map[string]bool) (string, bool) {
+	v := reflect.ValueOf(data).Elem()
+	uniques, _ := uniqueKeys(v, v.Type())
+	typeName := dgraphTypeOf(data)
+	var keys []string
+	for _, u := range uniques {
+		key := typeName + " " + u.filter()
+		if seen[key] {
+			return key, true
+		}
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		seen[key] = true
+	}
+	return "", false
+}
+
+// applyBatch writes the uids of each item back into it and marks items whose
+// condition failed as duplicates: those with nodes in their duplicates block, and
+// inserts whose root blank node is missing.
+func applyBatch(chunk []*batchItem, resp *api.Response) error {
+	for _, it := range chunk {
+		if it.err != nil {
+			continue
+		}
+		dup, err := duplicateOf(it.data, resp.Json, it.names.name(duplicatesBlock))
+		if err != nil {
+			return err
+		}
+		if dup != nil {
+			it.err = dup
+			continue
+		}
+		own, err := linkedUIDs(it.data, it.names, resp.Json)
+		if err != nil {
+			return err
+		}
+		for name, uid := range resp.Uids {
+			if rest, ok := strings.CutPrefix(name, it.names.prefix); ok {
+				own[rest] = uid
+			}
+		}
+		if it.insert {
+			root, err := BlankNodeName(it.data)
+			if err != nil {
+				return err
+			}
+			if _, ok := own[root]; !ok {
+				it.err = errDuplicated
+				continue
+			}
+		}
+		if len(own) > 0 {
+			if err := SetUIDs(it.data, own); err != nil {
+				return fmt.Errorf("item %d: %w", it.index, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package dquely
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Defaults applied by NewBulkWriter when a BulkOptions field is zero.
+const (
+	DefaultBulkBatchSize   = 1000
+	DefaultBulkConcurrency = 4
+	DefaultBulkAttempts    = 3
+)
+
+// BulkOptions tunes a BulkWriter.
+type BulkOptions struct {
+	BatchSize   int  // items per transaction; zero uses DefaultBulkBatchSize
+	Concurrency int  // transactions in flight; zero uses DefaultBulkConcurrency
+	Deep        bool // mutate nested structs, as Mutate(ctx, data, true)
+	// Retry controls how aborted batches are retried before they are split in two.
+	// A zero MaxAttempts uses the client's Retry, or DefaultBulkAttempts when the
+	// client does not retry either.
+	Retry RetryPolicy
+}
+
+// BulkEvent reports one finished batch of a BulkWriter.
+type BulkEvent struct {
+	Items   []any         // the items of the batch, in Write order
+	Errors  map[int]error // index in Items -> error, for items that were not written
+	Written int64         // items written so far by the writer, this batch included
+	Failed  int64         // items failed so far by the writer, this batch included
+}
+
+// BulkStats are the running totals of a BulkWriter.
+type BulkStats struct {
+	Written int64 // items written
+	Failed  int64 // items not written
+	Batches int64 // batches finished
+	Splits  int64 // batches split in two after conflicting on every attempt
+}
+
+// BulkWriter writes a stream of structs with several concurrent transactions,
+// for backfills:
+//
+//	w := client.NewBulkWriter(ctx, dquely.BulkOptions{BatchSize: 500, Concurrency: 8})
+//	go func() {
+//		for ev := range w.Events() {
+//			log.Printf("written %d, failed %d", ev.Written, ev.Failed)
+//		}
+//	}()
+//	for _, u := range users {
+//		if err := w.Write(u); err != nil {
+//			return err
+//		}
+//	}
+//	err := w.Close()
+//
+// Items are generated and written back exactly as by MutateMany. A batch that is
+// still aborted after its retries, usually because concurrent batches touch the
+// same unique values, is split in two and each half is written on its own. Events
+// must be drained: the writer blocks when the event buffer is full.
+type BulkWriter struct {
+	d      *Dgo
+	ctx    context.Context
+	opts   BulkOptions
+	events chan BulkEvent
+	queue  chan []any
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex // guards pending and closed
+	pending []any
+	closed  bool
+	sending sync.RWMutex // held for reading while a batch is being queued
+
+	written, failed, batches, splits atomic.Int64
+}
+
+// NewBulkWriter starts a BulkWriter. Its transactions stop when ctx is done.
+func (d *Dgo) NewBulkWriter(ctx context.Context, opts BulkOptions) *BulkWriter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBulkBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultBulkConcurrency
+	}
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry = d.Retry
+		if opts.Retry.MaxAttempts <= 0 {
+			opts.Retry.MaxAttempts = DefaultBulkAttempts
+		}
+	}
+	w := &BulkWriter{
+		d:      d,
+		ctx:    ctx,
+		opts:   opts,
+		events: make(chan BulkEvent, opts.Concurrency),
+		queue:  make(chan []any),
+	}
+	w.wg.Add(opts.Concurrency)
+	for i := 0; i < opts.Concurrency; i++ {
+		go w.run()
+	}
+	return w
+}
+
+// Events returns the channel of finished batches. It is closed by Close.
+func (w *BulkWriter) Events() <-chan BulkEvent {
+	return w.events
+}
+
+// Stats returns the running totals.
+func (w *BulkWriter) Stats() BulkStats {
+	return BulkStats{
+		Written: w.written.Load(),
+		Failed:  w.failed.Load(),
+		Batches: w.batches.Load(),
+		Splits:  w.splits.Load(),
+	}
+}
+
+// Write queues a pointer to a struct. It blocks while every transaction is busy
+// and a full batch is waiting.
+func (w *BulkWriter) Write(item any) error {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("dgo: bulk write: expects a pointer to struct, got %T", item)
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errors.New("dgo: bulk write: writer is closed")
+	}
+	w.pending = append(w.pending, item)
+	if len(w.pending) < w.opts.BatchSize {
+		w.mu.Unlock()
+		return nil
+	}
+	return w.sendPending()
+}
+
+// Flush queues the items written so far as a batch, even if it is not full.
+func (w *BulkWriter) Flush() error {
+	w.mu.Lock()
+	return w.sendPending()
+}
+
+// sendPending queues the pending items and unlocks mu. Holding sending until the
+// batch is queued keeps Close from closing the queue under it.
+func (w *BulkWriter) sendPending() error {
+	batch := w.pending
+	w.pending = nil
+	if len(batch) == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	w.sending.RLock()
+	w.mu.Unlock()
+	defer w.sending.RUnlock()
+	select {
+	case w.queue <- batch:
+		return nil
+	case <-w.ctx.Done():
+		w.finish(batch, nil, w.ctx.Err())
+		return fmt.Errorf("dgo: bulk write: %w", w.ctx.Err())
+	}
+}
+
+// Close writes the remaining items, waits for every batch and closes Events. It
+// returns the context error if the writer was cancelled; failed items are only
+// reported through Events and Stats.
+func (w *BulkWriter) Close() (err error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	err = w.sendPending()
+	w.sending.Lock()
+	close(w.queue)
+	w.sending.Unlock()
+	w.wg.Wait()
+	close(w.events)
+	if err == nil && w.ctx.Err() != nil {
+		err = fmt.Errorf("dgo: bulk write: %w", w.ctx.Err())
+	}
+	return err
+}
+
+func (w *BulkWriter) run() {
+	defer w.wg.Done()
+	for batch := range w.queue {
+		if err := w.ctx.Err(); err != nil {
+			w.finish(batch, nil, err)
+			continue
+		}
+		list := make([]*batchItem, len(batch))
+		for i, item := range batch {
+			list[i] = newBatchItem(i, item)
+		}
+		ctx, span := w.d.startOperation(w.ctx, "BulkWrite", AttrDgraphType.String(dgraphTypeOf(batch[0])))
+		w.write(ctx, span, list)
+		span.end(ctx, w.finish(batch, list, nil))
+	}
+}
+
+// write sends list, splitting it in two while it keeps being aborted.
+func (w *BulkWriter) write(ctx context.Context, span *operation, list []*batchItem) {
+	err := w.d.sendBatch(ctx, span, "BulkWrite", list, w.opts.Deep, w.opts.Retry)
+	if err == nil {
+		return
+	}
+	if len(list) > 1 && IsAborted(err) {
+		w.splits.Add(1)
+		half := len(list) / 2
+		w.write(ctx, span, list[:half])
+		w.write(ctx, span, list[half:])
+		return
+	}
+	for _, it := range list {
+		if it.err == nil {
+			it.err = err
+		}
+	}
+}
+
+// finish records the outcome of a batch, emits its event and returns a *BatchError
+// when items failed. A nil list with err marks every item of the batch as failed.
+func (w *BulkWriter) finish(batch []any, list []*batchItem, err error) error {
+	failed := map[int]error{}
+	for i := range batch {
+		switch {
+		case list == nil:
+			failed[i] = err
+		case list[i].err != nil:
+			failed[i] = list[i].err
+		}
+	}
+	written := w.written.Add(int64(len(batch) - len(failed)))
+	total := w.failed.Add(int64(len(failed)))
+	w.batches.Add(1)
+	w.events <- BulkEvent{Items: batch, Errors: failed, Written: written, Failed: total}
+	if len(failed) > 0 {
+		return &BatchError{Errors: failed}
+	}
+	return nil
+}
@@ -2,122 +2,322 @@ package dquely
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/dgraph-io/dgo/v250"
 	"github.com/dgraph-io/dgo/v250/protos/api"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Config struct {
-	DNS       string `mapstructure:"dns"`
-	Username  string `mapstructure:"username"`
-	Password  string `mapstructure:"password"`
-	Namespace uint64 `mapstructure:"namespace"`
+	DNS string `mapstructure:"dns"`
+	// Endpoints lists additional Alpha addresses; requests are balanced across all of them.
+	Endpoints []string `mapstructure:"endpoints"`
+	// HealthCheckInterval sets how often endpoints are probed when there is more than
+	// one. Zero uses DefaultHealthCheckInterval; a negative value disables probing.
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+	Username            string        `mapstructure:"username"`
+	Password            string        `mapstructure:"password"`
+	Namespace           uint64        `mapstructure:"namespace"`
+	// TLS enables transport security. A nil TLS connects in plaintext.
+	TLS *TLSConfig `mapstructure:"tls"`
+	// DialOptions are appended to the gRPC dial options after the transport credentials.
+	DialOptions []grpc.DialOption `mapstructure:"-"`
+	// Retry controls retries of DoTxn, Mutate and Update; the zero value never retries.
+	Retry RetryPolicy `mapstructure:"retry"`
+	// Encoding selects N-Quad (default) or JSON mutations for Mutate and Update.
+	Encoding Encoding `mapstructure:"encoding"`
+	// Unique selects how unique fields are enforced; the zero value uses UniqueQuery.
+	Unique UniqueMode `mapstructure:"unique"`
+	// Telemetry configures tracing and metrics; the zero value uses the global providers.
+	Telemetry Telemetry `mapstructure:"-"`
+}
+
+// TLSConfig configures TLS, and optionally mutual TLS, towards the Alpha.
+// Set CertFile and KeyFile together to present a client certificate.
+type TLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// credentials builds the gRPC transport credentials described by c.
+func (c *TLSConfig) credentials() (credentials.TransportCredentials, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("dgo: read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("dgo: no certificates found in CA file %s", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("dgo: tls cert_file and key_file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("dgo: load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsCfg), nil
 }
 
 type Dgo struct {
 	DG    *dgo.Dgraph
 	Debug bool
+	// Retry is applied to DoTxn, Mutate and Update.
+	Retry RetryPolicy
+	// Encoding selects N-Quad (default) or JSON mutations for Mutate and Update.
+	Encoding Encoding
+	// Unique selects how Mutate, MutateMany and SchemaOf enforce unique fields.
+	Unique UniqueMode
+
+	be  Backend
+	lb  *balancer
+	ins atomic.Pointer[instruments]
 }
 
+// connectTimeout bounds the login and version check performed by NewClient.
+const connectTimeout = 30 * time.Second
+
 // NewClient creates a Dgraph client and verifies connectivity.
+// Requests are spread over Endpoints (and DNS, when set); unhealthy endpoints are
+// skipped and failed calls are retried on the next one.
 // Call Close() when the client is no longer needed.
 func NewClient(cfg Config) (*Dgo, error) {
-	opts := []dgo.ClientOption{
-		dgo.WithGrpcOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
-	}
+	creds := insecure.NewCredentials()
+	if cfg.TLS != nil {
+		var err error
+		if creds, err = cfg.TLS.credentials(); err != nil {
+			return nil, err
+		}
+	}
+	gopts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, cfg.DialOptions...)
 
 	if cfg.Username == "" || cfg.Password == "" {
 		return nil, errors.New("dgo: username and password are required")
 	}
-	opts = append(opts, dgo.WithACLCreds(cfg.Username, cfg.Password))
 
-	if cfg.Namespace != 0 {
-		opts = append(opts, dgo.WithNamespace(cfg.Namespace))
+	addrs := cfg.endpoints()
+	lb, err := newBalancer(addrs, gopts...)
+	if err != nil {
+		return nil, fmt.Errorf("dgo: connect to %s: %w", strings.Join(addrs, ","), err)
 	}
+	dg := dgo.NewDgraphClient(lb)
 
-	dg, err := dgo.NewClient(cfg.DNS, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("dgo: connect to %s: %w", cfg.DNS, err)
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := dg.LoginIntoNamespace(ctx, cfg.Username, cfg.Password, cfg.Namespace); err != nil {
+		lb.close()
+		return nil, fmt.Errorf("dgo: connect to %s: failed to sign in user: %w", strings.Join(addrs, ","), err)
+	}
+	if _, err := lb.CheckVersion(ctx, &api.Check{}); err != nil {
+		lb.close()
+		return nil, fmt.Errorf("dgo: connect to %s: failed to ping: %w", strings.Join(addrs, ","), err)
 	}
 
-	return &Dgo{DG: dg}, nil
+	interval := cfg.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	if interval > 0 && len(addrs) > 1 {
+		lb.startHealthChecks(interval)
+	}
+
+	d := &Dgo{DG: dg, Retry: cfg.Retry, Encoding: cfg.Encoding, Unique: cfg.Unique, lb: lb}
+	if err := d.SetTelemetry(cfg.Telemetry); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// endpoints returns the Alpha addresses to connect to: DNS followed by Endpoints.
+func (cfg Config) endpoints() []string {
+	var addrs []string
+	if cfg.DNS != "" {
+		addrs = append(addrs, cfg.DNS)
+	}
+	for _, e := range cfg.Endpoints {
+		if e != cfg.DNS {
+			addrs = append(addrs, e)
+		}
+	}
+	return addrs
 }
 
 // Close releases all underlying gRPC connections.
 func (d *Dgo) Close() {
-	d.DG.Close()
+	d.backend().Close()
+	if d.lb != nil {
+		d.lb.close()
+	}
+}
+
+// Endpoints reports the health of every Alpha endpoint the client was created with.
+// It returns nil for clients not created by NewClient.
+func (d *Dgo) Endpoints() []EndpointStatus {
+	if d.lb == nil {
+		return nil
+	}
+	return d.lb.status()
 }
 
-func (d *Dgo) SetSchema(ctx context.Context, schema string) error {
+func (d *Dgo) SetSchema(ctx context.Context, schema string) (err error) {
+	ctx, span := d.startOperation(ctx, "SetSchema")
+	defer func() { span.end(ctx, err) }()
 	op := &api.Operation{
 		Schema: schema,
 	}
-	return d.DG.Alter(ctx, op)
+	return d.backend().Alter(ctx, op)
 }
 
 func (d *Dgo) debugMutation(query string, mu *api.Mutation) {
 	fmt.Printf("query: %s\n", query)
 	fmt.Printf("condition: %s\n", mu.Cond)
+	if d.Encoding == EncodingJSON {
+		fmt.Printf("SetJson: %s\n", mu.SetJson)
+		fmt.Printf("DeleteJson: %s\n", mu.DeleteJson)
+		return
+	}
 	fmt.Printf("SetNquads: %s\n", mu.SetNquads)
 	fmt.Printf("DelNquads: %s\n", mu.DelNquads)
 }
 
-func (d *Dgo) Mutate(ctx context.Context, data any, deep ...bool) error {
-	query, mu, err := ParseMutation(data, deep...)
+// encode converts the N-Quad mutations generated for data to the client's Encoding.
+func (d *Dgo) encode(data any, mus []*api.Mutation) ([]*api.Mutation, error) {
+	if d.Encoding == EncodingJSON {
+		return encodeJSON(mus, jsonKinds(data))
+	}
+	return mus, nil
+}
+
+func (d *Dgo) Mutate(ctx context.Context, data any, deep ...bool) (err error) {
+	ctx, span := d.startOperation(ctx, "Mutate", AttrDgraphType.String(dgraphTypeOf(data)))
+	defer func() { span.end(ctx, err) }()
+	query, mu, err := parseMutation(data, d.Unique, mutationNames{}, deep...)
+	if err == nil {
+		mu, err = d.encode(data, mu)
+	}
 	if err != nil {
 		return fmt.Errorf("dgo: build mutation: %w", err)
 	}
 	if d.Debug {
 		d.debugMutation(query, mu[0])
 	}
+	span.recordMutations(ctx, mu)
 	req := &api.Request{
 		Query:     query,
 		Mutations: mu,
 		CommitNow: true,
 	}
-	resp, err := d.DG.NewTxn().Do(ctx, req)
+	var resp *api.Response
+	err = d.Retry.retryCommit(ctx, "Mutate", func() (err error) {
+		resp, err = d.backend().NewTxn(TxnOptions{}).Do(ctx, req)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("dgo: mutate: %w", err)
+		return mutateError(data, err)
 	}
+	span.recordResponse(ctx, resp)
 	if d.Debug {
 		fmt.Printf("resp Uids: %+v\n", resp.Uids)
 	}
+	return mutateResult(data, resp)
+}
+
+// mutateError maps Dgraph rejecting a value of data for a @unique predicate to a
+// DuplicateError.
+func mutateError(data any, err error) error {
+	if dup := duplicateOfServer(err, data); dup != nil {
+		return dup
+	}
+	return fmt.Errorf("dgo: mutate: %w", err)
+}
+
+// mutateResult returns the DuplicateError of a blocked Mutate, or writes the uids of
+// the response back into data.
+func mutateResult(data any, resp *api.Response) error {
+	dup, err := duplicateOf(data, resp.Json, duplicatesBlock)
+	if err != nil {
+		return fmt.Errorf("dgo: mutate: %w", err)
+	}
+	if dup != nil {
+		return dup
+	}
 	// If the conditional mutation fired, resp.Uids contains the new UID keyed by the
 	// blank-node name. Write it back into the struct's dquely:"uid" field.
 	blankNode, err := BlankNodeName(data)
 	if err != nil {
 		return fmt.Errorf("dgo: inject node name: %w", err)
 	}
-	_, ok := resp.Uids[blankNode]
-	if !ok {
+	v := reflect.ValueOf(data).Elem()
+	if _, ok := resp.Uids[blankNode]; !ok && structUID(v, v.Type()) == "" {
 		// if there isn't node name mean the main node name was not inserted
 		// because duplicate condition was not matched
-		return fmt.Errorf("mutate failed: duplicated")
+		return errDuplicated
 	}
-	return SetUIDs(data, resp.Uids)
+	uids, err := linkedUIDs(data, mutationNames{}, resp.Json)
+	if err != nil {
+		return fmt.Errorf("dgo: mutate: %w", err)
+	}
+	for name, uid := range resp.Uids {
+		uids[name] = uid
+	}
+	return SetUIDs(data, uids)
 }
 
-func (d *Dgo) Update(ctx context.Context, data any, fields ...string) error {
+func (d *Dgo) Update(ctx context.Context, data any, fields ...string) (err error) {
+	ctx, span := d.startOperation(ctx, "Update", AttrDgraphType.String(dgraphTypeOf(data)))
+	defer func() { span.end(ctx, err) }()
 	query, mu, err := ParseUpdate(data, fields...)
+	if err == nil {
+		mu, err = d.encode(data, mu)
+	}
 	if err != nil {
 		return fmt.Errorf("dgo: build mutation: %w", err)
 	}
 	if d.Debug {
 		d.debugMutation(query, mu[0])
 	}
+	span.recordMutations(ctx, mu)
 	req := &api.Request{
 		Query:     query,
 		Mutations: mu,
 		CommitNow: true,
 	}
-	resp, err := d.DG.NewTxn().Do(ctx, req)
+	var resp *api.Response
+	err = d.Retry.retryCommit(ctx, "Update", func() (err error) {
+		resp, err = d.backend().NewTxn(TxnOptions{}).Do(ctx, req)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("dgo: mutate: %w", err)
+		return mutateError(data, err)
 	}
+	span.recordResponse(ctx, resp)
 	if d.Debug {
 		fmt.Printf("resp Uids: %+v\n", resp.Uids)
 	}
@@ -129,11 +329,7 @@ func (d *Dgo) Update(ctx context.Context, data any, fields ...string) error {
 // If any operation returns an error, call Discard to roll back.
 type Txn struct {
 	d   *Dgo
-	txn interface {
-		Do(ctx context.Context, req *api.Request) (*api.Response, error)
-		Commit(ctx context.Context) error
-		Discard(ctx context.Context) error
-	}
+	txn TxnBackend
 }
 
 // NewTxn opens a new read-write transaction.
@@ -144,40 +340,64 @@ type Txn struct {
 //	if err := txn.Mutate(ctx, &user); err != nil { return err }
 //	return txn.Commit(ctx)
 func (d *Dgo) NewTxn() *Txn {
-	return &Txn{d: d, txn: d.DG.NewTxn()}
+	return &Txn{d: d, txn: d.backend().NewTxn(TxnOptions{})}
 }
 
 // Commit commits the transaction. Returns an error if the commit fails.
-func (t *Txn) Commit(ctx context.Context) error {
+func (t *Txn) Commit(ctx context.Context) (err error) {
+	ctx, span := t.d.startOperation(ctx, "Txn.Commit")
+	defer func() { span.end(ctx, err) }()
 	return t.txn.Commit(ctx)
 }
 
 // Discard releases the transaction resources. Safe to call after Commit.
 // Should be called via defer to ensure cleanup on error paths.
 func (t *Txn) Discard(ctx context.Context) {
-	_ = t.txn.Discard(ctx)
+	ctx, span := t.d.startOperation(ctx, "Txn.Discard")
+	span.end(ctx, t.txn.Discard(ctx))
 }
 
 // DoTxn runs fn inside a single transaction. If fn returns an error the
 // transaction is discarded (rolled back); otherwise it is committed.
+// When the error is retryable under d.Retry (e.g. the transaction was aborted by a
+// conflict) fn runs again in a fresh transaction, so it must not rely on side
+// effects of a previous attempt. A failed commit is only retried by default when
+// it was aborted: after a transient error it may have been applied.
 func (d *Dgo) DoTxn(ctx context.Context, fn func(txn *Txn) error) error {
-	txn := d.NewTxn()
-	if err := fn(txn); err != nil {
-		txn.Discard(ctx)
-		return err
-	}
-	return txn.Commit(ctx)
+	committing := false
+	retryable := func(err error) bool {
+		if committing {
+			return IsAborted(err)
+		}
+		return IsRetryable(err)
+	}
+	return d.Retry.run(ctx, "DoTxn", retryable, func() error {
+		committing = false
+		txn := d.NewTxn()
+		if err := fn(txn); err != nil {
+			txn.Discard(ctx)
+			return err
+		}
+		committing = true
+		return txn.Commit(ctx)
+	})
 }
 
 // Mutate executes a mutation within the transaction without committing.
-func (t *Txn) Mutate(ctx context.Context, data any, deep ...bool) error {
-	query, mu, err := ParseMutation(data, deep...)
+func (t *Txn) Mutate(ctx context.Context, data any, deep ...bool) (err error) {
+	ctx, span := t.d.startOperation(ctx, "Txn.Mutate", AttrDgraphType.String(dgraphTypeOf(data)))
+	defer func() { span.end(ctx, err) }()
+	query, mu, err := parseMutation(data, t.d.Unique, mutationNames{}, deep...)
+	if err == nil {
+		mu, err = t.d.encode(data, mu)
+	}
 	if err != nil {
 		return fmt.Errorf("dgo: build mutation: %w", err)
 	}
 	if t.d.Debug {
 		t.d.debugMutation(query, mu[0])
 	}
+	span.recordMutations(ctx, mu)
 	req := &api.Request{
 		Query:     query,
 		Mutations: mu,
@@ -185,30 +405,30 @@ func (t *Txn) Mutate(ctx context.Context, data any, deep ...bool) error {
 	}
 	resp, err := t.txn.Do(ctx, req)
 	if err != nil {
-		return fmt.Errorf("dgo: mutate: %w", err)
+		return mutateError(data, err)
 	}
+	span.recordResponse(ctx, resp)
 	if t.d.Debug {
 		fmt.Printf("resp Uids: %+v\n", resp.Uids)
 	}
-	blankNode, err := BlankNodeName(data)
-	if err != nil {
-		return fmt.Errorf("dgo: inject node name: %w", err)
-	}
-	if _, ok := resp.Uids[blankNode]; !ok {
-		return fmt.Errorf("mutate failed: duplicated")
-	}
-	return SetUIDs(data, resp.Uids)
+	return mutateResult(data, resp)
 }
 
 // Update executes an update within the transaction without committing.
-func (t *Txn) Update(ctx context.Context, data any, fields ...string) error {
+func (t *Txn) Update(ctx context.Context, data any, fields ...string) (err error) {
+	ctx, span := t.d.startOperation(ctx, "Txn.Update", AttrDgraphType.String(dgraphTypeOf(data)))
+	defer func() { span.end(ctx, err) }()
 	query, mu, err := ParseUpdate(data, fields...)
+	if err == nil {
+		mu, err = t.d.encode(data, mu)
+	}
 	if err != nil {
 		return fmt.Errorf("dgo: build mutation: %w", err)
 	}
 	if t.d.Debug {
 		t.d.debugMutation(query, mu[0])
 	}
+	span.recordMutations(ctx, mu)
 	req := &api.Request{
 		Query:     query,
 		Mutations: mu,
@@ -216,42 +436,115 @@ func (t *Txn) Update(ctx context.Context, data any, fields ...string) error {
 	}
 	resp, err := t.txn.Do(ctx, req)
 	if err != nil {
-		return fmt.Errorf("dgo: mutate: %w", err)
+		return mutateError(data, err)
 	}
+	span.recordResponse(ctx, resp)
 	if t.d.Debug {
 		fmt.Printf("resp Uids: %+v\n", resp.Uids)
 	}
 	return nil
 }
 
+// Query runs a raw DQL query in a new transaction of the given kind and returns
+// the response as is.
+func (d *Dgo) Query(ctx context.Context, query string, opts TxnOptions) (*api.Response, error) {
+	req := &api.Request{Query: query, ReadOnly: opts.ReadOnly, BestEffort: opts.ReadOnly && opts.BestEffort}
+	return d.backend().NewTxn(opts).Do(ctx, req)
+}
+
+// Query runs a raw DQL query inside the transaction, observing its uncommitted writes.
+func (t *Txn) Query(ctx context.Context, query string) (*api.Response, error) {
+	return t.txn.Do(ctx, &api.Request{Query: query})
+}
+
 type Query[T any] struct {
-	d *Dgo
+	c          Client
+	txn        *Txn
+	readOnly   bool
+	bestEffort bool
+	schema     *Schema
+}
+
+func Model[T any](c Client) Query[T] {
+	return Query[T]{c: c}
+}
+
+// ReadOnly runs the query in a read-only transaction, which Dgraph can serve
+// without tracking conflicts.
+func (q Query[T]) ReadOnly() Query[T] {
+	q.readOnly = true
+	return q
+}
+
+// BestEffort runs the query in a read-only, best-effort transaction: Dgraph may
+// answer from its latest local state instead of waiting for the newest timestamp.
+func (q Query[T]) BestEffort() Query[T] {
+	q.readOnly = true
+	q.bestEffort = true
+	return q
 }
 
-func Model[T any](d *Dgo) Query[T] {
-	return Query[T]{d: d}
+// InTxn runs the query inside txn so it observes the transaction's uncommitted
+// writes, e.g. from within DoTxn. ReadOnly and BestEffort are ignored.
+func (q Query[T]) InTxn(txn *Txn) Query[T] {
+	q.c = txn.d
+	q.txn = txn
+	return q
 }
 
-func (q Query[T]) First(ctx context.Context, filter DgFilter) (*T, error) {
-	var result *T
+// Strict validates every query against schema before sending it, failing with
+// the *SchemaError problems instead of a Dgraph runtime error.
+func (q Query[T]) Strict(schema *Schema) Query[T] {
+	q.schema = schema
+	return q
+}
+
+// run executes a query in the transaction selected by the query modifiers.
+func (q Query[T]) run(ctx context.Context, query string) (*api.Response, error) {
+	if q.schema != nil {
+		if err := ValidateDQL(query, q.schema); err != nil {
+			return nil, err
+		}
+	}
+	if q.txn != nil {
+		return q.txn.Query(ctx, query)
+	}
+	return q.c.Query(ctx, query, TxnOptions{ReadOnly: q.readOnly, BestEffort: q.bestEffort})
+}
+
+func (q Query[T]) First(ctx context.Context, filter DgFilter) (result *T, err error) {
+	ctx, span := clientInstruments(q.c).start(ctx, "Query.First", q.attributes(filter)...)
+	defer func() { span.end(ctx, err) }()
 	var query = filter.Query()
-	resp, err := q.d.DG.NewTxn().Query(ctx, query)
+	resp, err := q.run(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("dgo: query: %w", err)
 	}
-	result, err = q.parseData(resp.Json, filter.DgraphKey())
-	return result, nil
+	span.recordResponse(ctx, resp)
+	return q.parseData(resp.Json, filter.DgraphKey())
 }
 
-func (q Query[T]) Find(ctx context.Context, filter DgFilter) ([]T, error) {
-	var result []T
+func (q Query[T]) Find(ctx context.Context, filter DgFilter) (result []T, err error) {
+	ctx, span := clientInstruments(q.c).start(ctx, "Query.Find", q.attributes(filter)...)
+	defer func() { span.end(ctx, err) }()
 	var query = filter.Query()
-	resp, err := q.d.DG.NewTxn().Query(ctx, query)
+	resp, err := q.run(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("dgo: query: %w", err)
 	}
-	result, err = q.parseDataMulti(resp.Json, filter.DgraphKey())
-	return result, nil
+	span.recordResponse(ctx, resp)
+	return q.parseDataMulti(resp.Json, filter.DgraphKey())
+}
+
+// attributes returns the span attributes describing a query on T.
+func (q Query[T]) attributes(filter DgFilter) []attribute.KeyValue {
+	var zero T
+	return []attribute.KeyValue{
+		AttrBlock.String(filter.DgraphKey()),
+		AttrDgraphType.String(dgraphTypeOf(&zero)),
+		AttrReadOnly.Bool(q.readOnly && q.txn == nil),
+		AttrBestEffort.Bool(q.bestEffort && q.txn == nil),
+	}
 }
 
 func (q Query[T]) parseDataMulti(data []byte, key string) ([]T, error) {
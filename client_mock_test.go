@@ -0,0 +1,232 @@
+package dquely_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely/dquelytest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// stubAlpha is an in-process implementation of the Dgraph gRPC API. It records the
+// requests it receives, assigns a fresh uid to every blank node it sees, and answers
+// queries with a canned JSON payload.
+type stubAlpha struct {
+	api.UnimplementedDgraphServer
+
+	srv         *grpc.Server
+	mu          sync.Mutex
+	requests    []*api.Request
+	schemas     []string
+	commits     int
+	aborts      int
+	json        []byte
+	abortN      int // number of upcoming mutations to reject with codes.Aborted
+	failN       int // number of upcoming requests to reject with codes.Unavailable
+	commitFailN int // number of upcoming commits to reject with codes.Unavailable
+	nextUID     int
+}
+
+// requestCount returns the number of Query requests served so far.
+func (s *stubAlpha) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func (s *stubAlpha) Login(context.Context, *api.LoginRequest) (*api.Response, error) {
+	b, err := proto.Marshal(&api.Jwt{AccessJwt: "access", RefreshJwt: "refresh"})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Response{Json: b}, nil
+}
+
+func (s *stubAlpha) CheckVersion(context.Context, *api.Check) (*api.Version, error) {
+	return &api.Version{Tag: "v25.0.0"}, nil
+}
+
+func (s *stubAlpha) Alter(_ context.Context, op *api.Operation) (*api.Payload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schemas = append(s.schemas, op.Schema)
+	return &api.Payload{}, nil
+}
+
+func (s *stubAlpha) CommitOrAbort(_ context.Context, tc *api.TxnContext) (*api.TxnContext, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tc.Aborted {
+		s.aborts++
+		return tc, nil
+	}
+	if s.commitFailN > 0 {
+		s.commitFailN--
+		return nil, status.Error(codes.Unavailable, "stub: unavailable")
+	}
+	s.commits++
+	return tc, nil
+}
+
+func (s *stubAlpha) Query(_ context.Context, req *api.Request) (*api.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if s.failN > 0 {
+		s.failN--
+		return nil, status.Error(codes.Unavailable, "stub: unavailable")
+	}
+	resp := &api.Response{
+		Txn:     &api.TxnContext{StartTs: 1},
+		Latency: &api.Latency{ParsingNs: 1000, ProcessingNs: 2000, EncodingNs: 500, TotalNs: 3500},
+	}
+	if len(req.Mutations) == 0 {
+		resp.Json = s.json
+		return resp, nil
+	}
+	if s.abortN > 0 {
+		s.abortN--
+		return nil, status.Error(codes.Aborted, "stub: transaction has been aborted")
+	}
+	resp.Uids = map[string]string{}
+	for _, mu := range req.Mutations {
+		for _, name := range dquelytest.BlankNodes(mu) {
+			if _, ok := resp.Uids[name]; ok {
+				continue
+			}
+			s.nextUID++
+			resp.Uids[name] = fmt.Sprintf("0x%x", s.nextUID)
+		}
+	}
+	return resp, nil
+}
+
+// startStubAlpha serves a stubAlpha on a loopback port for the duration of the test.
+func startStubAlpha(t *testing.T, opts ...grpc.ServerOption) (*stubAlpha, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(opts...)
+	stub := &stubAlpha{srv: srv}
+	api.RegisterDgraphServer(srv, stub)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return stub, lis.Addr().String()
+}
+
+// testPKI is a throwaway certificate authority with a server and a client
+// certificate signed by it, written as PEM files into a temporary directory.
+type testPKI struct {
+	CAFile, ServerCert, ServerKey, ClientCert, ClientKey string
+	pool                                                 *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	keyDER := func(key *ecdsa.PrivateKey) []byte {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	caKey := newKey()
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dquely test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(serial int64, cn string, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key := newKey()
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			DNSNames:     []string{"localhost", "alpha.test"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+
+	pki := &testPKI{pool: x509.NewCertPool()}
+	pki.pool.AddCert(caCert)
+	pki.CAFile = write("ca.crt", "CERTIFICATE", caDER)
+	srvDER, srvKey := issue(2, "alpha", x509.ExtKeyUsageServerAuth)
+	pki.ServerCert = write("server.crt", "CERTIFICATE", srvDER)
+	pki.ServerKey = write("server.key", "EC PRIVATE KEY", keyDER(srvKey))
+	cliDER, cliKey := issue(3, "client", x509.ExtKeyUsageClientAuth)
+	pki.ClientCert = write("client.crt", "CERTIFICATE", cliDER)
+	pki.ClientKey = write("client.key", "EC PRIVATE KEY", keyDER(cliKey))
+	return pki
+}
+
+// serverCreds returns TLS server credentials; requireClient enables mutual TLS.
+func (p *testPKI) serverCreds(t *testing.T, requireClient bool) grpc.ServerOption {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(p.ServerCert, p.ServerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if requireClient {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = p.pool
+	}
+	return grpc.Creds(credentials.NewTLS(cfg))
+}
@@ -0,0 +1,556 @@
+package dquely_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/dgo/v250"
+	"github.com/vibros68/dquely"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+)
+
+// newTelemetryClient connects to a stub alpha with in-memory span and metric exporters.
+func newTelemetryClient(t *testing.T) (*dquely.Dgo, *stubAlpha, *tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	t.Helper()
+	stub, addr := startStubAlpha(t)
+	spans := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	client, err := dquely.NewClient(dquely.Config{
+		DNS:      addr,
+		Username: "groot",
+		Password: "password",
+		Telemetry: dquely.Telemetry{
+			TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)),
+			MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client, stub, spans, reader
+}
+
+func spanAttr(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTelemetryMutate(t *testing.T) {
+	client, _, spans, reader := newTelemetryClient(t)
+	ctx := context.Background()
+	user := &User{Name: "Alice", Age: 29}
+	if err := client.Mutate(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Uid == "" {
+		t.Fatalf("expected uid to be written back")
+	}
+	got := spans.GetSpans()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(got))
+	}
+	span := got[0]
+	if span.Name != "dquely.Mutate" {
+		t.Errorf("expected span name dquely.Mutate, got %s", span.Name)
+	}
+	if v, _ := spanAttr(span, dquely.AttrDgraphType); v.AsString() != "User" {
+		t.Errorf("expected dgraph.type User, got %q", v.AsString())
+	}
+	if v, _ := spanAttr(span, dquely.AttrMutationSize); v.AsInt64() == 0 {
+		t.Errorf("expected non-zero mutation size")
+	}
+	if v, _ := spanAttr(span, dquely.AttrServerLatency); v.AsInt64() != 3500 {
+		t.Errorf("expected server latency 3500, got %d", v.AsInt64())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "dquely.client.operations" {
+				continue
+			}
+			sum := m.Data.(metricdata.Sum[int64])
+			for _, dp := range sum.DataPoints {
+				if v, _ := dp.Attributes.Value(dquely.AttrStatus); v.AsString() == "ok" && dp.Value == 1 {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected dquely.client.operations to count one successful Mutate")
+	}
+}
+
+func TestTelemetryQuery(t *testing.T) {
+	client, stub, spans, _ := newTelemetryClient(t)
+	stub.json = []byte(`{"me":[{"uid":"0x1","name":"Alice"}]}`)
+	q := dquely.NewDQL("me").Func(dquely.Eq("name", "Alice")).Select("uid", "name")
+	user, err := dquely.Model[User](client).First(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Alice" {
+		t.Errorf("expected Alice, got %s", user.Name)
+	}
+	got := spans.GetSpans()
+	if len(got) != 1 || got[0].Name != "dquely.Query.First" {
+		t.Fatalf("expected a single dquely.Query.First span, got %v", got)
+	}
+	if v, _ := spanAttr(got[0], dquely.AttrBlock); v.AsString() != "me" {
+		t.Errorf("expected block me, got %q", v.AsString())
+	}
+}
+
+func TestTelemetryTxn(t *testing.T) {
+	client, stub, spans, _ := newTelemetryClient(t)
+	ctx := context.Background()
+	err := client.DoTxn(ctx, func(txn *dquely.Txn) error {
+		return txn.Mutate(ctx, &User{Name: "Bob"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.commits != 1 {
+		t.Errorf("expected 1 commit, got %d", stub.commits)
+	}
+	var names []string
+	for _, s := range spans.GetSpans() {
+		names = append(names, s.Name)
+	}
+	if len(names) != 2 || names[0] != "dquely.Txn.Mutate" || names[1] != "dquely.Txn.Commit" {
+		t.Errorf("expected Txn.Mutate and Txn.Commit spans, got %v", names)
+	}
+}
+
+func TestNewClientTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	_, addr := startStubAlpha(t, pki.serverCreds(t, false))
+	client, err := dquely.NewClient(dquely.Config{
+		DNS:      addr,
+		Username: "groot",
+		Password: "password",
+		TLS:      &dquely.TLSConfig{CAFile: pki.CAFile, ServerName: "alpha.test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func TestNewClientTLSUnknownCA(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newTestPKI(t)
+	_, addr := startStubAlpha(t, pki.serverCreds(t, false))
+	_, err := dquely.NewClient(dquely.Config{
+		DNS:      addr,
+		Username: "groot",
+		Password: "password",
+		TLS:      &dquely.TLSConfig{CAFile: other.CAFile},
+	})
+	if err == nil {
+		t.Fatal("expected handshake with an untrusted CA to fail")
+	}
+}
+
+func TestNewClientMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	_, addr := startStubAlpha(t, pki.serverCreds(t, true))
+	cfg := dquely.Config{
+		DNS:      addr,
+		Username: "groot",
+		Password: "password",
+		TLS:      &dquely.TLSConfig{CAFile: pki.CAFile},
+	}
+	if _, err := dquely.NewClient(cfg); err == nil {
+		t.Fatal("expected connection without a client certificate to fail")
+	}
+	cfg.TLS.CertFile = pki.ClientCert
+	cfg.TLS.KeyFile = pki.ClientKey
+	client, err := dquely.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func TestNewClientTLSCertWithoutKey(t *testing.T) {
+	pki := newTestPKI(t)
+	_, err := dquely.NewClient(dquely.Config{
+		DNS:      "127.0.0.1:1",
+		Username: "groot",
+		Password: "password",
+		TLS:      &dquely.TLSConfig{CAFile: pki.CAFile, CertFile: pki.ClientCert},
+	})
+	if err == nil {
+		t.Fatal("expected an error when cert_file is set without key_file")
+	}
+}
+
+func TestNewClientDialOptions(t *testing.T) {
+	_, addr := startStubAlpha(t)
+	var calls []string
+	interceptor := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		calls = append(calls, method)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	client, err := dquely.NewClient(dquely.Config{
+		DNS:         addr,
+		Username:    "groot",
+		Password:    "password",
+		DialOptions: []grpc.DialOption{grpc.WithUnaryInterceptor(interceptor)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if len(calls) == 0 {
+		t.Fatal("expected the custom dial option to intercept calls")
+	}
+}
+
+func TestNewClientMultiEndpoint(t *testing.T) {
+	var stubs []*stubAlpha
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		stub, addr := startStubAlpha(t)
+		stub.json = []byte(`{"me":[]}`)
+		stubs = append(stubs, stub)
+		addrs = append(addrs, addr)
+	}
+	client, err := dquely.NewClient(dquely.Config{
+		Endpoints:           addrs,
+		Username:            "groot",
+		Password:            "password",
+		HealthCheckInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+	q := dquely.NewDQL("me").Func(dquely.Uid("0x1")).Select("uid")
+
+	for i := 0; i < 6; i++ {
+		if _, err := dquely.Model[User](client).Find(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, stub := range stubs {
+		if stub.requestCount() == 0 {
+			t.Errorf("expected endpoint %d to receive requests", i)
+		}
+	}
+
+	// Take one endpoint down: requests fail over and the health check marks it.
+	stubs[1].srv.Stop()
+	for i := 0; i < 6; i++ {
+		if _, err := dquely.Model[User](client).Find(ctx, q); err != nil {
+			t.Fatalf("expected failover to a healthy endpoint, got %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st := client.Endpoints()
+		if !st[1].Healthy && st[0].Healthy && st[2].Healthy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected only endpoint 1 to be unhealthy, got %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewClientFailover(t *testing.T) {
+	down, downAddr := startStubAlpha(t)
+	up, upAddr := startStubAlpha(t)
+	up.json = []byte(`{"me":[{"uid":"0x1","name":"Alice"}]}`)
+	client, err := dquely.NewClient(dquely.Config{
+		Endpoints: []string{downAddr, upAddr},
+		Username:  "groot",
+		Password:  "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	down.mu.Lock()
+	down.failN = 100
+	down.mu.Unlock()
+	ctx := context.Background()
+	q := dquely.NewDQL("me").Func(dquely.Uid("0x1")).Select("uid", "name")
+
+	// Reads are repeated on the next endpoint.
+	before := up.requestCount()
+	for i := 0; i < 4; i++ {
+		if _, err := dquely.Model[User](client).ReadOnly().First(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := up.requestCount() - before; got != 4 {
+		t.Errorf("expected the healthy endpoint to serve all 4 queries, got %d", got)
+	}
+
+	// A mutation that fails is not resent, as the endpoint may have applied it.
+	for _, ep := range client.Endpoints() {
+		if ep.Addr == downAddr && ep.Healthy {
+			t.Fatal("expected the failing endpoint to be marked unhealthy")
+		}
+	}
+	down.mu.Lock()
+	down.failN = 0
+	down.mu.Unlock()
+	before = up.requestCount()
+	if err := client.Mutate(ctx, &User{Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := up.requestCount() - before; got != 1 {
+		t.Errorf("expected the mutation to go to the healthy endpoint, got %d requests", got)
+	}
+}
+
+func TestBalancerNoMutationFailover(t *testing.T) {
+	down, downAddr := startStubAlpha(t)
+	up, upAddr := startStubAlpha(t)
+	client, err := dquely.NewClient(dquely.Config{
+		Endpoints: []string{downAddr, upAddr},
+		Username:  "groot",
+		Password:  "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	down.mu.Lock()
+	down.failN = 100
+	down.mu.Unlock()
+	// Round-robin sends one of two mutations to the failing endpoint.
+	var failed int
+	before := up.requestCount()
+	for i := 0; i < 2; i++ {
+		if err := client.Mutate(context.Background(), &User{Name: "Alice"}); err != nil {
+			if !strings.Contains(err.Error(), "stub: unavailable") {
+				t.Errorf("expected the endpoint's error, got %v", err)
+			}
+			failed++
+		}
+	}
+	if got := up.requestCount() - before; failed != 1 || got != 1 {
+		t.Errorf("expected one failed and one served mutation, got %d failed and %d served", failed, got)
+	}
+}
+
+func newRetryClient(t *testing.T, policy dquely.RetryPolicy) (*dquely.Dgo, *stubAlpha) {
+	t.Helper()
+	stub, addr := startStubAlpha(t)
+	client, err := dquely.NewClient(dquely.Config{
+		DNS:      addr,
+		Username: "groot",
+		Password: "password",
+		Retry:    policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client, stub
+}
+
+func TestRetryMutateAborted(t *testing.T) {
+	var events []dquely.RetryEvent
+	client, stub := newRetryClient(t, dquely.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Jitter:         0.5,
+		OnRetry:        func(e dquely.RetryEvent) { events = append(events, e) },
+	})
+	stub.abortN = 2
+	user := &User{Name: "Alice"}
+	if err := client.Mutate(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Uid == "" {
+		t.Errorf("expected uid to be written back after retries")
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 retries, got %d", len(events))
+	}
+	if events[0].Operation != "Mutate" || events[0].Attempt != 1 || !errors.Is(events[0].Err, dgo.ErrAborted) {
+		t.Errorf("unexpected first retry event: %+v", events[0])
+	}
+}
+
+func TestRetryUpdateExhausted(t *testing.T) {
+	client, stub := newRetryClient(t, dquely.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	stub.abortN = 5
+	err := client.Update(context.Background(), &User{Uid: "0x1", Name: "Alice"}, dquely.FieldAll)
+	if !errors.Is(err, dgo.ErrAborted) {
+		t.Fatalf("expected dgo.ErrAborted, got %v", err)
+	}
+	if got := stub.requestCount(); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+}
+
+func TestRetryDoTxn(t *testing.T) {
+	client, stub := newRetryClient(t, dquely.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	stub.abortN = 1
+	calls := 0
+	err := client.DoTxn(context.Background(), func(txn *dquely.Txn) error {
+		calls++
+		return txn.Mutate(context.Background(), &User{Name: "Bob"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected fn to run twice, got %d", calls)
+	}
+	if stub.commits != 1 {
+		t.Errorf("expected 1 commit, got %d", stub.commits)
+	}
+}
+
+func TestRetryCommitNowUnavailable(t *testing.T) {
+	client, stub := newRetryClient(t, dquely.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	// The commit may have gone through: Mutate does not send it again.
+	stub.failN = 1
+	if err := client.Mutate(context.Background(), &User{Name: "Alice"}); err == nil {
+		t.Fatal("expected the unavailable error")
+	}
+	if got := stub.requestCount(); got != 1 {
+		t.Errorf("expected a single attempt, got %d", got)
+	}
+
+	// DoTxn re-runs the whole transaction, which had not committed.
+	stub.failN = 1
+	calls := 0
+	err := client.DoTxn(context.Background(), func(txn *dquely.Txn) error {
+		calls++
+		return txn.Mutate(context.Background(), &User{Name: "Bob"})
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected DoTxn to retry once, got %d calls and %v", calls, err)
+	}
+
+	// A commit that failed may have been applied: DoTxn does not run fn again.
+	stub.commitFailN = 1
+	calls = 0
+	err = client.DoTxn(context.Background(), func(txn *dquely.Txn) error {
+		calls++
+		return txn.Mutate(context.Background(), &User{Name: "Dan"})
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected a single DoTxn run and the commit error, got %d calls and %v", calls, err)
+	}
+
+	// An explicit classifier still applies.
+	client.Retry.Retryable = dquely.IsRetryable
+	stub.failN = 1
+	before := stub.requestCount()
+	if err := client.Mutate(context.Background(), &User{Name: "Carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stub.requestCount() - before; got != 2 {
+		t.Errorf("expected 2 attempts with IsRetryable, got %d", got)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	client, _ := newRetryClient(t, dquely.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond})
+	calls := 0
+	sentinel := errors.New("business rule violated")
+	err := client.DoTxn(context.Background(), func(txn *dquely.Txn) error {
+		calls++
+		return sentinel
+	})
+	if !errors.Is(err, sentinel) || calls != 1 {
+		t.Errorf("expected a single attempt returning the sentinel, got %d attempts and %v", calls, err)
+	}
+}
+
+func TestQueryReadOnly(t *testing.T) {
+	stub, addr := startStubAlpha(t)
+	stub.json = []byte(`{"me":[{"uid":"0x1","name":"Alice"}]}`)
+	client, err := dquely.NewClient(dquely.Config{DNS: addr, Username: "groot", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+	q := dquely.NewDQL("me").Func(dquely.Uid("0x1")).Select("uid", "name")
+
+	if _, err := dquely.Model[User](client).ReadOnly().Find(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dquely.Model[User](client).BestEffort().First(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dquely.Model[User](client).First(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ readOnly, bestEffort bool }{{true, false}, {true, true}, {false, false}}
+	for i, w := range want {
+		req := stub.requests[i]
+		if req.ReadOnly != w.readOnly || req.BestEffort != w.bestEffort {
+			t.Errorf("request %d: expected ReadOnly=%v BestEffort=%v, got %v %v",
+				i, w.readOnly, w.bestEffort, req.ReadOnly, req.BestEffort)
+		}
+	}
+}
+
+func TestQueryInTxn(t *testing.T) {
+	stub, addr := startStubAlpha(t)
+	stub.json = []byte(`{"me":[{"uid":"0x1","name":"Alice"}]}`)
+	client, err := dquely.NewClient(dquely.Config{DNS: addr, Username: "groot", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+	var found *User
+	err = client.DoTxn(ctx, func(txn *dquely.Txn) error {
+		user := &User{Name: "Alice"}
+		if err := txn.Mutate(ctx, user); err != nil {
+			return err
+		}
+		var err error
+		found, err = dquely.Model[User](client).InTxn(txn).
+			First(ctx, dquely.NewDQL("me").Func(dquely.Uid(user.Uid)).Select("uid", "name"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.Name != "Alice" {
+		t.Fatalf("expected to read Alice inside the transaction, got %+v", found)
+	}
+	if len(stub.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(stub.requests))
+	}
+	if stub.requests[1].StartTs != 1 {
+		t.Errorf("expected the query to reuse the transaction start ts, got %d", stub.requests[1].StartTs)
+	}
+	if stub.commits != 1 {
+		t.Errorf("expected 1 commit, got %d", stub.commits)
+	}
+}
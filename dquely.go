@@ -175,6 +175,7 @@ type DQuely struct {
 	inline       bool     // render nested select on one line: "name { field1 field2 }"
 	cascade      bool     // adds @cascade directive before @filter / {
 	groupBy      string   // adds @groupby(field) directive
+	directives   []string // other directives, pre-rendered: "@normalize", "@recurse(depth: 3)"
 	selects      []any
 	filters      []filter
 }
@@ -285,6 +286,36 @@ func (d *DQuely) Cascade() *DQuely {
 	return clone
 }
 
+// Directive adds any other directive, such as @normalize or @recurse(depth: 3), to
+// this block or nested select. args are rendered verbatim inside the parentheses.
+func (d *DQuely) Directive(name string, args ...string) *DQuely {
+	clone := d.getInstance()
+	clone.directives = append(append([]string{}, clone.directives...), renderDirective(name, args))
+	return clone
+}
+
+func renderDirective(name string, args []string) string {
+	if len(args) == 0 {
+		return "@" + name
+	}
+	return "@" + name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// directivesStr renders @cascade, @groupby and the other directives in that order.
+func (d *DQuely) directivesStr() string {
+	s := ""
+	if d.cascade {
+		s += " @cascade"
+	}
+	if d.groupBy != "" {
+		s += fmt.Sprintf(" @groupby(%s)", d.groupBy)
+	}
+	for _, dir := range d.directives {
+		s += " " + dir
+	}
+	return s
+}
+
 // Uid sets func: uid(...) as the root function.
 func (d *DQuely) Uid(values ...any) *DQuely {
 	return d.Func(Uid(values...))
@@ -446,14 +477,7 @@ func (d *DQuely) renderFields(sb *strings.Builder, indent string) {
 			if len(fieldArgs) > 0 {
 				fieldArgsStr = "(" + strings.Join(fieldArgs, ", ") + ")"
 			}
-			cascadeStr := ""
-			if v.cascade {
-				cascadeStr = " @cascade"
-			}
-			groupByStr := ""
-			if v.groupBy != "" {
-				groupByStr = fmt.Sprintf(" @groupby(%s)", v.groupBy)
-			}
+			dirStr := v.directivesStr()
 			if v.inline {
 				var parts []string
 				for _, s := range v.selects {
@@ -461,9 +485,9 @@ func (d *DQuely) renderFields(sb *strings.Builder, indent string) {
 						parts = append(parts, str)
 					}
 				}
-				sb.WriteString(indent + prefix + v.name + fieldArgsStr + cascadeStr + groupByStr + v.inlineFilter() + " { " + strings.Join(parts, " ") + " }\n")
+				sb.WriteString(indent + prefix + v.name + fieldArgsStr + dirStr + v.inlineFilter() + " { " + strings.Join(parts, " ") + " }\n")
 			} else {
-				sb.WriteString(indent + prefix + v.name + fieldArgsStr + cascadeStr + groupByStr + v.inlineFilter() + " {\n")
+				sb.WriteString(indent + prefix + v.name + fieldArgsStr + dirStr + v.inlineFilter() + " {\n")
 				v.renderFields(sb, indent+"  ")
 				sb.WriteString(indent + "}\n")
 			}
@@ -472,31 +496,17 @@ func (d *DQuely) renderFields(sb *strings.Builder, indent string) {
 }
 
 func (d *DQuely) renderCondition(sb *strings.Builder, blockName string) {
-	funcExpr := ""
-	for _, f := range d.filters {
-		if f.isFuncPart {
-			funcExpr = f.expr
-		}
-	}
-	funcPart := ""
-	if funcExpr != "" {
-		funcPart = "func: " + funcExpr
-	}
-	sb.WriteString(fmt.Sprintf("  %s as %s(%s)\n", d.condVar, blockName, funcPart))
+	sb.WriteString(fmt.Sprintf("  %s as %s(%s)%s%s\n", d.condVar, blockName, d.rootArgs(), d.directivesStr(), d.inlineFilter()))
 }
 
-func (d *DQuely) renderBlock(sb *strings.Builder, blockName string) {
-	// Separate func: filter from @filter expressions
+// rootArgs renders the arguments of a root block: func, ordering and pagination.
+func (d *DQuely) rootArgs() string {
 	funcExpr := ""
-	var atFilters []filter
 	for _, f := range d.filters {
 		if f.isFuncPart {
 			funcExpr = f.expr
-		} else {
-			atFilters = append(atFilters, f)
 		}
 	}
-
 	argsStr := ""
 	if funcExpr != "" {
 		argsStr = "func: " + funcExpr
@@ -520,33 +530,38 @@ func (d *DQuely) renderBlock(sb *strings.Builder, blockName string) {
 		}
 		argsStr += strings.Join(parts, ", ")
 	}
+	return argsStr
+}
+
+func (d *DQuely) renderBlock(sb *strings.Builder, blockName string) {
+	// Separate func: filter from @filter expressions
+	var atFilters []filter
+	for _, f := range d.filters {
+		if !f.isFuncPart {
+			atFilters = append(atFilters, f)
+		}
+	}
+	argsStr := d.rootArgs()
 
 	blockPrefix := ""
 	if d.blockVarName != "" {
 		blockPrefix = d.blockVarName + " as "
 	}
 
-	cascadeStr := ""
-	if d.cascade {
-		cascadeStr = " @cascade"
-	}
-	groupByStr := ""
-	if d.groupBy != "" {
-		groupByStr = fmt.Sprintf(" @groupby(%s)", d.groupBy)
-	}
+	dirStr := d.directivesStr()
 
 	switch {
 	case len(atFilters) == 0:
 		// No @filter
-		sb.WriteString(fmt.Sprintf("  %s%s(%s)%s%s {\n", blockPrefix, blockName, argsStr, cascadeStr, groupByStr))
+		sb.WriteString(fmt.Sprintf("  %s%s(%s)%s {\n", blockPrefix, blockName, argsStr, dirStr))
 
 	case len(atFilters) == 1 && len(atFilters[0].orExprs) == 0:
 		// Single simple filter → inline
-		sb.WriteString(fmt.Sprintf("  %s%s(%s)%s%s @filter(%s) {\n", blockPrefix, blockName, argsStr, cascadeStr, groupByStr, atFilters[0].expr))
+		sb.WriteString(fmt.Sprintf("  %s%s(%s)%s @filter(%s) {\n", blockPrefix, blockName, argsStr, dirStr, atFilters[0].expr))
 
 	default:
 		// Multiple filters → multiline
-		sb.WriteString(fmt.Sprintf("  %s%s(%s)%s%s\n", blockPrefix, blockName, argsStr, cascadeStr, groupByStr))
+		sb.WriteString(fmt.Sprintf("  %s%s(%s)%s\n", blockPrefix, blockName, argsStr, dirStr))
 		sb.WriteString("  @filter(\n")
 		for i, f := range atFilters {
 			prefix := ""
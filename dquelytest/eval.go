@@ -0,0 +1,990 @@
+package dquelytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+// object is a JSON object that keeps its keys in insertion order, as Dgraph does.
+type object struct {
+	keys []string
+	vals map[string]any
+}
+
+func newObject() *object {
+	return &object{vals: map[string]any{}}
+}
+
+func (o *object) set(key string, v any) {
+	if _, ok := o.vals[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.vals[key] = v
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(o.vals[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// env evaluates queries against a store and holds the variables they define.
+type env struct {
+	s       *store
+	uidVars map[string][]uint64
+	valVars map[string]map[uint64]value
+}
+
+func newEnv(s *store) *env {
+	return &env{s: s, uidVars: map[string][]uint64{}, valVars: map[string]map[uint64]value{}}
+}
+
+// run evaluates a query and returns the JSON response.
+func (e *env) run(query string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(query), "schema"); ok {
+		if strings.Join(strings.Fields(rest), "") != "{}" {
+			return nil, fmt.Errorf("%w: schema queries other than \"schema {}\"", errUnsupported)
+		}
+		return e.s.schema.schemaJSON()
+	}
+	doc, err := dql.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("dquelytest: %w", err)
+	}
+	order, err := schedule(doc.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	results := map[*dql.Block][]any{}
+	for _, b := range order {
+		res, err := e.block(b)
+		if err != nil {
+			return nil, err
+		}
+		results[b] = res
+	}
+	out := newObject()
+	for _, b := range doc.Blocks {
+		if b.Name == "var" {
+			continue
+		}
+		res := results[b]
+		if res == nil {
+			res = []any{}
+		}
+		out.set(b.Name, res)
+	}
+	return json.Marshal(out)
+}
+
+// schedule orders blocks so that every variable is defined before it is used.
+func schedule(blocks []*dql.Block) ([]*dql.Block, error) {
+	definedBy := map[string]bool{}
+	for _, b := range blocks {
+		for v := range blockDefs(b) {
+			definedBy[v] = true
+		}
+	}
+	var (
+		order   []*dql.Block
+		defined = map[string]bool{}
+		done    = map[*dql.Block]bool{}
+	)
+	for len(order) < len(blocks) {
+		progress := false
+		for _, b := range blocks {
+			if done[b] {
+				continue
+			}
+			own := blockDefs(b)
+			ready := true
+			for v := range blockUses(b) {
+				if !definedBy[v] {
+					return nil, fmt.Errorf("dquelytest: variable %s is used but not defined", v)
+				}
+				if !defined[v] && !own[v] {
+					ready = false
+				}
+			}
+			if !ready {
+				continue
+			}
+			done[b] = true
+			order = append(order, b)
+			for v := range own {
+				defined[v] = true
+			}
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("dquelytest: cyclic variable dependency between query blocks")
+		}
+	}
+	return order, nil
+}
+
+func blockDefs(b *dql.Block) map[string]bool {
+	defs := map[string]bool{}
+	if b.Var != "" {
+		defs[b.Var] = true
+	}
+	var walk func(fields []*dql.Field)
+	walk = func(fields []*dql.Field) {
+		for _, f := range fields {
+			if f.Var != "" {
+				defs[f.Var] = true
+			}
+			walk(f.Fields)
+		}
+	}
+	walk(b.Fields)
+	return defs
+}
+
+func blockUses(b *dql.Block) map[string]bool {
+	uses := map[string]bool{}
+	if b.Func != nil {
+		funcUses(b.Func, uses)
+	}
+	filterUses(b.Filter, uses)
+	argUses(b.Args, uses)
+	var walk func(fields []*dql.Field)
+	walk = func(fields []*dql.Field) {
+		for _, f := range fields {
+			if f.Func != nil {
+				funcUses(f.Func, uses)
+			}
+			filterUses(f.Filter, uses)
+			argUses(f.Args, uses)
+			walk(f.Fields)
+		}
+	}
+	walk(b.Fields)
+	return uses
+}
+
+func filterUses(f *dql.Filter, uses map[string]bool) {
+	if f == nil {
+		return
+	}
+	if f.Func != nil {
+		funcUses(f.Func, uses)
+	}
+	for _, a := range f.Args {
+		filterUses(a, uses)
+	}
+}
+
+func argUses(args []dql.Arg, uses map[string]bool) {
+	for _, a := range args {
+		valueUses(a.Value, uses)
+	}
+}
+
+// funcUses collects the variables referenced by uid(), val() and len() calls.
+func funcUses(fn *dql.Func, uses map[string]bool) {
+	switch fn.Name {
+	case "uid", "val", "len":
+		for _, a := range fn.Args {
+			if a.Kind == dql.Ident && !isUIDLiteral(a.Text) {
+				uses[a.Text] = true
+			}
+		}
+	}
+	for _, a := range fn.Args {
+		valueUses(a, uses)
+	}
+}
+
+func valueUses(v dql.Value, uses map[string]bool) {
+	switch v.Kind {
+	case dql.FuncCall:
+		funcUses(v.Func, uses)
+	case dql.List:
+		for _, item := range v.List {
+			valueUses(item, uses)
+		}
+	}
+}
+
+func isUIDLiteral(s string) bool {
+	_, err := parseUID(s)
+	return err == nil
+}
+
+// addUIDVar merges uids into the uid variable name.
+func (e *env) addUIDVar(name string, uids ...uint64) {
+	e.uidVars[name] = mergeUIDs(e.uidVars[name], uids)
+}
+
+func mergeUIDs(a, b []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(a)+len(b))
+	out := make([]uint64, 0, len(a)+len(b))
+	for _, list := range [][]uint64{a, b} {
+		for _, u := range list {
+			if !seen[u] {
+				seen[u] = true
+				out = append(out, u)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func (e *env) setValVar(name string, uid uint64, v value) {
+	m := e.valVars[name]
+	if m == nil {
+		m = map[uint64]value{}
+		e.valVars[name] = m
+	}
+	m[uid] = v
+}
+
+// block evaluates a top-level block and returns its result list.
+func (e *env) block(b *dql.Block) ([]any, error) {
+	if b.Func == nil {
+		return nil, fmt.Errorf("dquelytest: block %s has no root function", b.Name)
+	}
+	cascade, err := checkDirectives(b.Directives)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := e.root(b.Func)
+	if err != nil {
+		return nil, err
+	}
+	if uids, err = e.filter(uids, b.Filter); err != nil {
+		return nil, err
+	}
+	if uids, err = e.paginate(uids, b.Args); err != nil {
+		return nil, err
+	}
+	if b.Var != "" {
+		e.addUIDVar(b.Var, uids...)
+	}
+	out, err := e.objects(uids, b.Fields, cascade)
+	if err != nil {
+		return nil, err
+	}
+	e.defineUIDVars(b.Fields)
+	return out, nil
+}
+
+// defineUIDVars defines the uid variables of fields that matched no node, so that
+// they are empty rather than undefined, as in Dgraph.
+func (e *env) defineUIDVars(fields []*dql.Field) {
+	for _, f := range fields {
+		if f.Var != "" && (f.Name == "uid" || len(f.Fields) > 0) {
+			if _, ok := e.uidVars[f.Var]; !ok {
+				e.uidVars[f.Var] = nil
+			}
+		}
+		e.defineUIDVars(f.Fields)
+	}
+}
+
+// checkDirectives reports whether @cascade is present and rejects directives
+// Graph does not implement.
+func checkDirectives(dirs []dql.Directive) (cascade bool, err error) {
+	for _, d := range dirs {
+		switch d.Name {
+		case "cascade":
+			if len(d.Args) > 0 {
+				return false, fmt.Errorf("%w: @cascade with arguments", errUnsupported)
+			}
+			cascade = true
+		default:
+			return false, fmt.Errorf("%w: @%s", errUnsupported, d.Name)
+		}
+	}
+	return cascade, nil
+}
+
+// root evaluates a root function.
+func (e *env) root(fn *dql.Func) ([]uint64, error) {
+	if fn.Name == "uid" {
+		return e.uidArgs(fn.Args)
+	}
+	var out []uint64
+	for _, uid := range e.s.all() {
+		ok, err := e.test(uid, fn)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, uid)
+		}
+	}
+	return out, nil
+}
+
+// uidArgs resolves the arguments of uid(): literals and uid variables.
+func (e *env) uidArgs(args []dql.Value) ([]uint64, error) {
+	var out []uint64
+	for _, a := range args {
+		switch a.Kind {
+		case dql.Ident, dql.Number:
+			if u, err := parseUID(a.Text); err == nil {
+				out = mergeUIDs(out, []uint64{u})
+				continue
+			}
+			uids, ok := e.uidVars[a.Text]
+			if !ok {
+				if _, isVal := e.valVars[a.Text]; !isVal {
+					return nil, fmt.Errorf("dquelytest: variable %s is used but not defined", a.Text)
+				}
+				for u := range e.valVars[a.Text] {
+					uids = append(uids, u)
+				}
+			}
+			out = mergeUIDs(out, uids)
+		case dql.List:
+			uids, err := e.uidArgs(a.List)
+			if err != nil {
+				return nil, err
+			}
+			out = mergeUIDs(out, uids)
+		case dql.FuncCall:
+			if a.Func.Name != "uid" {
+				return nil, fmt.Errorf("dquelytest: unexpected %s in uid()", a.Func)
+			}
+			uids, err := e.uidArgs(a.Func.Args)
+			if err != nil {
+				return nil, err
+			}
+			out = mergeUIDs(out, uids)
+		default:
+			return nil, fmt.Errorf("dquelytest: invalid uid %s", a)
+		}
+	}
+	return out, nil
+}
+
+func (e *env) filter(uids []uint64, f *dql.Filter) ([]uint64, error) {
+	if f == nil {
+		return uids, nil
+	}
+	var out []uint64
+	for _, uid := range uids {
+		ok, err := e.match(uid, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, uid)
+		}
+	}
+	return out, nil
+}
+
+// match evaluates a filter tree for uid. Conditions of mutations are evaluated
+// with uid 0, where only len() comparisons are meaningful.
+func (e *env) match(uid uint64, f *dql.Filter) (bool, error) {
+	switch f.Op {
+	case dql.FilterFunc:
+		return e.test(uid, f.Func)
+	case dql.FilterNot:
+		ok, err := e.match(uid, f.Args[0])
+		return !ok, err
+	case dql.FilterAnd:
+		for _, a := range f.Args {
+			ok, err := e.match(uid, a)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		for _, a := range f.Args {
+			ok, err := e.match(uid, a)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// predValues returns the values of pred on uid; "~pred" follows the edge in reverse.
+// Language tags are accepted but ignored: values are stored without a language.
+func (e *env) predValues(uid uint64, pred string) []value {
+	pred = stripLang(pred)
+	if rev, ok := strings.CutPrefix(pred, "~"); ok {
+		from := e.s.reverse(uid, rev)
+		out := make([]value, len(from))
+		for i, u := range from {
+			out[i] = uidValue(u)
+		}
+		return out
+	}
+	return e.s.values(uid, pred)
+}
+
+func (e *env) test(uid uint64, fn *dql.Func) (bool, error) {
+	argErr := func() error {
+		return fmt.Errorf("dquelytest: invalid arguments to %s", fn)
+	}
+	switch fn.Name {
+	case "uid":
+		uids, err := e.uidArgs(fn.Args)
+		if err != nil {
+			return false, err
+		}
+		return containsUID(uids, uid), nil
+	case "type":
+		if len(fn.Args) != 1 {
+			return false, argErr()
+		}
+		for _, v := range e.s.values(uid, "dgraph.type") {
+			if v.text() == fn.Args[0].Text {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "has":
+		if len(fn.Args) != 1 || fn.Args[0].Kind != dql.Ident {
+			return false, argErr()
+		}
+		return len(e.predValues(uid, fn.Args[0].Text)) > 0, nil
+	case "eq", "gt", "ge", "lt", "le":
+		if len(fn.Args) != 2 {
+			return false, argErr()
+		}
+		left, err := e.operand(uid, fn.Args[0])
+		if err != nil {
+			return false, err
+		}
+		right, err := e.constants(uid, fn.Args[1])
+		if err != nil {
+			return false, err
+		}
+		for _, l := range left {
+			for _, r := range right {
+				c, ok := compare(l, r)
+				if ok && satisfies(fn.Name, c) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "between":
+		if len(fn.Args) != 3 {
+			return false, argErr()
+		}
+		left, err := e.operand(uid, fn.Args[0])
+		if err != nil {
+			return false, err
+		}
+		lo, hi := literal(fn.Args[1]), literal(fn.Args[2])
+		for _, l := range left {
+			c1, ok1 := compare(l, lo)
+			c2, ok2 := compare(l, hi)
+			if ok1 && ok2 && c1 >= 0 && c2 <= 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "regexp":
+		if len(fn.Args) != 2 || fn.Args[1].Kind != dql.Regex {
+			return false, argErr()
+		}
+		pattern := fn.Args[1].Text
+		if strings.Contains(fn.Args[1].Flags, "i") {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("dquelytest: %s: %w", fn, err)
+		}
+		for _, v := range e.predValues(uid, fn.Args[0].Text) {
+			if re.MatchString(v.text()) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "allofterms", "alloftext", "anyofterms", "anyoftext", "ngram":
+		if len(fn.Args) != 2 {
+			return false, argErr()
+		}
+		want := tokens(fn.Args[1].Text)
+		if len(want) == 0 {
+			return false, nil
+		}
+		all := fn.Name != "anyofterms" && fn.Name != "anyoftext"
+		for _, v := range e.predValues(uid, fn.Args[0].Text) {
+			text := strings.ToLower(v.text())
+			have := map[string]bool{}
+			for _, t := range tokens(text) {
+				have[t] = true
+			}
+			hits := 0
+			for _, w := range want {
+				if have[w] || (fn.Name == "ngram" && strings.Contains(text, w)) {
+					hits++
+				}
+			}
+			if (all && hits == len(want)) || (!all && hits > 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "uid_in":
+		if len(fn.Args) != 2 {
+			return false, argErr()
+		}
+		targets, err := e.uidArgs(fn.Args[1:])
+		if err != nil {
+			return false, err
+		}
+		for _, v := range e.predValues(uid, fn.Args[0].Text) {
+			if containsUID(targets, v.uid()) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: function %s", errUnsupported, fn.Name)
+}
+
+func satisfies(op string, c int) bool {
+	switch op {
+	case "eq":
+		return c == 0
+	case "gt":
+		return c > 0
+	case "ge":
+		return c >= 0
+	case "lt":
+		return c < 0
+	default:
+		return c <= 0
+	}
+}
+
+func containsUID(uids []uint64, uid uint64) bool {
+	for _, u := range uids {
+		if u == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// literal converts a constant argument to an untyped value.
+func literal(v dql.Value) value {
+	return value{typ: typeDefault, v: v.Text}
+}
+
+// operand resolves the left operand of a comparison for uid: the values of a
+// predicate, count(pred), val(var) or len(var).
+func (e *env) operand(uid uint64, v dql.Value) ([]value, error) {
+	switch v.Kind {
+	case dql.Ident:
+		return e.predValues(uid, v.Text), nil
+	case dql.FuncCall:
+		fn := v.Func
+		if len(fn.Args) != 1 {
+			return nil, fmt.Errorf("dquelytest: invalid arguments to %s", fn)
+		}
+		name := fn.Args[0].Text
+		switch fn.Name {
+		case "count":
+			return []value{{typ: typeInt, v: int64(len(e.predValues(uid, name)))}}, nil
+		case "val":
+			if val, ok := e.valVars[name][uid]; ok {
+				return []value{val}, nil
+			}
+			return nil, nil
+		case "len":
+			uids, ok := e.uidVars[name]
+			if !ok {
+				if _, isVal := e.valVars[name]; !isVal {
+					return nil, fmt.Errorf("dquelytest: variable %s is used but not defined", name)
+				}
+				uids = make([]uint64, len(e.valVars[name]))
+			}
+			return []value{{typ: typeInt, v: int64(len(uids))}}, nil
+		}
+		return nil, fmt.Errorf("%w: %s as an operand", errUnsupported, fn)
+	}
+	return nil, fmt.Errorf("dquelytest: expected a predicate, found %s", v)
+}
+
+// constants resolves the right operand of a comparison: a constant, a list of
+// constants, or val(var) for uid.
+func (e *env) constants(uid uint64, v dql.Value) ([]value, error) {
+	switch v.Kind {
+	case dql.List:
+		out := make([]value, 0, len(v.List))
+		for _, item := range v.List {
+			out = append(out, literal(item))
+		}
+		return out, nil
+	case dql.FuncCall:
+		return e.operand(uid, v)
+	}
+	return []value{literal(v)}, nil
+}
+
+// paginate applies ordering and the first, offset and after arguments.
+func (e *env) paginate(uids []uint64, args []dql.Arg) ([]uint64, error) {
+	var (
+		orders        []dql.Arg
+		first, offset int
+		hasFirst      bool
+		after         uint64
+	)
+	for _, a := range args {
+		switch a.Name {
+		case "orderasc", "orderdesc":
+			orders = append(orders, a)
+		case "first", "offset":
+			n, err := strconv.Atoi(a.Value.Text)
+			if err != nil {
+				return nil, fmt.Errorf("dquelytest: invalid %s: %s", a.Name, a.Value)
+			}
+			if a.Name == "first" {
+				first, hasFirst = n, true
+			} else {
+				offset = n
+			}
+		case "after":
+			u, err := parseUID(a.Value.Text)
+			if err != nil {
+				return nil, fmt.Errorf("dquelytest: invalid after: %s", a.Value)
+			}
+			after = u
+		default:
+			return nil, fmt.Errorf("%w: argument %s", errUnsupported, a.Name)
+		}
+	}
+	out := append([]uint64(nil), uids...)
+	if len(orders) > 0 {
+		keys := make(map[uint64][]value, len(out))
+		for _, u := range out {
+			for _, o := range orders {
+				vals, err := e.orderKey(u, o.Value)
+				if err != nil {
+					return nil, err
+				}
+				var k value
+				if len(vals) > 0 {
+					k = vals[0]
+				}
+				keys[u] = append(keys[u], k)
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool {
+			for n, o := range orders {
+				a, b := keys[out[i]][n], keys[out[j]][n]
+				switch {
+				case a.v == nil && b.v == nil:
+					continue
+				case a.v == nil:
+					return false
+				case b.v == nil:
+					return true
+				}
+				c, _ := compare(a, b)
+				if c == 0 {
+					continue
+				}
+				if o.Name == "orderdesc" {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if after != 0 {
+		kept := out[:0]
+		for _, u := range out {
+			if u > after {
+				kept = append(kept, u)
+			}
+		}
+		out = kept
+	}
+	if offset > 0 {
+		if offset >= len(out) {
+			return nil, nil
+		}
+		out = out[offset:]
+	}
+	if hasFirst {
+		switch {
+		case first >= 0 && first < len(out):
+			out = out[:first]
+		case first < 0 && -first < len(out):
+			out = out[len(out)+first:]
+		}
+	}
+	return out, nil
+}
+
+func (e *env) orderKey(uid uint64, v dql.Value) ([]value, error) {
+	if v.Kind == dql.FuncCall {
+		return e.operand(uid, v)
+	}
+	return e.predValues(uid, v.Text), nil
+}
+
+// stripLang removes a language tag such as "@en" from pred.
+func stripLang(pred string) string {
+	if i := strings.IndexByte(pred, '@'); i > 0 {
+		return pred[:i]
+	}
+	return pred
+}
+
+// isEdge reports whether pred holds uid edges.
+func (e *env) isEdge(pred string, vals []value) bool {
+	pred = stripLang(pred)
+	if strings.HasPrefix(pred, "~") {
+		return true
+	}
+	if p := e.s.schema.pred(pred); p != nil {
+		return p.typ == typeUID
+	}
+	return len(vals) > 0 && vals[0].typ == typeUID
+}
+
+// isList reports whether pred renders as a JSON array.
+func (e *env) isList(pred string) bool {
+	pred = stripLang(pred)
+	if strings.HasPrefix(pred, "~") {
+		return true
+	}
+	if p := e.s.schema.pred(pred); p != nil {
+		return p.list
+	}
+	return false
+}
+
+// objects renders the selection for each uid, dropping empty objects and, with
+// cascade, objects missing a selected field.
+func (e *env) objects(uids []uint64, fields []*dql.Field, cascade bool) ([]any, error) {
+	out := make([]any, 0, len(uids))
+	var countKey string
+	for _, f := range fields {
+		if f.Func != nil && f.Func.Name == "count" && len(f.Func.Args) == 1 && f.Func.Args[0].Text == "uid" {
+			countKey = f.Alias
+			if countKey == "" {
+				countKey = "count"
+			}
+		}
+	}
+	for _, uid := range uids {
+		obj, complete, err := e.object(uid, fields, cascade)
+		if err != nil {
+			return nil, err
+		}
+		if len(obj.keys) == 0 || (cascade && !complete) {
+			continue
+		}
+		out = append(out, obj)
+	}
+	if countKey != "" {
+		c := newObject()
+		c.set(countKey, len(uids))
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// object renders fields for a single node. complete is false when a selected
+// predicate has no value.
+func (e *env) object(uid uint64, fields []*dql.Field, cascade bool) (*object, bool, error) {
+	obj := newObject()
+	complete := true
+	for _, f := range fields {
+		fieldCascade, err := checkDirectives(f.Directives)
+		if err != nil {
+			return nil, false, err
+		}
+		if f.Func != nil {
+			ok, err := e.funcField(obj, uid, f, cascade || fieldCascade)
+			if err != nil {
+				return nil, false, err
+			}
+			complete = complete && ok
+			continue
+		}
+		if f.Name == "uid" {
+			obj.set(f.Key(), formatUID(uid))
+			if f.Var != "" {
+				e.addUIDVar(f.Var, uid)
+			}
+			continue
+		}
+		ok, err := e.predField(obj, uid, f, f.Name, f.Key(), cascade || fieldCascade)
+		if err != nil {
+			return nil, false, err
+		}
+		complete = complete && ok
+	}
+	return obj, complete, nil
+}
+
+// predField renders the predicate pred of uid under key.
+func (e *env) predField(obj *object, uid uint64, f *dql.Field, pred, key string, cascade bool) (bool, error) {
+	vals := e.predValues(uid, pred)
+	if !e.isEdge(pred, vals) {
+		if len(vals) == 0 {
+			return false, nil
+		}
+		if f != nil && f.Var != "" {
+			e.setValVar(f.Var, uid, vals[0])
+		}
+		if e.isList(pred) {
+			list := make([]any, len(vals))
+			for i, v := range vals {
+				list[i] = v.json()
+			}
+			obj.set(key, list)
+		} else {
+			obj.set(key, vals[0].json())
+		}
+		return true, nil
+	}
+
+	children := make([]uint64, 0, len(vals))
+	for _, v := range vals {
+		children = append(children, v.uid())
+	}
+	var (
+		sub []*dql.Field
+		err error
+	)
+	if f != nil {
+		if children, err = e.filter(children, f.Filter); err != nil {
+			return false, err
+		}
+		if children, err = e.paginate(children, f.Args); err != nil {
+			return false, err
+		}
+		if f.Var != "" {
+			e.addUIDVar(f.Var, children...)
+		}
+		sub = f.Fields
+	}
+	if len(sub) == 0 {
+		sub = []*dql.Field{{Name: "uid"}}
+	}
+	objs, err := e.objects(children, sub, cascade)
+	if err != nil {
+		return false, err
+	}
+	if len(objs) == 0 {
+		return false, nil
+	}
+	if e.isList(pred) || e.s.schema.pred(pred) == nil {
+		obj.set(key, objs)
+	} else {
+		obj.set(key, objs[0])
+	}
+	return true, nil
+}
+
+// funcField renders count(), val() and expand() selections.
+func (e *env) funcField(obj *object, uid uint64, f *dql.Field, cascade bool) (bool, error) {
+	fn := f.Func
+	if len(fn.Args) != 1 {
+		return false, fmt.Errorf("dquelytest: invalid arguments to %s", fn)
+	}
+	arg := fn.Args[0].Text
+	switch fn.Name {
+	case "count":
+		if arg == "uid" {
+			return true, nil // rendered once per block by objects
+		}
+		vals := e.predValues(uid, arg)
+		n := int64(len(vals))
+		if fn.Filter != nil {
+			uids := make([]uint64, 0, len(vals))
+			for _, v := range vals {
+				if v.typ == typeUID {
+					uids = append(uids, v.v.(uint64))
+				}
+			}
+			matched, err := e.filter(uids, fn.Filter)
+			if err != nil {
+				return false, err
+			}
+			n = int64(len(matched))
+		}
+		if f.Var != "" {
+			e.setValVar(f.Var, uid, value{typ: typeInt, v: n})
+		}
+		obj.set(f.Key(), n)
+		return true, nil
+	case "val":
+		v, ok := e.valVars[arg][uid]
+		if !ok {
+			if _, defined := e.valVars[arg]; !defined {
+				if _, isUID := e.uidVars[arg]; !isUID {
+					return false, fmt.Errorf("dquelytest: variable %s is used but not defined", arg)
+				}
+			}
+			return false, nil
+		}
+		if f.Var != "" {
+			e.setValVar(f.Var, uid, v)
+		}
+		obj.set(f.Key(), v.json())
+		return true, nil
+	case "expand":
+		var preds []string
+		if arg == "_all_" {
+			var types []string
+			for _, v := range e.s.values(uid, "dgraph.type") {
+				types = append(types, v.text())
+			}
+			preds = e.s.schema.fieldsOf(types)
+			if len(preds) == 0 {
+				for p := range e.s.nodes[uid] {
+					if p != "dgraph.type" {
+						preds = append(preds, p)
+					}
+				}
+				sort.Strings(preds)
+			}
+		} else {
+			preds = e.s.schema.fieldsOf([]string{arg})
+		}
+		for _, p := range preds {
+			sub := &dql.Field{Name: p, Fields: f.Fields}
+			if _, err := e.predField(obj, uid, sub, p, p, cascade); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("%w: %s in a selection", errUnsupported, fn)
+}
@@ -0,0 +1,339 @@
+// Package dquelytest provides test doubles for code built on dquely.
+//
+// Fake is a dquely.Backend that never talks to Dgraph: it records every request,
+// answers with scripted responses, and assigns uids to blank nodes so Mutate can
+// write them back. Pair it with a client via NewClient:
+//
+//	client, fake := dquelytest.NewClient()
+//	fake.RespondJSON(`{"users":[{"uid":"0x1","name":"Alice"}]}`)
+//	user, err := dquely.Model[User](client).First(ctx, filter)
+package dquelytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v250"
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely"
+)
+
+var (
+	blankNodeSubject = regexp.MustCompile(`(?m)^\s*_:([^\s]+) `)
+	blankNodeJSON    = regexp.MustCompile(`"uid"\s*:\s*"_:([^"]+)"`)
+)
+
+// BlankNodes returns the names, without "_:", of the blank nodes mu sets, in order of
+// first appearance: the subjects of its SetNquads and the "_:x" uids of its SetJson.
+// Fake assigns a uid to each; other test backends can use it to do the same.
+func BlankNodes(mu *api.Mutation) []string {
+	var names []string
+	seen := map[string]bool{}
+	matches := blankNodeSubject.FindAllStringSubmatch(string(mu.SetNquads), -1)
+	matches = append(matches, blankNodeJSON.FindAllStringSubmatch(string(mu.SetJson), -1)...)
+	for _, m := range matches {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// response is a scripted answer to the next request.
+type response struct {
+	resp *api.Response
+	err  error
+}
+
+// Fake is an in-memory dquely.Backend. It is safe for concurrent use.
+//
+// Requests are answered from the queue filled by Respond, RespondJSON, RespondUids,
+// Abort and Fail, in order. Once the queue is empty, queries get an empty JSON
+// object and mutations get a fresh uid for every blank node they set.
+type Fake struct {
+	mu        sync.Mutex
+	requests  []*api.Request
+	schemas   []string
+	responses []response
+	commits   int
+	discards  int
+	nextUID   int
+	closed    bool
+}
+
+var _ dquely.Backend = (*Fake)(nil)
+
+// New returns an empty Fake.
+func New() *Fake {
+	return &Fake{}
+}
+
+// NewClient returns a client backed by a new Fake.
+func NewClient() (*dquely.Dgo, *Fake) {
+	f := New()
+	return dquely.NewClientWithBackend(f), f
+}
+
+// Respond queues resp as the answer to the next request.
+func (f *Fake) Respond(resp *api.Response) *Fake {
+	return f.push(response{resp: resp})
+}
+
+// RespondJSON queues a query response. v is used as is when it is a string or a
+// []byte and encoded with encoding/json otherwise.
+func (f *Fake) RespondJSON(v any) *Fake {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			panic(fmt.Sprintf("dquelytest: encode response: %v", err))
+		}
+	}
+	return f.Respond(&api.Response{Json: b})
+}
+
+// RespondUids queues a mutation response assigning the given uids, keyed by
+// blank-node name. An empty map makes a conditional mutation look like it did not fire.
+func (f *Fake) RespondUids(uids map[string]string) *Fake {
+	return f.Respond(&api.Response{Uids: uids})
+}
+
+// Abort makes the next request fail with dgo.ErrAborted, as if the transaction
+// conflicted with another one.
+func (f *Fake) Abort() *Fake {
+	return f.Fail(dgo.ErrAborted)
+}
+
+// Fail makes the next request fail with err.
+func (f *Fake) Fail(err error) *Fake {
+	return f.push(response{err: err})
+}
+
+func (f *Fake) push(r response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, r)
+	return f
+}
+
+// Requests returns every request received so far, oldest first.
+func (f *Fake) Requests() []*api.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*api.Request(nil), f.requests...)
+}
+
+// LastRequest returns the most recent request, or nil if there was none.
+func (f *Fake) LastRequest() *api.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		return nil
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+// Queries returns the query of every request received so far.
+func (f *Fake) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, len(f.requests))
+	for i, req := range f.requests {
+		out[i] = req.Query
+	}
+	return out
+}
+
+// SetNquads returns the N-Quads set by every request received so far, one entry
+// per request with the mutations of a request joined by newlines.
+func (f *Fake) SetNquads() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, len(f.requests))
+	for i, req := range f.requests {
+		out[i] = setNquads(req)
+	}
+	return out
+}
+
+// Schemas returns the schema of every Alter operation received so far.
+func (f *Fake) Schemas() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.schemas...)
+}
+
+// Commits returns the number of committed transactions, including requests sent
+// with CommitNow.
+func (f *Fake) Commits() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commits
+}
+
+// Discards returns the number of transactions discarded before being committed.
+func (f *Fake) Discards() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.discards
+}
+
+// Closed reports whether Close was called.
+func (f *Fake) Closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// AssertNquads fails the test unless the last request set exactly want.
+func (f *Fake) AssertNquads(t testing.TB, want string) {
+	t.Helper()
+	req := f.LastRequest()
+	if req == nil {
+		t.Fatalf("dquelytest: no request received, want N-Quads:\n%s", want)
+	}
+	if got := setNquads(req); strings.TrimSpace(got) != strings.TrimSpace(want) {
+		t.Errorf("dquelytest: unexpected N-Quads\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// AssertQuery fails the test unless the query of the last request is exactly want.
+func (f *Fake) AssertQuery(t testing.TB, want string) {
+	t.Helper()
+	req := f.LastRequest()
+	if req == nil {
+		t.Fatalf("dquelytest: no request received, want query:\n%s", want)
+	}
+	if got := req.Query; strings.TrimSpace(got) != strings.TrimSpace(want) {
+		t.Errorf("dquelytest: unexpected query\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// NewTxn implements dquely.Backend.
+func (f *Fake) NewTxn(opts dquely.TxnOptions) dquely.TxnBackend {
+	return &fakeTxn{f: f, readOnly: opts.ReadOnly}
+}
+
+// Alter implements dquely.Backend.
+func (f *Fake) Alter(_ context.Context, op *api.Operation) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schemas = append(f.schemas, op.Schema)
+	return nil
+}
+
+// Close implements dquely.Backend.
+func (f *Fake) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+}
+
+// do records req and returns the next scripted or default response.
+func (f *Fake) do(req *api.Request) (*api.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if len(f.responses) > 0 {
+		r := f.responses[0]
+		f.responses = f.responses[1:]
+		return r.resp, r.err
+	}
+	if len(req.Mutations) == 0 {
+		return &api.Response{Json: []byte("{}")}, nil
+	}
+	uids := map[string]string{}
+	for _, mu := range req.Mutations {
+		for _, name := range BlankNodes(mu) {
+			if _, ok := uids[name]; ok {
+				continue
+			}
+			f.nextUID++
+			uids[name] = fmt.Sprintf("0x%x", f.nextUID)
+		}
+	}
+	return &api.Response{Uids: uids}, nil
+}
+
+// fakeTxn mirrors the state checks of a dgo transaction.
+type fakeTxn struct {
+	f        *Fake
+	readOnly bool
+	finished bool
+	mutated  bool
+}
+
+func (t *fakeTxn) Do(_ context.Context, req *api.Request) (*api.Response, error) {
+	if t.finished {
+		return nil, dgo.ErrFinished
+	}
+	if len(req.Mutations) > 0 {
+		if t.readOnly {
+			return nil, dgo.ErrReadOnly
+		}
+		t.mutated = true
+	}
+	if req.CommitNow {
+		t.finished = true
+	}
+	resp, err := t.f.do(req)
+	if err != nil {
+		if t.mutated {
+			_ = t.Discard(context.Background())
+		}
+		return nil, err
+	}
+	if req.CommitNow {
+		t.f.mu.Lock()
+		t.f.commits++
+		t.f.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *fakeTxn) Commit(context.Context) error {
+	if t.readOnly {
+		return dgo.ErrReadOnly
+	}
+	if t.finished {
+		return dgo.ErrFinished
+	}
+	t.finished = true
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.commits++
+	return nil
+}
+
+func (t *fakeTxn) Discard(context.Context) error {
+	if t.finished {
+		return nil
+	}
+	t.finished = true
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.discards++
+	return nil
+}
+
+// setNquads joins the N-Quads set by the mutations of req.
+func setNquads(req *api.Request) string {
+	parts := make([]string, 0, len(req.Mutations))
+	for _, mu := range req.Mutations {
+		if len(mu.SetNquads) > 0 {
+			parts = append(parts, string(mu.SetNquads))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,257 @@
+package dquelytest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v250"
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely"
+	"github.com/vibros68/dquely/dquelytest"
+)
+
+type User struct {
+	Uid   string `dquely:"uid" json:"uid"`
+	Name  string `dquely:"name" json:"name"`
+	Email string `dquely:"email,unique" json:"email"`
+}
+
+const userNquadsMock = `_:user <name> "Alice" .
+_:user <email> "alice@example.com" .
+_:user <dgraph.type> "User" .`
+
+const userUniqueQueryMock = `{
+  v as var(func: type(User))
+    @filter(eq(email, "alice@example.com"))
+
+  duplicates(func: uid(v)) {
+    uid
+    email
+  }
+}`
+
+const usersQueryMock = `{
+  users(func: eq(email, "alice@example.com")) {
+    uid
+    name
+    email
+  }
+}`
+
+func TestFakeMutate(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := client.Mutate(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Uid != "0x1" {
+		t.Errorf("expected uid 0x1, got %q", user.Uid)
+	}
+	fake.AssertQuery(t, userUniqueQueryMock)
+	fake.AssertNquads(t, userNquadsMock)
+	if fake.Commits() != 1 {
+		t.Errorf("expected 1 commit, got %d", fake.Commits())
+	}
+}
+
+func TestFakeMutateJSON(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	client.Encoding = dquely.EncodingJSON
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := client.Mutate(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Uid != "0x1" {
+		t.Errorf("expected uid 0x1, got %q", user.Uid)
+	}
+	want := `{"uid":"_:user","name":"Alice","email":"alice@example.com","dgraph.type":"User"}`
+	if got := string(fake.LastRequest().Mutations[0].SetJson); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestBlankNodes(t *testing.T) {
+	mu := &api.Mutation{
+		SetNquads: []byte("_:a <name> \"x _:b \" .\n  _:c <friend> _:a .\n<0x1> <friend> _:c ."),
+		SetJson:   []byte(`{"uid":"_:d","friend":{"uid": "_:a"}}`),
+	}
+	if got := strings.Join(dquelytest.BlankNodes(mu), " "); got != "a c d" {
+		t.Errorf("expected a c d, got %s", got)
+	}
+}
+
+func TestFakeMutateDuplicate(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	fake.RespondUids(map[string]string{})
+	err := client.Mutate(context.Background(), &User{Name: "Alice", Email: "alice@example.com"})
+	if err == nil {
+		t.Fatal("expected a duplicate error")
+	}
+}
+
+func TestFakeAbortRetry(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	client.Retry = dquely.RetryPolicy{MaxAttempts: 3, InitialBackoff: 1}
+	fake.Abort()
+	if err := client.Mutate(context.Background(), &User{Name: "Alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Requests()); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestFakeFail(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	boom := errors.New("boom")
+	fake.Fail(boom)
+	err := client.Update(context.Background(), &User{Uid: "0x1", Name: "Alice"}, "name")
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+}
+
+func TestFakeQuery(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	fake.RespondJSON(map[string][]User{"users": {{Uid: "0x1", Name: "Alice", Email: "alice@example.com"}}})
+	q := dquely.NewDQL("users").Func(dquely.Eq("email", "alice@example.com")).Select("uid", "name", "email")
+	user, err := dquely.Model[User](client).ReadOnly().First(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Uid != "0x1" || user.Name != "Alice" {
+		t.Errorf("unexpected user %+v", user)
+	}
+	fake.AssertQuery(t, usersQueryMock)
+	if !fake.LastRequest().ReadOnly {
+		t.Error("expected a read-only request")
+	}
+}
+
+func TestFakeDoTxn(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	err := client.DoTxn(context.Background(), func(txn *dquely.Txn) error {
+		return txn.Mutate(context.Background(), &User{Name: "Alice", Email: "alice@example.com"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.Commits() != 1 || fake.Discards() != 0 {
+		t.Errorf("expected 1 commit and 0 discards, got %d and %d", fake.Commits(), fake.Discards())
+	}
+
+	err = client.DoTxn(context.Background(), func(txn *dquely.Txn) error {
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if fake.Discards() != 1 {
+		t.Errorf("expected 1 discard, got %d", fake.Discards())
+	}
+}
+
+func TestFakeTxnReadOnly(t *testing.T) {
+	fake := dquelytest.New()
+	txn := fake.NewTxn(dquely.TxnOptions{ReadOnly: true})
+	_, err := txn.Do(context.Background(), &api.Request{Mutations: []*api.Mutation{{SetNquads: []byte(userNquadsMock)}}})
+	if !errors.Is(err, dgo.ErrReadOnly) {
+		t.Fatalf("expected %v, got %v", dgo.ErrReadOnly, err)
+	}
+}
+
+func TestFakeSetSchema(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	if err := client.SetSchema(context.Background(), "name: string ."); err != nil {
+		t.Fatal(err)
+	}
+	if s := fake.Schemas(); len(s) != 1 || s[0] != "name: string ." {
+		t.Errorf("unexpected schemas %q", s)
+	}
+	client.Close()
+	if !fake.Closed() {
+		t.Error("expected the fake to be closed")
+	}
+}
+
+func TestFakeClient(t *testing.T) {
+	ctx := context.Background()
+	client, fake := dquelytest.NewClient()
+	var c dquely.Client = client
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+	if created, err := c.Upsert(ctx, user, dquely.OnConflictIgnore); err != nil || !created || user.Uid != "0x1" {
+		t.Fatalf("expected Alice to be created as 0x1, got %v, %v and %q", created, err, user.Uid)
+	}
+	users := []*User{{Name: "Bob", Email: "bob@example.com"}, {Name: "Carol", Email: "carol@example.com"}}
+	if err := c.MutateMany(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+	if users[0].Uid == "" || users[1].Uid == "" || len(fake.Requests()) != 2 {
+		t.Errorf("expected one request writing both users, got %q, %q and %d requests", users[0].Uid, users[1].Uid, len(fake.Requests()))
+	}
+	s, err := c.SchemaOf(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Predicates["email"]; p == nil || !p.Upsert {
+		t.Errorf("expected an upsert email predicate, got %+v", p)
+	}
+}
+
+func TestFakeBulkWriterSplit(t *testing.T) {
+	client, fake := dquelytest.NewClient()
+	// The first batch of four keeps conflicting, so it is written as two halves.
+	fake.Abort()
+	w := client.NewBulkWriter(context.Background(), dquely.BulkOptions{
+		BatchSize:   4,
+		Concurrency: 1,
+		Retry:       dquely.RetryPolicy{MaxAttempts: 1},
+	})
+	done := make(chan []dquely.BulkEvent)
+	go func() {
+		var events []dquely.BulkEvent
+		for ev := range w.Events() {
+			events = append(events, ev)
+		}
+		done <- events
+	}()
+	users := []*User{
+		{Name: "Alice", Email: "alice@example.com"},
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Carol", Email: "carol@example.com"},
+		{Name: "Dave", Email: "dave@example.com"},
+		{Name: "Eve", Email: "eve@example.com"},
+	}
+	for _, u := range users {
+		if err := w.Write(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events := <-done
+	if len(events) != 2 || len(events[0].Items) != 4 || len(events[1].Items) != 1 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if last := events[1]; last.Written != 5 || last.Failed != 0 {
+		t.Errorf("expected 5 written, got %d written and %d failed", last.Written, last.Failed)
+	}
+	if stats := w.Stats(); stats.Splits != 1 || stats.Batches != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	// The aborted batch, its two halves and the last batch.
+	if n := len(fake.Requests()); n != 4 {
+		t.Errorf("expected 4 requests, got %d", n)
+	}
+	for _, u := range users {
+		if u.Uid == "" {
+			t.Errorf("expected a uid for %s", u.Name)
+		}
+	}
+	if err := w.Write(&User{Name: "Frank"}); err == nil {
+		t.Error("expected an error after Close")
+	}
+}
@@ -0,0 +1,352 @@
+package dquelytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/dgo/v250"
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely"
+)
+
+// store is a snapshot of the graph: every node with its predicate values.
+type store struct {
+	nodes  map[uint64]map[string][]value
+	schema *schema
+}
+
+func newStore() *store {
+	return &store{nodes: map[uint64]map[string][]value{}, schema: newSchema()}
+}
+
+func (s *store) clone() *store {
+	c := &store{nodes: make(map[uint64]map[string][]value, len(s.nodes)), schema: s.schema.clone()}
+	for uid, preds := range s.nodes {
+		cp := make(map[string][]value, len(preds))
+		for p, vals := range preds {
+			cp[p] = append([]value(nil), vals...)
+		}
+		c.nodes[uid] = cp
+	}
+	return c
+}
+
+// values returns the values of pred on uid.
+func (s *store) values(uid uint64, pred string) []value {
+	return s.nodes[uid][pred]
+}
+
+// reverse returns the nodes with a pred edge pointing to uid, in uid order.
+func (s *store) reverse(uid uint64, pred string) []uint64 {
+	var out []uint64
+	for from, preds := range s.nodes {
+		for _, v := range preds[pred] {
+			if v.uid() == uid {
+				out = append(out, from)
+				break
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// all returns every node in uid order.
+func (s *store) all() []uint64 {
+	out := make([]uint64, 0, len(s.nodes))
+	for uid := range s.nodes {
+		out = append(out, uid)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Graph is an in-memory dquely.Backend that executes the subset of DQL dquely
+// generates, so code built on dquely can be tested end to end without Dgraph.
+//
+// Supported are root functions and filters (uid, type, has, eq, gt, ge, lt, le,
+// between, regexp, the term and full-text functions and uid_in) combined with
+// AND, OR and NOT; nested selects with their own filters; first, offset, after,
+// orderasc and orderdesc; @cascade; var blocks with uid and value variables;
+// count, val and expand(_all_); and N-Quad set and delete mutations with blank
+// nodes, uid(v) and val(a) references and @if conditions. Values of @unique
+// predicates are rejected when another node holds them. Transactions see a
+// snapshot taken at their first request and abort on conflicting commits.
+//
+// Values are typed by the schema passed to Alter; predicates without a schema are
+// stored as strings, just as Dgraph does.
+type Graph struct {
+	mu       sync.Mutex
+	data     *store
+	maxUID   uint64
+	ts       uint64
+	written  map[string]uint64 // conflict key -> commit timestamp of its last write
+	requests []*api.Request
+	closed   bool
+}
+
+var _ dquely.Backend = (*Graph)(nil)
+
+// NewGraph returns an empty Graph.
+func NewGraph() *Graph {
+	return &Graph{data: newStore(), written: map[string]uint64{}}
+}
+
+// NewGraphClient returns a client backed by a new Graph.
+func NewGraphClient() (*dquely.Dgo, *Graph) {
+	g := NewGraph()
+	return dquely.NewClientWithBackend(g), g
+}
+
+// Requests returns every request received so far, oldest first.
+func (g *Graph) Requests() []*api.Request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*api.Request(nil), g.requests...)
+}
+
+// Len returns the number of nodes with at least one predicate.
+func (g *Graph) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.data.nodes)
+}
+
+// Node returns the committed predicates of uid, with edges rendered as uids and
+// scalars as Dgraph renders them in JSON. It returns nil for unknown nodes.
+func (g *Graph) Node(uid string) map[string][]any {
+	u, err := parseUID(uid)
+	if err != nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	preds, ok := g.data.nodes[u]
+	if !ok {
+		return nil
+	}
+	out := make(map[string][]any, len(preds))
+	for p, vals := range preds {
+		for _, v := range vals {
+			out[p] = append(out[p], v.json())
+		}
+	}
+	return out
+}
+
+// NewTxn implements dquely.Backend.
+func (g *Graph) NewTxn(opts dquely.TxnOptions) dquely.TxnBackend {
+	return &graphTxn{g: g, readOnly: opts.ReadOnly}
+}
+
+// Alter implements dquely.Backend. It applies schema changes and supports
+// DropAll and DropAttr.
+func (g *Graph) Alter(_ context.Context, op *api.Operation) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case op.DropAll:
+		g.data = newStore()
+		g.ts++
+		g.written = map[string]uint64{}
+		return nil
+	case op.DropAttr != "":
+		for _, preds := range g.data.nodes {
+			delete(preds, op.DropAttr)
+		}
+		delete(g.data.schema.preds, op.DropAttr)
+		g.data.prune()
+		g.ts++
+		return nil
+	}
+	next := g.data.schema.clone()
+	if err := next.apply(op.Schema); err != nil {
+		return fmt.Errorf("dquelytest: schema: %w", err)
+	}
+	g.data.schema = next
+	return nil
+}
+
+// Close implements dquely.Backend.
+func (g *Graph) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+}
+
+// prune removes nodes without predicates.
+func (s *store) prune() {
+	for uid, preds := range s.nodes {
+		if len(preds) == 0 {
+			delete(s.nodes, uid)
+		}
+	}
+}
+
+// allocate reserves a fresh uid.
+func (g *Graph) allocate() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxUID++
+	return g.maxUID
+}
+
+// leased reports whether uid has been handed out, i.e. may be referenced.
+func (g *Graph) leased(uid uint64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return uid <= g.maxUID
+}
+
+// graphTxn is a transaction on a Graph. It works on a private copy of the data
+// taken at its first request; commit copies the keys it wrote back.
+type graphTxn struct {
+	g        *Graph
+	readOnly bool
+	started  bool
+	startTs  uint64
+	view     *store
+	writes   map[string]writeKey
+	finished bool
+	mutated  bool
+}
+
+// writeKey identifies a (node, predicate) pair or an @upsert index entry written
+// by a transaction.
+type writeKey struct {
+	uid  uint64
+	pred string
+}
+
+func (t *graphTxn) begin() {
+	if t.started {
+		return
+	}
+	t.g.mu.Lock()
+	defer t.g.mu.Unlock()
+	t.started = true
+	t.startTs = t.g.ts
+	t.view = t.g.data.clone()
+	t.writes = map[string]writeKey{}
+}
+
+func (t *graphTxn) Do(ctx context.Context, req *api.Request) (*api.Response, error) {
+	if t.finished {
+		return nil, dgo.ErrFinished
+	}
+	if len(req.Mutations) > 0 {
+		if t.readOnly {
+			return nil, dgo.ErrReadOnly
+		}
+		t.mutated = true
+	}
+	t.g.mu.Lock()
+	t.g.requests = append(t.g.requests, req)
+	t.g.mu.Unlock()
+	t.begin()
+
+	resp, err := t.do(req)
+	if err != nil {
+		if t.mutated {
+			_ = t.Discard(ctx)
+		}
+		return nil, err
+	}
+	if req.CommitNow {
+		if err := t.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (t *graphTxn) do(req *api.Request) (*api.Response, error) {
+	env := newEnv(t.view)
+	var out []byte
+	if req.Query != "" {
+		var err error
+		if out, err = env.run(req.Query); err != nil {
+			return nil, err
+		}
+	}
+	resp := &api.Response{Json: out, Txn: &api.TxnContext{StartTs: t.startTs + 1}}
+	if len(req.Mutations) == 0 {
+		return resp, nil
+	}
+	m := &mutator{txn: t, env: env, uids: map[string]string{}, blank: map[string]uint64{}}
+	for _, mu := range req.Mutations {
+		if err := m.apply(mu); err != nil {
+			return nil, err
+		}
+	}
+	resp.Uids = m.uids
+	return resp, nil
+}
+
+// conflictKey is the key used to detect conflicting writes.
+func conflictKey(k writeKey) string {
+	return fmt.Sprintf("%d|%s", k.uid, k.pred)
+}
+
+func (t *graphTxn) Commit(ctx context.Context) error {
+	if t.readOnly {
+		return dgo.ErrReadOnly
+	}
+	if t.finished {
+		return dgo.ErrFinished
+	}
+	t.finished = true
+	if !t.mutated {
+		return nil
+	}
+	g := t.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key := range t.writes {
+		if g.written[key] > t.startTs {
+			return dgo.ErrAborted
+		}
+	}
+	g.ts++
+	for key, k := range t.writes {
+		g.written[key] = g.ts
+		if k.uid == 0 {
+			continue // index key, nothing to copy
+		}
+		vals := t.view.values(k.uid, k.pred)
+		if len(vals) == 0 {
+			if preds := g.data.nodes[k.uid]; preds != nil {
+				delete(preds, k.pred)
+				if len(preds) == 0 {
+					delete(g.data.nodes, k.uid)
+				}
+			}
+			continue
+		}
+		preds := g.data.nodes[k.uid]
+		if preds == nil {
+			preds = map[string][]value{}
+			g.data.nodes[k.uid] = preds
+		}
+		preds[k.pred] = append([]value(nil), vals...)
+	}
+	// Predicates whose schema was inferred by this transaction become visible too.
+	for name, p := range t.view.schema.preds {
+		if g.data.schema.preds[name] == nil {
+			cp := *p
+			g.data.schema.preds[name] = &cp
+		}
+	}
+	return nil
+}
+
+func (t *graphTxn) Discard(context.Context) error {
+	t.finished = true
+	return nil
+}
+
+// errUnsupported reports DQL that Graph does not implement.
+var errUnsupported = errors.New("dquelytest: unsupported")
@@ -0,0 +1,967 @@
+package dquelytest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v250"
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely"
+	"github.com/vibros68/dquely/dquelytest"
+)
+
+type Person struct {
+	Uid     string   `dquely:"uid" json:"uid,omitempty"`
+	Name    string   `dquely:"name" json:"name,omitempty"`
+	Email   string   `dquely:"email,unique" json:"email,omitempty"`
+	Age     int      `dquely:"age" json:"age,omitempty"`
+	Friends []Person `dquely:"friends" json:"friends,omitempty"`
+}
+
+// Member is Person without edges, so ParseMutation takes its conditional update path.
+type Member struct {
+	Uid   string `dquely:"uid"`
+	Name  string `dquely:"name"`
+	Email string `dquely:"email,unique"`
+	Age   int    `dquely:"age"`
+}
+
+func (*Member) DgraphType() string { return "Person" }
+
+// Friend is Person with pointer edges, so friends can be shared and form cycles.
+type Friend struct {
+	Uid     string    `dquely:"uid"`
+	Name    string    `dquely:"name"`
+	Email   string    `dquely:"email,unique"`
+	Friends []*Friend `dquely:"friends"`
+}
+
+func (*Friend) DgraphType() string { return "Person" }
+
+// Author is written as a nested node of Post.
+type Author struct {
+	Uid   string `dquely:"uid"`
+	Name  string `dquely:"name"`
+	Email string `dquely:"email,unique"`
+}
+
+type Post struct {
+	Uid    string  `dquely:"uid"`
+	Title  string  `dquely:"title"`
+	Author *Author `dquely:"author"`
+}
+
+// Account is unique per tenant by email, regardless of case.
+type Account struct {
+	Uid    string `dquely:"uid"`
+	Tenant string `dquely:"tenant,unique=tenant_email"`
+	Email  string `dquely:"email,unique=tenant_email,fold,trim"`
+	Name   string `dquely:"name"`
+}
+
+// Settings stores zero values through pointers, keepzero and Optionals.
+type Settings struct {
+	Uid     string                  `dquely:"uid"`
+	Owner   string                  `dquely:"owner,unique"`
+	Limit   *int                    `dquely:"limit"`
+	Retries int                     `dquely:"retries,keepzero"`
+	Note    dquely.Optional[string] `dquely:"note"`
+	Theme   dquely.Optional[string] `dquely:"theme"`
+}
+
+// Recipe has scalar list fields.
+type Recipe struct {
+	Uid     string   `dquely:"uid" json:"uid,omitempty"`
+	Title   string   `dquely:"title,unique" json:"title,omitempty"`
+	Tags    []string `dquely:"tags" json:"tags,omitempty"`
+	Ratings []int    `dquely:"ratings" json:"ratings,omitempty"`
+}
+
+// Base is embedded by the models of TestGraphPolymorphic.
+type Base struct {
+	Uid string `dquely:"uid" json:"uid,omitempty"`
+}
+
+// Party is implemented by the nodes a Doc can belong to.
+type Party interface {
+	party()
+}
+
+type Org struct {
+	Base
+	Name string `dquely:"name,unique" json:"name,omitempty"`
+}
+
+func (*Org) party() {}
+
+type Doc struct {
+	Base
+	Title string `dquely:"title" json:"title,omitempty"`
+	Owner Party  `dquely:"owner" json:"-"`
+}
+
+const personSchema = `
+name: string @index(exact, term) .
+email: string @index(exact) @upsert .
+age: int @index(int) .
+friends: [uid] @reverse .
+type Person { name email age friends }
+`
+
+// newGraphClient returns a client backed by a Graph with personSchema applied.
+func newGraphClient(t *testing.T) (*dquely.Dgo, *dquelytest.Graph) {
+	t.Helper()
+	client, g := dquelytest.NewGraphClient()
+	if err := client.SetSchema(context.Background(), personSchema); err != nil {
+		t.Fatal(err)
+	}
+	return client, g
+}
+
+func seedPeople(t *testing.T, client *dquely.Dgo) []*Person {
+	t.Helper()
+	people := []*Person{
+		{Name: "Alice Smith", Email: "alice@example.com", Age: 31},
+		{Name: "Bob Jones", Email: "bob@example.com", Age: 25},
+		{Name: "Carol Smith", Email: "carol@example.com", Age: 19},
+	}
+	for _, p := range people {
+		if err := client.Mutate(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return people
+}
+
+func TestGraphMutateUnique(t *testing.T) {
+	client, g := newGraphClient(t)
+	alice := &Person{Name: "Alice", Email: "alice@example.com", Age: 31}
+	if err := client.Mutate(context.Background(), alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.Uid == "" {
+		t.Fatal("expected the uid to be set")
+	}
+	dup := &Person{Name: "Other Alice", Email: "alice@example.com"}
+	if err := client.Mutate(context.Background(), dup); err == nil {
+		t.Fatal("expected a duplicate error")
+	}
+	if g.Len() != 1 {
+		t.Errorf("expected 1 node, got %d", g.Len())
+	}
+	node := g.Node(alice.Uid)
+	if node["name"][0] != "Alice" || node["age"][0] != int64(31) {
+		t.Errorf("unexpected node %v", node)
+	}
+}
+
+func TestGraphDuplicateError(t *testing.T) {
+	ctx := context.Background()
+	client, g := newGraphClient(t)
+	people := seedPeople(t, client)
+	expectDuplicate := func(err error, email, uid string) {
+		t.Helper()
+		var dup *dquely.DuplicateError
+		if !errors.As(err, &dup) {
+			t.Fatalf("expected a DuplicateError, got %v", err)
+		}
+		if dup.Type != "Person" || len(dup.Fields) != 1 || dup.Fields["email"] != email ||
+			len(dup.ExistingUIDs) != 1 || dup.ExistingUIDs[0] != uid {
+			t.Errorf("unexpected error %+v", dup)
+		}
+	}
+
+	err := client.Mutate(ctx, &Member{Name: "Other Bob", Email: "bob@example.com"})
+	expectDuplicate(err, "bob@example.com", people[1].Uid)
+	if want := "mutate failed: duplicated Person email held by " + people[1].Uid; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+
+	// Updates are blocked the same way, and succeed through Mutate otherwise.
+	err = client.Mutate(ctx, &Member{Uid: people[0].Uid, Name: "Alice", Email: "carol@example.com"})
+	expectDuplicate(err, "carol@example.com", people[2].Uid)
+	if err := client.Mutate(ctx, &Member{Uid: people[0].Uid, Name: "Alice", Email: "alice@example.org"}); err != nil {
+		t.Fatalf("expected the update to succeed, got %v", err)
+	}
+	if got := g.Node(people[0].Uid)["email"][0]; got != "alice@example.org" {
+		t.Errorf("expected the email to be updated, got %v", got)
+	}
+
+	txn := client.NewTxn()
+	defer txn.Discard(ctx)
+	expectDuplicate(txn.Mutate(ctx, &Member{Name: "Bob", Email: "bob@example.com"}), "bob@example.com", people[1].Uid)
+}
+
+func TestGraphFind(t *testing.T) {
+	client, _ := newGraphClient(t)
+	seedPeople(t, client)
+	q := dquely.NewDQL("people").Type("Person").
+		Filter(dquely.Ge("age", 20)).
+		Order("name", dquely.DESC).
+		Select("uid", "name", "age")
+	people, err := dquely.Model[Person](client).Find(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(people) != 2 || people[0].Name != "Bob Jones" || people[1].Name != "Alice Smith" {
+		t.Errorf("unexpected people %+v", people)
+	}
+
+	q = dquely.NewDQL("smiths").AllOfTerms("name", "smith").Order("age", dquely.ASC).First(1).Select("name")
+	first, err := dquely.Model[Person](client).First(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "Carol Smith" {
+		t.Errorf("expected Carol Smith, got %q", first.Name)
+	}
+}
+
+func TestGraphUpdate(t *testing.T) {
+	client, _ := newGraphClient(t)
+	people := seedPeople(t, client)
+	bob := people[1]
+	bob.Name = "Robert Jones"
+	if err := client.Update(context.Background(), bob, "name"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dquely.Model[Person](client).First(context.Background(),
+		dquely.NewDQL("me").Uid(bob.Uid).Select("name", "email"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Robert Jones" || got.Email != "bob@example.com" {
+		t.Errorf("unexpected person %+v", got)
+	}
+}
+
+func TestGraphDeepMutation(t *testing.T) {
+	client, _ := newGraphClient(t)
+	dave := &Person{
+		Name:  "Dave",
+		Email: "dave@example.com",
+		Friends: []Person{
+			{Name: "Erin", Email: "erin@example.com"},
+			{Name: "Frank", Email: "frank@example.com"},
+		},
+	}
+	if err := client.Mutate(context.Background(), dave, true); err != nil {
+		t.Fatal(err)
+	}
+	if dave.Friends[0].Uid == "" || dave.Friends[1].Uid == "" {
+		t.Fatalf("expected nested uids, got %+v", dave.Friends)
+	}
+	q := dquely.NewDQL("me").Uid(dave.Uid).Select("name",
+		dquely.NewDQL("").As("friends").Order("name", dquely.DESC).Select("uid", "name"))
+	got, err := dquely.Model[Person](client).First(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Friends) != 2 || got.Friends[0].Name != "Frank" || got.Friends[1].Uid != dave.Friends[0].Uid {
+		t.Errorf("unexpected friends %+v", got.Friends)
+	}
+}
+
+func TestGraphDeepCycle(t *testing.T) {
+	for _, enc := range []dquely.Encoding{dquely.EncodingNQuads, dquely.EncodingJSON} {
+		client, g := newGraphClient(t)
+		client.Encoding = enc
+		alice := &Friend{Name: "Alice", Email: "alice@example.com"}
+		bob := &Friend{Name: "Bob", Email: "bob@example.com"}
+		carol := &Friend{Name: "Carol", Email: "carol@example.com"}
+		alice.Friends = []*Friend{bob, carol}
+		bob.Friends = []*Friend{alice, carol}
+		if err := client.Mutate(context.Background(), alice, true); err != nil {
+			t.Fatal(err)
+		}
+		if g.Len() != 3 {
+			t.Errorf("encoding %v: expected 3 nodes, got %d", enc, g.Len())
+		}
+		if alice.Uid == "" || bob.Uid == "" || carol.Uid == "" {
+			t.Fatalf("encoding %v: expected uids, got %q %q %q", enc, alice.Uid, bob.Uid, carol.Uid)
+		}
+		friends := g.Node(bob.Uid)["friends"]
+		if len(friends) != 2 || friends[0] != alice.Uid || friends[1] != carol.Uid {
+			t.Errorf("encoding %v: unexpected friends of Bob %v", enc, friends)
+		}
+	}
+}
+
+func TestGraphDeepUniqueLink(t *testing.T) {
+	for _, enc := range []dquely.Encoding{dquely.EncodingNQuads, dquely.EncodingJSON} {
+		ctx := context.Background()
+		client, g := newGraphClient(t)
+		client.Encoding = enc
+		first := &Post{Title: "First", Author: &Author{Name: "Alice", Email: "alice@example.com"}}
+		if err := client.Mutate(ctx, first, true); err != nil {
+			t.Fatal(err)
+		}
+		if first.Uid == "" || first.Author.Uid == "" {
+			t.Fatalf("encoding %v: expected uids, got %q and %q", enc, first.Uid, first.Author.Uid)
+		}
+		second := &Post{Title: "Second", Author: &Author{Name: "Alice", Email: "alice@example.com"}}
+		if err := client.Mutate(ctx, second, true); err != nil {
+			t.Fatal(err)
+		}
+		if g.Len() != 3 {
+			t.Errorf("encoding %v: expected the author to be reused, got %d nodes", enc, g.Len())
+		}
+		if got := g.Node(second.Uid)["author"]; len(got) != 1 || got[0] != first.Author.Uid {
+			t.Errorf("encoding %v: expected the second post to link %s, got %v", enc, first.Author.Uid, got)
+		}
+		if second.Author.Uid != first.Author.Uid {
+			t.Errorf("encoding %v: expected the linked author to get %s, got %q", enc, first.Author.Uid, second.Author.Uid)
+		}
+		more := []*Post{
+			{Title: "Third", Author: &Author{Name: "Alice", Email: "alice@example.com"}},
+			{Title: "Fourth", Author: &Author{Name: "Alice", Email: "alice@example.com"}},
+		}
+		if err := client.MutateMany(ctx, more, dquely.BatchOptions{Deep: true}); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range more {
+			if p.Uid == "" || p.Author.Uid != first.Author.Uid {
+				t.Errorf("encoding %v: expected %s to link %s, got %q", enc, p.Title, first.Author.Uid, p.Author.Uid)
+			}
+		}
+	}
+}
+
+func TestGraphUpsert(t *testing.T) {
+	ctx := context.Background()
+	client, g := newGraphClient(t)
+	alice := &Member{Name: "Alice", Email: "alice@example.com", Age: 30}
+	created, err := client.Upsert(ctx, alice, dquely.OnConflictError)
+	if err != nil || !created || alice.Uid == "" {
+		t.Fatalf("expected Alice to be created, got %v %v %q", created, err, alice.Uid)
+	}
+
+	dup := &Member{Name: "Copy", Email: "alice@example.com"}
+	_, err = client.Upsert(ctx, dup, dquely.OnConflictError)
+	var dupErr *dquely.DuplicateError
+	if !errors.As(err, &dupErr) || dupErr.ExistingUIDs[0] != alice.Uid || dup.Uid != "" {
+		t.Errorf("expected a duplicate error and no uid, got %v %q", err, dup.Uid)
+	}
+
+	ignored := &Member{Name: "Ignored", Email: "alice@example.com", Age: 99}
+	created, err = client.Upsert(ctx, ignored, dquely.OnConflictIgnore)
+	if err != nil || created || ignored.Uid != alice.Uid {
+		t.Errorf("expected Alice to be matched, got %v %v %q", created, err, ignored.Uid)
+	}
+	if node := g.Node(alice.Uid); node["name"][0] != "Alice" || node["age"][0] != int64(30) {
+		t.Errorf("expected Alice to be unchanged, got %v", node)
+	}
+
+	updated := &Member{Name: "Alice Smith", Email: "alice@example.com", Age: 31}
+	created, err = client.Upsert(ctx, updated, dquely.OnConflictUpdate)
+	if err != nil || created || updated.Uid != alice.Uid {
+		t.Errorf("expected Alice to be matched, got %v %v %q", created, err, updated.Uid)
+	}
+	if node := g.Node(alice.Uid); node["name"][0] != "Alice Smith" || node["age"][0] != int64(31) {
+		t.Errorf("expected Alice to be updated, got %v", node)
+	}
+	if g.Len() != 1 {
+		t.Errorf("expected 1 node, got %d", g.Len())
+	}
+}
+
+func TestGraphCompositeUnique(t *testing.T) {
+	ctx := context.Background()
+	client, g := dquelytest.NewGraphClient()
+	schema, err := dquely.SchemaOf(&Account{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetSchema(ctx, schema.String()); err != nil {
+		t.Fatal(err)
+	}
+	alice := &Account{Tenant: "acme", Email: "alice@example.com", Name: "Alice"}
+	if err := client.Mutate(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	other := &Account{Tenant: "globex", Email: "alice@example.com", Name: "Alice"}
+	if err := client.Mutate(ctx, other); err != nil {
+		t.Errorf("expected the same email in another tenant to be accepted, got %v", err)
+	}
+	err = client.Mutate(ctx, &Account{Tenant: "acme", Email: " ALICE@example.com"})
+	var dup *dquely.DuplicateError
+	if !errors.As(err, &dup) || dup.Fields["tenant"] != "acme" || dup.Fields["email"] != " ALICE@example.com" ||
+		dup.ExistingUIDs[0] != alice.Uid {
+		t.Errorf("expected a duplicate error for the same email in another case, got %v", err)
+	}
+	// Updating another account onto Alice's key is rejected as well.
+	other.Tenant = "acme"
+	if err := client.Mutate(ctx, other); err == nil {
+		t.Error("expected a duplicate error for the update")
+	}
+	matched := &Account{Tenant: "acme", Email: "Alice@Example.com"}
+	if created, err := client.Upsert(ctx, matched, dquely.OnConflictIgnore); err != nil || created || matched.Uid != alice.Uid {
+		t.Errorf("expected Alice to be matched, got %v %v %q", created, err, matched.Uid)
+	}
+	if g.Len() != 2 {
+		t.Errorf("expected 2 nodes, got %d", g.Len())
+	}
+}
+
+func TestGraphServerUnique(t *testing.T) {
+	ctx := context.Background()
+	client, g := dquelytest.NewGraphClient()
+	client.Unique = dquely.UniqueServer
+	schema, err := client.SchemaOf(&Member{}, &Account{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetSchema(ctx, schema.String()); err != nil {
+		t.Fatal(err)
+	}
+	alice := &Member{Name: "Alice", Email: "alice@example.com"}
+	bob := &Member{Name: "Bob", Email: "bob@example.com"}
+	for _, m := range []*Member{alice, bob} {
+		if err := client.Mutate(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q := g.Requests()[1].Query; q != "" {
+		t.Errorf("expected no uniqueness query, got\n%s", q)
+	}
+	expectDuplicate := func(err error, email string) {
+		t.Helper()
+		var dup *dquely.DuplicateError
+		if !errors.As(err, &dup) || dup.Type != "Person" || dup.Fields["email"] != email || len(dup.ExistingUIDs) != 0 {
+			t.Errorf("expected a DuplicateError for %s, got %v", email, err)
+		}
+	}
+	expectDuplicate(client.Mutate(ctx, &Member{Name: "Other Alice", Email: "alice@example.com"}), "alice@example.com")
+	expectDuplicate(client.Mutate(ctx, &Member{Uid: bob.Uid, Name: "Bob", Email: "alice@example.com"}), "alice@example.com")
+	if err := client.Mutate(ctx, &Member{Uid: bob.Uid, Name: "Bob", Email: "bob@example.org"}); err != nil {
+		t.Fatalf("expected the update to succeed, got %v", err)
+	}
+	err = client.MutateMany(ctx, []*Member{{Name: "Carol", Email: "carol@example.com"}, {Name: "Bob", Email: "bob@example.org"}})
+	expectDuplicate(err, "bob@example.org")
+	if g.Len() != 2 {
+		t.Errorf("expected 2 nodes, got %d", g.Len())
+	}
+
+	// Composite keys cannot be @unique and keep the uniqueness query.
+	if err := client.Mutate(ctx, &Account{Tenant: "acme", Email: "dave@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if q := g.Requests()[len(g.Requests())-1].Query; !strings.Contains(q, "email_norm") {
+		t.Errorf("expected a uniqueness query, got\n%s", q)
+	}
+	var dup *dquely.DuplicateError
+	if err := client.Mutate(ctx, &Account{Tenant: "acme", Email: "Dave@example.com"}); !errors.As(err, &dup) || len(dup.ExistingUIDs) != 1 {
+		t.Errorf("expected a duplicate error for the composite key, got %v", err)
+	}
+}
+
+func TestGraphNullable(t *testing.T) {
+	ctx := context.Background()
+	client, g := dquelytest.NewGraphClient()
+	schema, err := dquely.SchemaOf(&Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetSchema(ctx, schema.String()); err != nil {
+		t.Fatal(err)
+	}
+	limit := 0
+	settings := &Settings{Owner: "alice", Limit: &limit, Note: dquely.Some(""), Theme: dquely.Some("dark")}
+	if err := client.Mutate(ctx, settings); err != nil {
+		t.Fatal(err)
+	}
+	node := g.Node(settings.Uid)
+	if node["limit"][0] != int64(0) || node["retries"][0] != int64(0) || node["note"][0] != "" {
+		t.Errorf("expected the zero values to be stored, got %v", node)
+	}
+
+	// The unset Note is kept, the null Theme is deleted.
+	update := &Settings{Uid: settings.Uid, Owner: "alice", Limit: &limit, Theme: dquely.Null[string]()}
+	if err := client.Mutate(ctx, update); err != nil {
+		t.Fatal(err)
+	}
+	node = g.Node(settings.Uid)
+	if node["note"] == nil || node["theme"] != nil || node["limit"][0] != int64(0) {
+		t.Errorf("unexpected node %v", node)
+	}
+}
+
+func TestGraphLists(t *testing.T) {
+	ctx := context.Background()
+	client, _ := dquelytest.NewGraphClient()
+	schema, err := dquely.SchemaOf(&Recipe{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetSchema(ctx, schema.String()); err != nil {
+		t.Fatal(err)
+	}
+	recipe := &Recipe{Title: "Pho", Tags: []string{"soup", "vietnamese"}, Ratings: []int{4, 5}}
+	if err := client.Mutate(ctx, recipe); err != nil {
+		t.Fatal(err)
+	}
+	load := func() *Recipe {
+		t.Helper()
+		got, err := dquely.Model[Recipe](client).First(ctx,
+			dquely.NewDQL("me").Uid(recipe.Uid).Select("title", "tags", "ratings"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(got.Tags)
+		slices.Sort(got.Ratings)
+		return got
+	}
+	if got := load(); !slices.Equal(got.Tags, []string{"soup", "vietnamese"}) || !slices.Equal(got.Ratings, []int{4, 5}) {
+		t.Errorf("unexpected recipe %+v", got)
+	}
+
+	steps := []struct {
+		field string
+		tags  []string
+		want  []string
+	}{
+		{"+tags", []string{"noodles"}, []string{"noodles", "soup", "vietnamese"}},
+		{"-tags", []string{"soup"}, []string{"noodles", "vietnamese"}},
+		{"tags", []string{"broth"}, []string{"broth"}},
+	}
+	for _, step := range steps {
+		recipe.Tags = step.tags
+		if err := client.Update(ctx, recipe, step.field); err != nil {
+			t.Fatalf("%s: %v", step.field, err)
+		}
+		if got := load(); !slices.Equal(got.Tags, step.want) {
+			t.Errorf("%s: expected %v, got %v", step.field, step.want, got.Tags)
+		}
+	}
+
+	// A full update replaces every list.
+	recipe.Tags, recipe.Ratings = []string{"stew"}, []int{3}
+	if err := client.Mutate(ctx, recipe); err != nil {
+		t.Fatal(err)
+	}
+	if got := load(); !slices.Equal(got.Tags, []string{"stew"}) || !slices.Equal(got.Ratings, []int{3}) {
+		t.Errorf("unexpected recipe %+v", got)
+	}
+}
+
+func TestGraphPolymorphic(t *testing.T) {
+	ctx := context.Background()
+	client, g := dquelytest.NewGraphClient()
+	schema, err := dquely.SchemaOf(&Doc{}, &Org{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetSchema(ctx, schema.String()); err != nil {
+		t.Fatal(err)
+	}
+	acme := &Org{Name: "Acme"}
+	doc := &Doc{Title: "Plan", Owner: acme}
+	if err := client.Mutate(ctx, doc, true); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Uid == "" || acme.Uid == "" {
+		t.Fatalf("expected the embedded uids to be set, got %q and %q", doc.Uid, acme.Uid)
+	}
+	if got := g.Node(acme.Uid)["dgraph.type"]; len(got) != 1 || got[0] != "Org" {
+		t.Errorf("expected the owner to be an Org, got %v", got)
+	}
+	if got := fmt.Sprint(g.Node(doc.Uid)["owner"]); !strings.Contains(got, acme.Uid) {
+		t.Errorf("expected the doc to point to %s, got %s", acme.Uid, got)
+	}
+
+	// A second doc owned by an Org with the same unique name links to the first.
+	again := &Doc{Title: "Budget", Owner: &Org{Name: "Acme"}}
+	if err := client.Mutate(ctx, again, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(g.Node(again.Uid)["owner"]); !strings.Contains(got, acme.Uid) {
+		t.Errorf("expected the second doc to point to %s, got %s", acme.Uid, got)
+	}
+}
+
+func TestGraphVariables(t *testing.T) {
+	client, _ := newGraphClient(t)
+	seedPeople(t, client)
+	resp, err := client.Query(context.Background(), `{
+  smiths as var(func: anyofterms(name, "smith")) {
+    a as age
+  }
+  total(func: uid(smiths)) {
+    count(uid)
+  }
+  oldest(func: uid(smiths), orderdesc: val(a), first: 1) @filter(NOT eq(email, "nobody")) {
+    name
+    years: val(a)
+  }
+}`, dquely.TxnOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"total":[{"count":2}],"oldest":[{"name":"Alice Smith","years":31}]}`
+	if string(resp.Json) != want {
+		t.Errorf("expected %s, got %s", want, resp.Json)
+	}
+}
+
+func TestGraphUpsertBlock(t *testing.T) {
+	client, g := newGraphClient(t)
+	seedPeople(t, client)
+	txn := g.NewTxn(dquely.TxnOptions{})
+	_, err := txn.Do(context.Background(), &api.Request{
+		Query: `{ v as var(func: eq(email, "bob@example.com")) { a as age } }`,
+		Mutations: []*api.Mutation{{
+			Cond:      "@if(eq(len(v), 1))",
+			SetNquads: []byte(`uid(v) <previousAge> val(a) .`),
+			DelNquads: []byte(`uid(v) <age> * .`),
+		}},
+		CommitNow: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Query(context.Background(),
+		`{ bob(func: eq(email, "bob@example.com")) { age previousAge } }`, dquely.TxnOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"bob":[{"previousAge":25}]}`; string(resp.Json) != want {
+		t.Errorf("expected %s, got %s", want, resp.Json)
+	}
+}
+
+func TestGraphTxnIsolation(t *testing.T) {
+	client, _ := newGraphClient(t)
+	ctx := context.Background()
+	find := func() int {
+		people, err := dquely.Model[Person](client).Find(ctx, dquely.NewDQL("all").Type("Person").Select("uid"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(people)
+	}
+
+	txn := client.NewTxn()
+	if err := txn.Mutate(ctx, &Person{Name: "Gina", Email: "gina@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := find(); n != 0 {
+		t.Errorf("expected uncommitted writes to be invisible, found %d people", n)
+	}
+	inTxn, err := dquely.Model[Person](client).InTxn(txn).Find(ctx, dquely.NewDQL("all").Type("Person").Select("uid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inTxn) != 1 {
+		t.Errorf("expected the transaction to see its own write, found %d people", len(inTxn))
+	}
+
+	// A concurrent insert of the same @upsert value commits first.
+	if err := client.Mutate(ctx, &Person{Name: "Gina B", Email: "gina@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(ctx); !errors.Is(err, dgo.ErrAborted) {
+		t.Fatalf("expected %v, got %v", dgo.ErrAborted, err)
+	}
+	if n := find(); n != 1 {
+		t.Errorf("expected 1 person, found %d", n)
+	}
+}
+
+func TestGraphReverseAndCascade(t *testing.T) {
+	client, _ := newGraphClient(t)
+	dave := &Person{Name: "Dave", Email: "dave@example.com", Friends: []Person{{Name: "Erin", Email: "erin@example.com"}}}
+	if err := client.Mutate(context.Background(), dave, true); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Query(context.Background(), `{
+  erin(func: eq(name, "Erin")) {
+    name
+    ~friends { name }
+  }
+  withFriends(func: type(Person)) @cascade {
+    name
+    friends { name }
+  }
+}`, dquely.TxnOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"erin":[{"name":"Erin","~friends":[{"name":"Dave"}]}],"withFriends":[{"name":"Dave","friends":[{"name":"Erin"}]}]}`
+	if string(resp.Json) != want {
+		t.Errorf("expected %s, got %s", want, resp.Json)
+	}
+}
+
+func TestGraphUnsupported(t *testing.T) {
+	client, _ := newGraphClient(t)
+	_, err := client.Query(context.Background(), `{ q(func: has(name)) @groupby(age) { count(uid) } }`, dquely.TxnOptions{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("expected an unsupported error, got %v", err)
+	}
+}
+
+func TestGraphConditionalUpdate(t *testing.T) {
+	client, g := newGraphClient(t)
+	people := seedPeople(t, client)
+	update := func(p *Member) {
+		t.Helper()
+		query, mu, err := dquely.ParseMutation(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = g.NewTxn(dquely.TxnOptions{}).Do(context.Background(), &api.Request{Query: query, Mutations: mu, CommitNow: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Taking another person's email is rejected by the uniqueness condition.
+	update(&Member{Uid: people[0].Uid, Name: "Alice Smith", Email: "bob@example.com", Age: 32})
+	if got := g.Node(people[0].Uid)["email"][0]; got != "alice@example.com" {
+		t.Errorf("expected the email to be unchanged, got %v", got)
+	}
+
+	update(&Member{Uid: people[0].Uid, Name: "Alice Smith", Email: "alice@example.org"})
+	node := g.Node(people[0].Uid)
+	if node["email"][0] != "alice@example.org" || node["age"] != nil {
+		t.Errorf("unexpected node %v", node)
+	}
+}
+
+func TestGraphSchemaAndStrict(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newGraphClient(t)
+	seedPeople(t, client)
+
+	schema, err := client.Schema(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := schema.Predicates["name"]; p == nil || !p.Indexed("term") {
+		t.Errorf("unexpected name schema %+v", p)
+	}
+	if p := schema.Predicates["friends"]; p == nil || p.Type != "uid" || !p.List || !p.Reverse {
+		t.Errorf("unexpected friends schema %+v", p)
+	}
+	if got := strings.Join(schema.Types["Person"], " "); got != "name email age friends" {
+		t.Errorf("unexpected Person fields %s", got)
+	}
+
+	strict := dquely.Model[Person](client).Strict(schema)
+	people, err := strict.Find(ctx, dquely.NewDQL("people").AllOfTerms("name", "Smith").Select("uid", "name"))
+	if err != nil || len(people) != 2 {
+		t.Fatalf("expected 2 people, got %v, %v", people, err)
+	}
+	_, err = strict.Find(ctx, dquely.NewDQL("people").Regexp("name", "^A").Select("uid"))
+	var se *dquely.SchemaError
+	if !errors.As(err, &se) || se.Message != "regexp needs @index(trigram) on name" {
+		t.Errorf("expected a schema error, got %v", err)
+	}
+}
+
+func TestGraphJSONEncoding(t *testing.T) {
+	ctx := context.Background()
+	client, g := newGraphClient(t)
+	client.Encoding = dquely.EncodingJSON
+	alice := &Person{Name: `Alice "Al" Smith`, Email: "alice@example.com", Age: 31,
+		Friends: []Person{{Name: "Bob", Email: "bob@example.com"}}}
+	if err := client.Mutate(ctx, alice, true); err != nil {
+		t.Fatal(err)
+	}
+	if alice.Uid == "" || alice.Friends[0].Uid == "" {
+		t.Fatalf("expected uids to be written back, got %+v", alice)
+	}
+	node := g.Node(alice.Uid)
+	if node["name"][0] != `Alice "Al" Smith` || node["age"][0] != int64(31) || node["friends"][0] != alice.Friends[0].Uid {
+		t.Errorf("unexpected node %v", node)
+	}
+	if err := client.Mutate(ctx, &Member{Name: "Copy", Email: "alice@example.com"}); err == nil {
+		t.Error("expected a duplicate error")
+	}
+
+	member := &Member{Uid: alice.Uid, Name: "Alice", Email: "alice@example.com"}
+	if err := client.Update(ctx, member, dquely.FieldAll); err != nil {
+		t.Fatal(err)
+	}
+	if node := g.Node(alice.Uid); node["name"][0] != "Alice" {
+		t.Errorf("expected the update to apply, got %v", node)
+	}
+}
+
+func TestGraphMutateMany(t *testing.T) {
+	ctx := context.Background()
+	client, g := newGraphClient(t)
+	if err := client.Mutate(ctx, &Member{Name: "Alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	members := []*Member{
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Other Alice", Email: "alice@example.com"},
+		{Name: "Carol", Email: "carol@example.com"},
+		{Name: "Other Bob", Email: "bob@example.com"},
+		{Name: "Dave", Email: "dave@example.com"},
+	}
+	err := client.MutateMany(ctx, members, dquely.BatchOptions{ChunkSize: 2})
+	var batchErr *dquely.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a BatchError, got %v", err)
+	}
+	if len(batchErr.Errors) != 2 || batchErr.Errors[1] == nil || batchErr.Errors[3] == nil {
+		t.Fatalf("expected items 1 and 3 to fail, got %v", err)
+	}
+	var dup *dquely.DuplicateError
+	if !errors.As(batchErr.Errors[3], &dup) || dup.ExistingUIDs[0] != members[0].Uid {
+		t.Errorf("expected item 3 to collide with Bob, got %v", batchErr.Errors[3])
+	}
+	for i, m := range members {
+		if (m.Uid == "") != (batchErr.Errors[i] != nil) {
+			t.Errorf("item %d: unexpected uid %q", i, m.Uid)
+		}
+	}
+	if g.Len() != 4 {
+		t.Errorf("expected 4 nodes, got %d", g.Len())
+	}
+	if got := g.Node(members[4].Uid)["name"][0]; got != "Dave" {
+		t.Errorf("expected Dave, got %v", got)
+	}
+	// One Mutate plus three chunks.
+	reqs := g.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(reqs))
+	}
+	const chunk = `{
+  v_0 as var(func: type(Person))
+    @filter(eq(email, "bob@example.com"))
+
+  duplicates_0(func: uid(v_0)) {
+    uid
+    email
+  }
+
+  v_1 as var(func: type(Person))
+    @filter(eq(email, "alice@example.com"))
+
+  duplicates_1(func: uid(v_1)) {
+    uid
+    email
+  }
+}`
+	if reqs[1].Query != chunk {
+		t.Errorf("unexpected query:\n%s", reqs[1].Query)
+	}
+	if got := reqs[1].Mutations[1].Cond; got != "@if(eq(len(v_1), 0))" {
+		t.Errorf("unexpected condition %q", got)
+	}
+
+	// Conditions cannot see other items of the same request, so a repeated unique
+	// value is rejected before it is sent.
+	twins := []*Member{{Name: "Eve", Email: "eve@example.com"}, {Name: "Eve", Email: "eve@example.com"}}
+	err = client.MutateMany(ctx, twins)
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || !strings.Contains(err.Error(), "item 1: mutate failed: duplicated") {
+		t.Fatalf("expected item 1 to fail, got %v", err)
+	}
+	if twins[0].Uid == "" || g.Len() != 5 {
+		t.Errorf("expected the first twin to be inserted, got %q and %d nodes", twins[0].Uid, g.Len())
+	}
+}
+
+// Pair has predicates named like the query variables of a mutation.
+type Pair struct {
+	Uid string `dquely:"uid" json:"uid"`
+	U   string `dquely:"u,unique" json:"u"`
+	V   string `dquely:"v,unique" json:"v"`
+	V1  string `dquely:"v1" json:"v1"`
+}
+
+func TestGraphMutateManyVariableNames(t *testing.T) {
+	ctx := context.Background()
+	client, g := newGraphClient(t)
+	if err := client.Mutate(ctx, &Pair{U: "a", V: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	pairs := []*Pair{{U: "x", V: "b"}, {U: "y", V: "z", V1: "w"}}
+	err := client.MutateMany(ctx, pairs)
+	var batchErr *dquely.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 {
+		t.Fatalf("expected item 0 to fail, got %v", err)
+	}
+	var dup *dquely.DuplicateError
+	if !errors.As(batchErr.Errors[0], &dup) || dup.Fields["v"] != "b" {
+		t.Errorf("expected item 0 to collide on v, got %v", batchErr.Errors[0])
+	}
+	if node := g.Node(pairs[1].Uid); node["u"][0] != "y" || node["v"][0] != "z" || node["v1"][0] != "w" {
+		t.Errorf("unexpected node %v", node)
+	}
+	if q := g.Requests()[1].Query; !strings.Contains(q, `eq(u, "x") OR eq(v, "b")`) {
+		t.Errorf("expected the predicates to keep their names, got\n%s", q)
+	}
+}
+
+func TestGraphMutateManyDeep(t *testing.T) {
+	ctx := context.Background()
+	client, g := newGraphClient(t)
+	people := []*Person{
+		{Name: "Alice", Email: "alice@example.com", Friends: []Person{{Name: "Bob", Email: "bob@example.com"}}},
+		{Name: "Carol", Email: "carol@example.com", Friends: []Person{{Name: "Dave", Email: "dave@example.com"}}},
+	}
+	if err := client.MutateMany(ctx, people, dquely.BatchOptions{Deep: true}); err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() != 4 {
+		t.Errorf("expected 4 nodes, got %d", g.Len())
+	}
+	for _, p := range people {
+		if p.Uid == "" || p.Friends[0].Uid == "" || p.Uid == p.Friends[0].Uid {
+			t.Errorf("unexpected uids %q and %q", p.Uid, p.Friends[0].Uid)
+		}
+	}
+	if got := g.Node(people[1].Friends[0].Uid)["name"][0]; got != "Dave" {
+		t.Errorf("expected Dave, got %v", got)
+	}
+	if err := client.MutateMany(ctx, []Person{}); err == nil {
+		t.Error("expected an error for a slice of values")
+	}
+}
+
+func TestGraphBulkWriterDuplicates(t *testing.T) {
+	client, g := newGraphClient(t)
+	w := client.NewBulkWriter(context.Background(), dquely.BulkOptions{BatchSize: 3, Concurrency: 4})
+	failed := map[string]int{}
+	done := make(chan struct{})
+	go func() {
+		for ev := range w.Events() {
+			for i := range ev.Errors {
+				failed[ev.Items[i].(*Member).Email]++
+			}
+		}
+		close(done)
+	}()
+	var members []*Member
+	for i := 0; i < 30; i++ {
+		// Every address is written twice, by different batches.
+		m := &Member{Name: fmt.Sprintf("member %d", i), Email: fmt.Sprintf("m%d@example.com", i%15)}
+		members = append(members, m)
+		if err := w.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if stats := w.Stats(); stats.Written != 15 || stats.Failed != 15 {
+		t.Errorf("expected 15 written and 15 failed, got %+v", stats)
+	}
+	if g.Len() != 15 {
+		t.Errorf("expected 15 nodes, got %d", g.Len())
+	}
+	for email, n := range failed {
+		if n != 1 {
+			t.Errorf("%s failed %d times", email, n)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package dquelytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+// jsonQuads converts a SetJson or DeleteJson payload into N-Quads, following
+// Dgraph's JSON mutation format: "uid" names the node ("_:x", "0x1" or "uid(v)"),
+// nested objects are edges and, in deletions, null removes every value.
+func jsonQuads(data []byte, del bool) ([]dql.NQuad, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("dquelytest: json mutation: %w", err)
+	}
+	c := &jsonConverter{del: del}
+	objs, ok := v.([]any)
+	if !ok {
+		objs = []any{v}
+	}
+	for _, o := range objs {
+		m, ok := o.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("dquelytest: json mutation: expected objects, got %T", o)
+		}
+		if _, err := c.object(m); err != nil {
+			return nil, err
+		}
+	}
+	return c.quads, nil
+}
+
+type jsonConverter struct {
+	del   bool
+	quads []dql.NQuad
+	anon  int
+}
+
+// object emits the quads of m and returns the term naming its node.
+func (c *jsonConverter) object(m map[string]any) (dql.Term, error) {
+	subj, err := c.subject(m["uid"])
+	if err != nil {
+		return dql.Term{}, err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != "uid" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if c.del && len(keys) == 0 {
+		c.quads = append(c.quads, dql.NQuad{Subject: subj, Predicate: "*", Object: dql.Term{Kind: dql.TermStar}})
+	}
+	for _, k := range keys {
+		if strings.Contains(k, "|") {
+			return dql.Term{}, fmt.Errorf("%w: facets", errUnsupported)
+		}
+		pred, lang, _ := strings.Cut(k, "@")
+		vals, ok := m[k].([]any)
+		if !ok {
+			vals = []any{m[k]}
+		}
+		for _, v := range vals {
+			obj, skip, err := c.value(v, lang)
+			if err != nil {
+				return dql.Term{}, err
+			}
+			if !skip {
+				c.quads = append(c.quads, dql.NQuad{Subject: subj, Predicate: pred, Object: obj})
+			}
+		}
+	}
+	return subj, nil
+}
+
+func (c *jsonConverter) subject(v any) (dql.Term, error) {
+	s, _ := v.(string)
+	switch {
+	case v == nil && !c.del:
+		c.anon++
+		return dql.Term{Kind: dql.TermBlank, Value: fmt.Sprintf("dg.%d", c.anon)}, nil
+	case strings.HasPrefix(s, "_:"):
+		return dql.Term{Kind: dql.TermBlank, Value: s[2:]}, nil
+	case strings.HasPrefix(s, "uid(") && strings.HasSuffix(s, ")"):
+		return dql.Term{Kind: dql.TermUIDVar, Value: s[4 : len(s)-1]}, nil
+	case s != "":
+		return dql.Term{Kind: dql.TermUID, Value: s}, nil
+	}
+	return dql.Term{}, fmt.Errorf("dquelytest: json mutation: invalid uid %v", v)
+}
+
+// value converts a JSON value to an object term; skip is set for nulls in sets.
+func (c *jsonConverter) value(v any, lang string) (obj dql.Term, skip bool, err error) {
+	switch x := v.(type) {
+	case nil:
+		return dql.Term{Kind: dql.TermStar}, !c.del, nil
+	case map[string]any:
+		t, err := c.object(x)
+		return t, false, err
+	case string:
+		return dql.Term{Kind: dql.TermLiteral, Value: x, Lang: lang}, false, nil
+	case json.Number:
+		dt := "xs:int"
+		if strings.ContainsAny(x.String(), ".eE") {
+			dt = "xs:float"
+		}
+		return dql.Term{Kind: dql.TermLiteral, Value: x.String(), DataType: dt}, false, nil
+	case bool:
+		return dql.Term{Kind: dql.TermLiteral, Value: fmt.Sprint(x), DataType: "xs:boolean"}, false, nil
+	}
+	return dql.Term{}, false, fmt.Errorf("dquelytest: json mutation: unsupported value %v", v)
+}
@@ -0,0 +1,277 @@
+package dquelytest
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+// mutator applies the mutations of one request to a transaction's view.
+type mutator struct {
+	txn   *graphTxn
+	env   *env
+	uids  map[string]string // blank-node name -> uid, returned in api.Response.Uids
+	blank map[string]uint64
+}
+
+func (m *mutator) apply(mu *api.Mutation) error {
+	if len(mu.Set) > 0 || len(mu.Del) > 0 {
+		return fmt.Errorf("%w: only N-Quad and JSON mutations", errUnsupported)
+	}
+	cond, err := dql.ParseCondition(mu.Cond)
+	if err != nil {
+		return fmt.Errorf("dquelytest: condition: %w", err)
+	}
+	if cond != nil {
+		ok, err := m.env.match(0, cond)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	dels, err := dql.ParseNQuads(string(mu.DelNquads))
+	if err != nil {
+		return fmt.Errorf("dquelytest: delete: %w", err)
+	}
+	sets, err := dql.ParseNQuads(string(mu.SetNquads))
+	if err != nil {
+		return fmt.Errorf("dquelytest: set: %w", err)
+	}
+	jsonDels, err := jsonQuads(mu.DeleteJson, true)
+	if err != nil {
+		return err
+	}
+	jsonSets, err := jsonQuads(mu.SetJson, false)
+	if err != nil {
+		return err
+	}
+	dels, sets = append(dels, jsonDels...), append(sets, jsonSets...)
+	// Like Dgraph, deletions are applied before additions.
+	for _, q := range dels {
+		if err := m.delete(q); err != nil {
+			return err
+		}
+	}
+	for _, q := range sets {
+		if err := m.set(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blankUID returns the uid assigned to a blank node in this request.
+func (m *mutator) blankUID(name string) uint64 {
+	if u, ok := m.blank[name]; ok {
+		return u
+	}
+	u := m.txn.g.allocate()
+	m.blank[name] = u
+	m.uids[name] = formatUID(u)
+	return u
+}
+
+// nodes resolves a subject or uid object to node uids. An empty uid variable
+// allocates a new node when create is set, as in Dgraph upserts.
+func (m *mutator) nodes(t dql.Term, create bool) ([]uint64, error) {
+	switch t.Kind {
+	case dql.TermUID:
+		u, err := parseUID(t.Value)
+		if err != nil {
+			return nil, fmt.Errorf("dquelytest: %w", err)
+		}
+		if !m.txn.g.leased(u) {
+			return nil, fmt.Errorf("dquelytest: uid %s has not been allocated", formatUID(u))
+		}
+		return []uint64{u}, nil
+	case dql.TermBlank:
+		return []uint64{m.blankUID(t.Value)}, nil
+	case dql.TermUIDVar:
+		uids, ok := m.env.uidVars[t.Value]
+		if !ok {
+			return nil, fmt.Errorf("dquelytest: variable %s is used but not defined", t.Value)
+		}
+		if len(uids) == 0 && create {
+			return []uint64{m.blankUID("uid(" + t.Value + ")")}, nil
+		}
+		return uids, nil
+	}
+	return nil, fmt.Errorf("dquelytest: invalid node reference")
+}
+
+// objects resolves the object of q for subject.
+func (m *mutator) objects(subject uint64, q dql.NQuad) ([]value, error) {
+	switch q.Object.Kind {
+	case dql.TermUID, dql.TermBlank, dql.TermUIDVar:
+		uids, err := m.nodes(q.Object, true)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]value, len(uids))
+		for i, u := range uids {
+			out[i] = uidValue(u)
+		}
+		return out, nil
+	case dql.TermValVar:
+		vals, ok := m.env.valVars[q.Object.Value]
+		if !ok {
+			return nil, fmt.Errorf("dquelytest: variable %s is used but not defined", q.Object.Value)
+		}
+		if v, ok := vals[subject]; ok {
+			return []value{v}, nil
+		}
+		return nil, nil
+	case dql.TermLiteral:
+		typ := m.txn.view.schema.typeOf(q.Predicate)
+		if dt, ok := xsdTypes[q.Object.DataType]; ok && (typ == typeDefault || m.txn.view.schema.pred(q.Predicate) == nil) {
+			typ = dt
+		}
+		if typ == typeUID {
+			return nil, fmt.Errorf("dquelytest: input for predicate %s of type uid is a scalar", q.Predicate)
+		}
+		v, err := convert(q.Object.Value, typ)
+		if err != nil {
+			return nil, fmt.Errorf("dquelytest: predicate %s: %w", q.Predicate, err)
+		}
+		return []value{v}, nil
+	}
+	return nil, fmt.Errorf("dquelytest: invalid object for predicate %s", q.Predicate)
+}
+
+func (m *mutator) set(q dql.NQuad) error {
+	if q.Predicate == "*" || q.Object.Kind == dql.TermStar {
+		return fmt.Errorf("dquelytest: wildcards are only allowed in deletions")
+	}
+	subjects, err := m.nodes(q.Subject, true)
+	if err != nil {
+		return err
+	}
+	s := m.txn.view
+	for _, subj := range subjects {
+		vals, err := m.objects(subj, q)
+		if err != nil {
+			return err
+		}
+		for _, v := range vals {
+			p := s.schema.pred(q.Predicate)
+			if p == nil {
+				// Infer the schema from the first value, as Dgraph does.
+				p = &predicate{typ: v.typ, list: v.typ == typeUID}
+				s.schema.preds[q.Predicate] = p
+			}
+			if (p.typ == typeUID) != (v.typ == typeUID) {
+				return fmt.Errorf("dquelytest: predicate %s of type %s cannot hold %s", q.Predicate, p.typ, v.text())
+			}
+			if v.typ != p.typ && v.typ != typeUID {
+				if v, err = convert(v.text(), p.typ); err != nil {
+					return fmt.Errorf("dquelytest: predicate %s: %w", q.Predicate, err)
+				}
+			}
+			if p.unique && m.taken(subj, q.Predicate, v) {
+				// Dgraph's own message, which dquely maps to a DuplicateError.
+				return fmt.Errorf("could not insert duplicate value [%s] for predicate [%s]", v.text(), q.Predicate)
+			}
+			preds := s.nodes[subj]
+			if preds == nil {
+				preds = map[string][]value{}
+				s.nodes[subj] = preds
+			}
+			old := preds[q.Predicate]
+			m.touch(subj, q.Predicate, p, old)
+			if !p.list {
+				preds[q.Predicate] = []value{v}
+			} else if !containsValue(old, v) {
+				preds[q.Predicate] = append(old, v)
+			}
+			m.touch(subj, q.Predicate, p, []value{v})
+		}
+	}
+	return nil
+}
+
+// taken reports whether a node other than subj holds v on the @unique predicate pred.
+func (m *mutator) taken(subj uint64, pred string, v value) bool {
+	for uid, preds := range m.txn.view.nodes {
+		if uid != subj && containsValue(preds[pred], v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mutator) delete(q dql.NQuad) error {
+	subjects, err := m.nodes(q.Subject, false)
+	if err != nil {
+		return err
+	}
+	s := m.txn.view
+	for _, subj := range subjects {
+		preds := s.nodes[subj]
+		if preds == nil {
+			continue
+		}
+		names := []string{q.Predicate}
+		if q.Predicate == "*" {
+			names = names[:0]
+			for name := range preds {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			old := preds[name]
+			if len(old) == 0 {
+				continue
+			}
+			p := s.schema.pred(name)
+			m.touch(subj, name, p, old)
+			if q.Object.Kind == dql.TermStar {
+				delete(preds, name)
+				continue
+			}
+			vals, err := m.objects(subj, dql.NQuad{Subject: q.Subject, Predicate: name, Object: q.Object})
+			if err != nil {
+				return err
+			}
+			kept := old[:0:0]
+			for _, v := range old {
+				if !containsValue(vals, v) {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == 0 {
+				delete(preds, name)
+			} else {
+				preds[name] = kept
+			}
+		}
+		if len(preds) == 0 {
+			delete(s.nodes, subj)
+		}
+	}
+	return nil
+}
+
+// touch records a write of pred on uid, plus the index entries of vals when the
+// predicate has @upsert, so that conflicting transactions abort on commit.
+func (m *mutator) touch(uid uint64, pred string, p *predicate, vals []value) {
+	k := writeKey{uid: uid, pred: pred}
+	m.txn.writes[conflictKey(k)] = k
+	if p == nil || !p.upsert {
+		return
+	}
+	for _, v := range vals {
+		m.txn.writes["index|"+pred+"|"+v.text()] = writeKey{pred: pred}
+	}
+}
+
+func containsValue(vals []value, v value) bool {
+	for _, w := range vals {
+		if c, ok := compare(w, v); ok && c == 0 && (w.typ == typeUID) == (v.typ == typeUID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package dquelytest
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/vibros68/dquely"
+)
+
+// predicate is the schema of a single predicate.
+type predicate struct {
+	typ    string
+	list   bool
+	upsert bool
+	unique bool
+	def    *dquely.PredicateSchema // as applied through Alter; nil when inferred
+}
+
+// schema holds the predicate and type definitions applied through Alter.
+type schema struct {
+	preds map[string]*predicate
+	types map[string][]string
+}
+
+func newSchema() *schema {
+	return &schema{
+		preds: map[string]*predicate{
+			"dgraph.type": {typ: typeString, list: true},
+		},
+		types: map[string][]string{},
+	}
+}
+
+func (s *schema) clone() *schema {
+	c := &schema{preds: make(map[string]*predicate, len(s.preds)), types: make(map[string][]string, len(s.types))}
+	for k, p := range s.preds {
+		cp := *p
+		c.preds[k] = &cp
+	}
+	for k, fields := range s.types {
+		c.types[k] = append([]string(nil), fields...)
+	}
+	return c
+}
+
+// pred returns the schema of name, or nil when it has none.
+func (s *schema) pred(name string) *predicate {
+	return s.preds[name]
+}
+
+// typeOf returns the scalar type of name, typeDefault when it has no schema.
+func (s *schema) typeOf(name string) string {
+	if p := s.preds[name]; p != nil {
+		return p.typ
+	}
+	return typeDefault
+}
+
+// apply parses schema text such as
+//
+//	name: string @index(exact) @upsert .
+//	friends: [uid] @reverse .
+//	type User { name friends }
+//
+// and merges it into s. Indexes and @reverse are recorded for schema queries but
+// not needed: every function works on every predicate and every edge can be
+// followed in reverse. @unique is enforced on writes.
+func (s *schema) apply(text string) error {
+	parsed, err := dquely.ParseSchema(text)
+	if err != nil {
+		return err
+	}
+	for name, def := range parsed.Predicates {
+		p := &predicate{typ: def.Type, list: def.List, upsert: def.Upsert, unique: def.Unique, def: def}
+		switch p.typ {
+		case "geo", "password", "float32vector":
+			p.typ = typeString
+		}
+		s.preds[name] = p
+	}
+	for name, fields := range parsed.Types {
+		s.types[name] = fields
+	}
+	return nil
+}
+
+// fieldsOf returns the predicates of the given types, in definition order.
+func (s *schema) fieldsOf(types []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range types {
+		for _, f := range s.types[t] {
+			if !seen[f] {
+				seen[f] = true
+				out = append(out, f)
+			}
+		}
+	}
+	return out
+}
+
+// schemaJSON answers a "schema {}" query in Dgraph's response format.
+func (s *schema) schemaJSON() ([]byte, error) {
+	type predJSON struct {
+		Predicate string   `json:"predicate"`
+		Type      string   `json:"type"`
+		Index     bool     `json:"index,omitempty"`
+		Tokenizer []string `json:"tokenizer,omitempty"`
+		Reverse   bool     `json:"reverse,omitempty"`
+		Count     bool     `json:"count,omitempty"`
+		List      bool     `json:"list,omitempty"`
+		Upsert    bool     `json:"upsert,omitempty"`
+		Lang      bool     `json:"lang,omitempty"`
+		Unique    bool     `json:"unique,omitempty"`
+	}
+	type fieldJSON struct {
+		Name string `json:"name"`
+	}
+	type typeJSON struct {
+		Name   string      `json:"name"`
+		Fields []fieldJSON `json:"fields"`
+	}
+	out := struct {
+		Schema []predJSON `json:"schema"`
+		Types  []typeJSON `json:"types,omitempty"`
+	}{}
+	for name, p := range s.preds {
+		pj := predJSON{Predicate: name, Type: p.typ, List: p.list, Upsert: p.upsert}
+		if d := p.def; d != nil {
+			pj.Type, pj.Tokenizer, pj.Index = d.Type, d.Tokenizers, len(d.Tokenizers) > 0
+			pj.Reverse, pj.Count, pj.Lang, pj.Unique = d.Reverse, d.Count, d.Lang, d.Unique
+		}
+		out.Schema = append(out.Schema, pj)
+	}
+	sort.Slice(out.Schema, func(i, j int) bool { return out.Schema[i].Predicate < out.Schema[j].Predicate })
+	for name, fields := range s.types {
+		tj := typeJSON{Name: name, Fields: []fieldJSON{}}
+		for _, f := range fields {
+			tj.Fields = append(tj.Fields, fieldJSON{Name: f})
+		}
+		out.Types = append(out.Types, tj)
+	}
+	sort.Slice(out.Types, func(i, j int) bool { return out.Types[i].Name < out.Types[j].Name })
+	return json.Marshal(out)
+}
@@ -0,0 +1,208 @@
+package dquelytest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scalar types understood by Graph. Predicates without a schema entry use typeDefault,
+// which behaves like a string.
+const (
+	typeDefault  = "default"
+	typeString   = "string"
+	typeInt      = "int"
+	typeFloat    = "float"
+	typeBool     = "bool"
+	typeDateTime = "datetime"
+	typeUID      = "uid"
+)
+
+// xsdTypes maps RDF datatypes to scalar types.
+var xsdTypes = map[string]string{
+	"xs:string": typeString, "xs:int": typeInt, "xs:integer": typeInt,
+	"xs:float": typeFloat, "xs:double": typeFloat, "xs:decimal": typeFloat,
+	"xs:boolean": typeBool, "xs:dateTime": typeDateTime, "xs:date": typeDateTime,
+}
+
+// dateTimeLayouts are the datetime formats accepted in mutations and filters.
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// value is a single value of a predicate: an edge when typ is typeUID, a scalar
+// otherwise. v holds a uint64, string, int64, float64, bool or time.Time.
+type value struct {
+	typ string
+	v   any
+}
+
+func uidValue(uid uint64) value {
+	return value{typ: typeUID, v: uid}
+}
+
+func (v value) uid() uint64 {
+	u, _ := v.v.(uint64)
+	return u
+}
+
+// convert parses s as a scalar of type typ.
+func convert(s, typ string) (value, error) {
+	switch typ {
+	case typeInt:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if ferr != nil || f != math.Trunc(f) {
+				return value{}, fmt.Errorf("cannot convert %q to int", s)
+			}
+			i = int64(f)
+		}
+		return value{typ: typ, v: i}, nil
+	case typeFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return value{}, fmt.Errorf("cannot convert %q to float", s)
+		}
+		return value{typ: typ, v: f}, nil
+	case typeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return value{}, fmt.Errorf("cannot convert %q to bool", s)
+		}
+		return value{typ: typ, v: b}, nil
+	case typeDateTime:
+		t, err := parseDateTime(s)
+		if err != nil {
+			return value{}, err
+		}
+		return value{typ: typ, v: t}, nil
+	case typeUID:
+		u, err := parseUID(s)
+		if err != nil {
+			return value{}, err
+		}
+		return uidValue(u), nil
+	case typeString:
+		return value{typ: typeString, v: s}, nil
+	default:
+		return value{typ: typeDefault, v: s}, nil
+	}
+}
+
+func parseDateTime(s string) (time.Time, error) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %q to datetime", s)
+}
+
+// parseUID parses a uid written as hex (0x1) or decimal.
+func parseUID(s string) (uint64, error) {
+	u, err := strconv.ParseUint(strings.TrimSpace(s), 0, 64)
+	if err != nil || u == 0 {
+		return 0, fmt.Errorf("invalid uid %q", s)
+	}
+	return u, nil
+}
+
+func formatUID(u uint64) string {
+	return fmt.Sprintf("0x%x", u)
+}
+
+// text returns the value as a string, as used by string functions.
+func (v value) text() string {
+	switch x := v.v.(type) {
+	case string:
+		return x
+	case uint64:
+		return formatUID(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// json returns the value as Dgraph renders it in a response.
+func (v value) json() any {
+	switch x := v.v.(type) {
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case uint64:
+		return formatUID(x)
+	default:
+		return x
+	}
+}
+
+// compare orders v against w, converting w to v's type when they differ. ok is
+// false when the values cannot be compared.
+func compare(v, w value) (c int, ok bool) {
+	if v.typ != w.typ {
+		typ := v.typ
+		switch {
+		case typ == typeDefault || typ == typeString:
+			typ = w.typ
+		case typ == typeInt && w.typ == typeFloat:
+			typ = typeFloat
+		}
+		var err error
+		if v, err = convert(v.text(), typ); err != nil {
+			return 0, false
+		}
+		if w, err = convert(w.text(), typ); err != nil {
+			return 0, false
+		}
+	}
+	switch a := v.v.(type) {
+	case int64:
+		return cmpOrdered(a, w.v.(int64)), true
+	case float64:
+		return cmpOrdered(a, w.v.(float64)), true
+	case uint64:
+		return cmpOrdered(a, w.v.(uint64)), true
+	case string:
+		return strings.Compare(a, w.v.(string)), true
+	case bool:
+		b := w.v.(bool)
+		switch {
+		case a == b:
+			return 0, true
+		case !a:
+			return -1, true
+		default:
+			return 1, true
+		}
+	case time.Time:
+		return a.Compare(w.v.(time.Time)), true
+	}
+	return 0, false
+}
+
+func cmpOrdered[T int64 | float64 | uint64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// tokens splits s into lower-cased terms for the term and full-text functions.
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r > 127)
+	})
+}
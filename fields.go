@@ -0,0 +1,186 @@
+package dquely
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// fieldCache holds the structFields of every struct type seen.
+var fieldCache sync.Map // reflect.Type -> []reflect.StructField
+
+// structFields returns the fields of the struct type t in declaration order. As in
+// encoding/json, the fields of an embedded struct, or pointer to struct, without a
+// dquely tag are promoted into t in its place, and a promoted field is hidden by a
+// shallower field with the same predicate. Index is the path from t, for fieldByIndex.
+func structFields(t reflect.Type) []reflect.StructField {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]reflect.StructField)
+	}
+	all := appendFields(nil, t, nil, map[reflect.Type]bool{t: true})
+	depth := make(map[string]int, len(all))
+	for _, f := range all {
+		p, _, _ := parseTag(f.Tag.Get("dquely"), f.Name)
+		if d, ok := depth[p]; !ok || len(f.Index) < d {
+			depth[p] = len(f.Index)
+		}
+	}
+	fields := make([]reflect.StructField, 0, len(all))
+	for _, f := range all {
+		if p, _, _ := parseTag(f.Tag.Get("dquely"), f.Name); len(f.Index) == depth[p] {
+			fields = append(fields, f)
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func appendFields(fields []reflect.StructField, t reflect.Type, index []int, visiting map[reflect.Type]bool) []reflect.StructField {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		f.Index = append(slices.Clone(index), i)
+		if et, ok := embeddedStruct(f); ok && !visiting[et] {
+			visiting[et] = true
+			fields = appendFields(fields, et, f.Index, visiting)
+			delete(visiting, et)
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// embeddedStruct returns the struct type of f when its fields are promoted.
+func embeddedStruct(f reflect.StructField) (reflect.Type, bool) {
+	if !f.Anonymous || f.Tag.Get("dquely") != "" {
+		return nil, false
+	}
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if _, ok := optionalElem(t); ok || t.Kind() != reflect.Struct || t == timeType {
+		return nil, false
+	}
+	return t, true
+}
+
+// fieldByIndex returns the field of the struct v at index, or the zero value of the
+// field when a nil embedded pointer is on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	if len(index) == 1 {
+		return v.Field(index[0])
+	}
+	fv, err := v.FieldByIndexErr(index)
+	if err != nil {
+		return reflect.Zero(v.Type().FieldByIndex(index).Type)
+	}
+	return fv
+}
+
+// settableField is fieldByIndex for writes: nil embedded pointers on the way are
+// allocated. It returns an invalid Value when one cannot be.
+func settableField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// isInterfaceEdge reports whether fields of type t are polymorphic edges: a non-empty
+// interface, or a slice of them, resolved at run time to the struct it holds. Fields
+// of type any keep being written as scalars.
+func isInterfaceEdge(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Interface && t.NumMethod() > 0
+}
+
+// concreteNode returns the struct held by the interface value fv, directly or through
+// a pointer. ok is false when fv is nil; an error is returned when it holds anything
+// but a struct with a uid field.
+func concreteNode(fv reflect.Value) (node reflect.Value, ok bool, err error) {
+	if fv.IsNil() {
+		return reflect.Value{}, false, nil
+	}
+	e := fv.Elem()
+	if e.Kind() == reflect.Ptr {
+		if e.IsNil() {
+			return reflect.Value{}, false, nil
+		}
+		e = e.Elem()
+	}
+	if e.Kind() != reflect.Struct || !hasUIDField(e.Type()) {
+		return reflect.Value{}, false, fmt.Errorf("dquely: %s holds %s, not a struct with a uid field", fv.Type(), fv.Elem().Type())
+	}
+	return e, true, nil
+}
+
+// nodeType returns the dgraph.type of the struct v: its DgraphType() when it implements
+// DgraphMutation, else the struct name.
+func nodeType(v reflect.Value) string {
+	switch {
+	case v.CanAddr() && v.Addr().CanInterface():
+		return dgraphTypeOf(v.Addr().Interface())
+	case v.CanInterface():
+		return dgraphTypeOf(v.Interface())
+	}
+	return v.Type().Name()
+}
+
+// eachNode calls fn with the struct v and every struct reachable from it through its
+// edges, including those held by interface edges. A struct reached by pointer is
+// visited once.
+func eachNode(v reflect.Value, fn func(node reflect.Value)) {
+	seen := map[nodeKey]bool{}
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		if v.CanAddr() {
+			key := nodeKey{v.Addr().Pointer(), v.Type()}
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+		}
+		fn(v)
+		for _, field := range structFields(v.Type()) {
+			if field.Tag.Get("dquely") == "-" || !field.IsExported() || !isEdgeType(field.Type) {
+				continue
+			}
+			fv := fieldByIndex(v, field.Index)
+			values := []reflect.Value{fv}
+			if fv.Kind() == reflect.Slice {
+				values = make([]reflect.Value, fv.Len())
+				for i := range values {
+					values[i] = fv.Index(i)
+				}
+			}
+			for _, ev := range values {
+				switch ev.Kind() {
+				case reflect.Ptr:
+					if !ev.IsNil() {
+						walk(ev.Elem())
+					}
+				case reflect.Interface:
+					if node, ok, _ := concreteNode(ev); ok {
+						walk(node)
+					}
+				default:
+					walk(ev)
+				}
+			}
+		}
+	}
+	walk(v)
+}
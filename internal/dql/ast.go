@@ -0,0 +1,118 @@
+// Package dql parses the subset of DQL and RDF N-Quads that dquely generates into
+// a syntax tree. It is shared by the public parsing helpers and the in-memory
+// engine in dquelytest.
+package dql
+
+// Document is a parsed DQL query: the blocks between the outer braces.
+type Document struct {
+	Name   string     // operation name of "query name { ... }", empty for a bare "{ ... }"
+	Vars   []Variable // variables declared in "query name($a: string = "x") { ... }"
+	Blocks []*Block
+}
+
+// Variable is a query variable declaration.
+type Variable struct {
+	Name    string // without the leading "$"
+	Type    string // e.g. "string", "int!"
+	Default *Value // nil when the declaration has no default
+}
+
+// Block is a top-level query block such as "me(func: eq(name, "x")) { ... }" or
+// "v as var(func: type(User))".
+type Block struct {
+	Var        string // "v" in "v as var(...)"
+	Name       string // the block name; "var" for variable blocks
+	Func       *Func  // root function; nil when the block has no func argument
+	Args       []Arg  // first, offset, after, orderasc and orderdesc in source order
+	Filter     *Filter
+	Directives []Directive // every directive except @filter, in source order
+	Fields     []*Field
+	HasBody    bool // false for blocks written without braces
+}
+
+// Field is a selection inside a block: a predicate, "uid", or a function such as
+// count(friends), val(a) or expand(_all_), optionally with a nested selection.
+type Field struct {
+	Alias      string // "n" in "n: count(friends)"
+	Var        string // "a" in "a as age"
+	Name       string // the predicate; empty when Func is set
+	Func       *Func
+	Args       []Arg
+	Filter     *Filter
+	Directives []Directive
+	Fields     []*Field
+	HasBody    bool // true when the field has a "{ ... }" selection, even an empty one
+}
+
+// Key returns the JSON key Dgraph uses for the field in a response.
+func (f *Field) Key() string {
+	switch {
+	case f.Alias != "":
+		return f.Alias
+	case f.Func != nil:
+		return f.Func.String()
+	default:
+		return f.Name
+	}
+}
+
+// Arg is a named argument such as "first: 10" or "orderasc: name".
+type Arg struct {
+	Name  string
+	Value Value
+}
+
+// Directive is an "@name" or "@name(args)" directive other than @filter.
+type Directive struct {
+	Name string
+	Args []Arg // positional arguments have an empty Name
+}
+
+// Func is a function call such as eq(name, "Alice") or uid(v).
+type Func struct {
+	Name   string
+	Args   []Value
+	Filter *Filter // the filter of count(pred @filter(...))
+}
+
+// ValueKind identifies the form of a Value.
+type ValueKind int
+
+const (
+	Ident    ValueKind = iota // a predicate, variable, type name or uid literal
+	String                    // a double-quoted string; Text holds the unquoted value
+	Number                    // an integer or float literal
+	Regex                     // /pattern/flags; Text holds the pattern
+	FuncCall                  // a nested call such as val(a), count(p) or uid(v)
+	List                      // [a, b, ...]
+	Param                     // a $parameter reference
+	Expr                      // the expression of math(...); Text holds it verbatim
+)
+
+// Value is a function argument or argument value.
+type Value struct {
+	Kind  ValueKind
+	Text  string
+	Flags string  // regex flags
+	Func  *Func   // set for FuncCall
+	List  []Value // set for List
+}
+
+// FilterOp identifies the kind of a Filter node.
+type FilterOp int
+
+const (
+	FilterFunc FilterOp = iota // a single function
+	FilterAnd
+	FilterOr
+	FilterNot
+)
+
+// Filter is a boolean tree of functions, used by @filter and @if.
+type Filter struct {
+	Op   FilterOp
+	Func *Func     // set for FilterFunc
+	Args []*Filter // operands of And, Or (two or more) and Not (exactly one)
+
+	chain bool // set while the parser extends an ungrouped "a AND b AND c" chain
+}
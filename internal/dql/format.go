@@ -0,0 +1,83 @@
+package dql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// String renders the call as DQL, e.g. `eq(name, "Alice")`.
+func (f *Func) String() string {
+	parts := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		parts[i] = a.String()
+	}
+	if f.Filter != nil {
+		return f.Name + "(" + strings.Join(parts, ", ") + " @filter(" + f.Filter.String() + "))"
+	}
+	return f.Name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// String renders the value as DQL.
+func (v Value) String() string {
+	switch v.Kind {
+	case String:
+		return quote(v.Text)
+	case Regex:
+		return "/" + v.Text + "/" + v.Flags
+	case FuncCall:
+		return v.Func.String()
+	case List:
+		parts := make([]string, len(v.List))
+		for i, item := range v.List {
+			parts[i] = item.String()
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case Param:
+		return "$" + v.Text
+	default:
+		return v.Text
+	}
+}
+
+// String renders the filter as DQL, parenthesising nested boolean groups.
+func (f *Filter) String() string {
+	switch f.Op {
+	case FilterFunc:
+		return f.Func.String()
+	case FilterNot:
+		return "NOT " + f.Args[0].group()
+	default:
+		sep := " AND "
+		if f.Op == FilterOr {
+			sep = " OR "
+		}
+		parts := make([]string, len(f.Args))
+		for i, a := range f.Args {
+			parts[i] = a.group()
+		}
+		return strings.Join(parts, sep)
+	}
+}
+
+// group renders f, wrapping AND and OR nodes in parentheses.
+func (f *Filter) group() string {
+	if f.Op == FilterAnd || f.Op == FilterOr {
+		return "(" + f.String() + ")"
+	}
+	return f.String()
+}
+
+// quote renders s as a double-quoted DQL string.
+func quote(s string) string {
+	return strconv.Quote(s)
+}
+
+// isNumber reports whether s is a decimal integer or float literal.
+func isNumber(s string) bool {
+	t := strings.TrimLeft(s, "+-")
+	if t == "" || !('0' <= t[0] && t[0] <= '9' || t[0] == '.') || strings.ContainsAny(t, "xX_") {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
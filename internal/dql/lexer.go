@@ -0,0 +1,217 @@
+package dql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind identifies a lexical token.
+type tokenKind int
+
+const (
+	tokEOF  tokenKind = iota
+	tokWord           // identifiers, predicates, uids and numbers
+	tokString
+	tokRegex
+	tokParam
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // unquoted text for strings, the pattern for regexes
+	flags string // regex flags
+	pos   int
+}
+
+// lexer splits DQL source into tokens.
+type lexer struct {
+	src string
+	pos int
+}
+
+// isWordByte reports whether c can appear in a word token. Words cover predicate
+// names (dgraph.type, ~friend), uids (0x1), numbers (-1.5e3) and keywords.
+func isWordByte(c byte) bool {
+	return c == '_' || c == '.' || c == '~' || c == '-' || c == '+' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c >= utf8.RuneSelf
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpace()
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case c == '"':
+		s, err := l.readString()
+		return token{kind: tokString, text: s, pos: start}, err
+	case c == '/':
+		return l.readRegex()
+	case c == '<':
+		end := strings.IndexByte(l.src[l.pos:], '>')
+		if end < 0 {
+			return token{}, l.errorf(start, "unterminated <predicate>")
+		}
+		l.pos += end + 1
+		return token{kind: tokWord, text: l.src[start+1 : l.pos-1], pos: start}, nil
+	case c == '$':
+		l.pos++
+		for l.pos < len(l.src) && isWordByte(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokParam, text: l.src[start+1 : l.pos], pos: start}, nil
+	case isWordByte(c):
+		for l.pos < len(l.src) && isWordByte(l.src[l.pos]) {
+			l.pos++
+		}
+		l.langTag()
+		return token{kind: tokWord, text: l.src[start:l.pos], pos: start}, nil
+	case c == '&' || c == '|':
+		if l.pos+1 < len(l.src) && l.src[l.pos+1] == c {
+			l.pos += 2
+			return token{kind: tokWord, text: l.src[start:l.pos], pos: start}, nil
+		}
+	case strings.IndexByte("{}()[],:@!=", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, text: string(c), pos: start}, nil
+	}
+	return token{}, l.errorf(start, "unexpected character %q", c)
+}
+
+// directives are the names that follow "@" as a directive rather than a
+// language tag, e.g. "friends@filter(...)" versus "name@en".
+var directives = map[string]bool{
+	"filter": true, "cascade": true, "groupby": true, "normalize": true, "recurse": true,
+	"facets": true, "ignorereflex": true, "if": true,
+}
+
+// langTag extends the word just read with a language tag such as "@en",
+// "@en:fr" or "@.", when one follows without whitespace.
+func (l *lexer) langTag() {
+	if l.pos >= len(l.src) || l.src[l.pos] != '@' {
+		return
+	}
+	end := l.pos + 1
+	for end < len(l.src) && (isWordByte(l.src[end]) && l.src[end] != '~' || l.src[end] == ':' || l.src[end] == '*') {
+		end++
+	}
+	tag := l.src[l.pos+1 : end]
+	if tag == "" || directives[tag] {
+		return
+	}
+	l.pos = end
+}
+
+// readString reads a double-quoted string, resolving escape sequences.
+func (l *lexer) readString() (string, error) {
+	start := l.pos
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return sb.String(), nil
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return "", l.errorf(start, "unterminated string")
+			}
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if l.pos+n >= len(l.src) {
+					return "", l.errorf(l.pos, "invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(l.src[l.pos+1:l.pos+1+n], 16, 32)
+				if err != nil {
+					return "", l.errorf(l.pos, "invalid unicode escape")
+				}
+				sb.WriteRune(rune(r))
+				l.pos += n
+			default:
+				sb.WriteByte(e)
+			}
+			l.pos++
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return "", l.errorf(start, "unterminated string")
+}
+
+// readRegex reads /pattern/flags. A backslash escapes the next character.
+func (l *lexer) readRegex() (token, error) {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.src) && l.src[l.pos] != '/' {
+		if l.src[l.pos] == '\\' {
+			l.pos++
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{}, l.errorf(start, "unterminated regular expression")
+	}
+	pattern := l.src[start+1 : l.pos]
+	l.pos++
+	flagStart := l.pos
+	for l.pos < len(l.src) && ('a' <= l.src[l.pos] && l.src[l.pos] <= 'z') {
+		l.pos++
+	}
+	return token{kind: tokRegex, text: pattern, flags: l.src[flagStart:l.pos], pos: start}, nil
+}
+
+func (l *lexer) errorf(pos int, format string, args ...any) error {
+	return posErrorf(l.src, pos, format, args...)
+}
+
+// posErrorf formats an error prefixed with the line and column of pos in src.
+func posErrorf(src string, pos int, format string, args ...any) error {
+	line, col := 1, 1
+	for i := 0; i < pos && i < len(src); i++ {
+		if src[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Errorf("dql: line %d col %d: %s", line, col, fmt.Sprintf(format, args...))
+}
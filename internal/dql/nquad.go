@@ -0,0 +1,164 @@
+package dql
+
+import "strings"
+
+// TermKind identifies the form of an N-Quad subject or object.
+type TermKind int
+
+const (
+	TermUID     TermKind = iota // <0x1>
+	TermBlank                   // _:name; Value holds the name without "_:"
+	TermUIDVar                  // uid(v); Value holds the variable
+	TermValVar                  // val(a); Value holds the variable
+	TermLiteral                 // "text", optionally typed or language-tagged
+	TermStar                    // *, only valid in deletions
+)
+
+// Term is the subject or object of an N-Quad.
+type Term struct {
+	Kind     TermKind
+	Value    string
+	DataType string // the IRI of ^^<type>, e.g. "xs:int"
+	Lang     string // the tag of @lang
+}
+
+// NQuad is a single "subject <predicate> object ." statement. Predicate is "*"
+// for "S * *" deletions.
+type NQuad struct {
+	Subject   Term
+	Predicate string
+	Object    Term
+}
+
+// ParseNQuads parses RDF N-Quads as used by Dgraph mutations, including the
+// uid(v) and val(a) references of upserts.
+func ParseNQuads(src string) ([]NQuad, error) {
+	l := &lexer{src: src}
+	var out []NQuad
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.src) {
+			return out, nil
+		}
+		var (
+			q   NQuad
+			err error
+		)
+		if q.Subject, err = l.term(); err != nil {
+			return nil, err
+		}
+		switch q.Subject.Kind {
+		case TermLiteral, TermValVar, TermStar:
+			return nil, l.errorf(l.pos, "invalid subject")
+		}
+		l.skipSpace()
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], "*"):
+			q.Predicate = "*"
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "<"):
+			if q.Predicate, err = l.iri(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, l.errorf(l.pos, "expected a <predicate>")
+		}
+		if q.Object, err = l.term(); err != nil {
+			return nil, err
+		}
+		l.skipSpace()
+		if strings.HasPrefix(l.src[l.pos:], "<") {
+			// The graph label of exports, e.g. the namespace <0x0>, is ignored.
+			if _, err := l.iri(); err != nil {
+				return nil, err
+			}
+			l.skipSpace()
+		}
+		if strings.HasPrefix(l.src[l.pos:], "(") {
+			return nil, l.errorf(l.pos, "facets are not supported")
+		}
+		if !strings.HasPrefix(l.src[l.pos:], ".") {
+			return nil, l.errorf(l.pos, "expected \".\" at the end of the statement")
+		}
+		l.pos++
+		out = append(out, q)
+	}
+}
+
+// iri reads "<...>" and returns its content.
+func (l *lexer) iri() (string, error) {
+	end := strings.IndexByte(l.src[l.pos:], '>')
+	if end < 0 {
+		return "", l.errorf(l.pos, "unterminated <iri>")
+	}
+	s := l.src[l.pos+1 : l.pos+end]
+	l.pos += end + 1
+	return s, nil
+}
+
+// term reads an N-Quad subject or object.
+func (l *lexer) term() (Term, error) {
+	l.skipSpace()
+	rest := l.src[l.pos:]
+	switch {
+	case rest == "":
+		return Term{}, l.errorf(l.pos, "unexpected end of input")
+	case rest[0] == '<':
+		s, err := l.iri()
+		return Term{Kind: TermUID, Value: s}, err
+	case strings.HasPrefix(rest, "_:"):
+		start := l.pos + 2
+		l.pos = start
+		for l.pos < len(l.src) && isWordByte(l.src[l.pos]) && l.src[l.pos] != '~' {
+			l.pos++
+		}
+		// A trailing dot terminates the statement rather than the name.
+		for l.pos > start && l.src[l.pos-1] == '.' {
+			l.pos--
+		}
+		if l.pos == start {
+			return Term{}, l.errorf(start, "empty blank node name")
+		}
+		return Term{Kind: TermBlank, Value: l.src[start:l.pos]}, nil
+	case strings.HasPrefix(rest, "uid(") || strings.HasPrefix(rest, "val("):
+		kind := TermUIDVar
+		if rest[0] == 'v' {
+			kind = TermValVar
+		}
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return Term{}, l.errorf(l.pos, "unterminated %s", rest[:3])
+		}
+		name := strings.TrimSpace(rest[4:end])
+		l.pos += end + 1
+		return Term{Kind: kind, Value: name}, nil
+	case rest[0] == '*':
+		l.pos++
+		return Term{Kind: TermStar}, nil
+	case rest[0] == '"':
+		s, err := l.readString()
+		if err != nil {
+			return Term{}, err
+		}
+		t := Term{Kind: TermLiteral, Value: s}
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], "^^"):
+			l.pos += 2
+			if !strings.HasPrefix(l.src[l.pos:], "<") {
+				return Term{}, l.errorf(l.pos, "expected a <datatype>")
+			}
+			if t.DataType, err = l.iri(); err != nil {
+				return Term{}, err
+			}
+		case strings.HasPrefix(l.src[l.pos:], "@"):
+			start := l.pos + 1
+			l.pos = start
+			for l.pos < len(l.src) && (isWordByte(l.src[l.pos]) && l.src[l.pos] != '.') {
+				l.pos++
+			}
+			t.Lang = l.src[start:l.pos]
+		}
+		return t, nil
+	}
+	return Term{}, l.errorf(l.pos, "unexpected %q", rest[0])
+}
@@ -0,0 +1,690 @@
+package dql
+
+import (
+	"strings"
+)
+
+// valueFuncs are the functions that may appear as a selection, e.g. count(friends).
+var valueFuncs = map[string]bool{
+	"count": true, "val": true, "expand": true,
+	"min": true, "max": true, "sum": true, "avg": true, "math": true,
+}
+
+// parser is a recursive-descent parser over the lexer's tokens.
+type parser struct {
+	lex  lexer
+	tok  token
+	peek *token
+}
+
+func newParser(src string) (*parser, error) {
+	p := &parser{lex: lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// advance moves to the next token.
+func (p *parser) advance() error {
+	if p.peek != nil {
+		p.tok, p.peek = *p.peek, nil
+		return nil
+	}
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+// lookahead returns the token after the current one without consuming it.
+func (p *parser) lookahead() (token, error) {
+	if p.peek == nil {
+		t, err := p.lex.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.peek = &t
+	}
+	return *p.peek, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return posErrorf(p.lex.src, p.tok.pos, format, args...)
+}
+
+func (p *parser) is(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == punct
+}
+
+func (p *parser) isWord(words ...string) bool {
+	if p.tok.kind != tokWord {
+		return false
+	}
+	for _, w := range words {
+		if p.tok.text == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.is(punct) {
+		return p.errorf("expected %q, found %s", punct, p.describe())
+	}
+	return p.advance()
+}
+
+func (p *parser) word() (string, error) {
+	if p.tok.kind != tokWord {
+		return "", p.errorf("expected a name, found %s", p.describe())
+	}
+	w := p.tok.text
+	return w, p.advance()
+}
+
+func (p *parser) describe() string {
+	switch p.tok.kind {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return "string " + quote(p.tok.text)
+	case tokRegex:
+		return "regular expression"
+	case tokParam:
+		return "$" + p.tok.text
+	default:
+		return quote(p.tok.text)
+	}
+}
+
+// nextIsAs reports whether the current word is followed by "as".
+func (p *parser) nextIsAs() (bool, error) {
+	if p.tok.kind != tokWord {
+		return false, nil
+	}
+	next, err := p.lookahead()
+	if err != nil {
+		return false, err
+	}
+	return next.kind == tokWord && next.text == "as", nil
+}
+
+// Parse parses a DQL query document.
+func Parse(src string) (*Document, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	if p.isWord("query") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokWord {
+			doc.Name = p.tok.text
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if p.is("(") {
+			if doc.Vars, err = p.variables(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.is("}") {
+		if p.tok.kind == tokEOF {
+			return nil, p.errorf("expected \"}\", found end of input")
+		}
+		b, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		doc.Blocks = append(doc.Blocks, b)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s after query", p.describe())
+	}
+	return doc, nil
+}
+
+// variables parses "($name: type = default, ...)".
+func (p *parser) variables() ([]Variable, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var vars []Variable
+	for !p.is(")") {
+		if p.tok.kind != tokParam {
+			return nil, p.errorf("expected a $variable, found %s", p.describe())
+		}
+		prm := Variable{Name: p.tok.text}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		if p.is("!") {
+			typ += "!"
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		prm.Type = typ
+		if p.is("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			prm.Default = &v
+		}
+		vars = append(vars, prm)
+		if p.is(",") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		} else if !p.is(")") {
+			return nil, p.errorf("expected \",\" or \")\", found %s", p.describe())
+		}
+	}
+	return vars, p.advance()
+}
+
+func (p *parser) block() (*Block, error) {
+	b := &Block{}
+	as, err := p.nextIsAs()
+	if err != nil {
+		return nil, err
+	}
+	if as {
+		b.Var = p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if b.Name, err = p.word(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.is(")") {
+		name, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if name == "func" {
+			if p.tok.kind != tokWord {
+				return nil, p.errorf("expected a function, found %s", p.describe())
+			}
+			if b.Func, err = p.funcCall(); err != nil {
+				return nil, err
+			}
+		} else {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			b.Args = append(b.Args, Arg{Name: name, Value: v})
+		}
+		if p.is(",") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		} else if !p.is(")") {
+			return nil, p.errorf("expected \",\" or \")\", found %s", p.describe())
+		}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if b.Filter, b.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.is("{") {
+		b.HasBody = true
+		if b.Fields, err = p.selection(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// selection parses "{ field* }".
+func (p *parser) selection() ([]*Field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []*Field
+	for !p.is("}") {
+		if p.tok.kind == tokEOF {
+			return nil, p.errorf("expected \"}\", found end of input")
+		}
+		if p.is(",") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, p.advance()
+}
+
+func (p *parser) field() (*Field, error) {
+	f := &Field{}
+	if p.tok.kind != tokWord {
+		return nil, p.errorf("expected a predicate, found %s", p.describe())
+	}
+	next, err := p.lookahead()
+	if err != nil {
+		return nil, err
+	}
+	if next.kind == tokPunct && next.text == ":" {
+		f.Alias = p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	as, err := p.nextIsAs()
+	if err != nil {
+		return nil, err
+	}
+	if as {
+		f.Var = p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tok.kind != tokWord {
+		return nil, p.errorf("expected a predicate, found %s", p.describe())
+	}
+	name := p.tok.text
+	if next, err = p.lookahead(); err != nil {
+		return nil, err
+	}
+	isCall := next.kind == tokPunct && next.text == "("
+	if isCall && valueFuncs[name] {
+		if f.Func, err = p.funcCall(); err != nil {
+			return nil, err
+		}
+	} else {
+		f.Name = name
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if isCall {
+			if f.Args, err = p.args(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if f.Filter, f.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.is("{") {
+		f.HasBody = true
+		if f.Fields, err = p.selection(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// args parses "(name: value, ...)"; a name may be omitted for positional values.
+func (p *parser) args() ([]Arg, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []Arg
+	for !p.is(")") {
+		var a Arg
+		if p.tok.kind == tokWord {
+			next, err := p.lookahead()
+			if err != nil {
+				return nil, err
+			}
+			if next.kind == tokPunct && next.text == ":" {
+				a.Name = p.tok.text
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		a.Value = v
+		args = append(args, a)
+		if p.is(",") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		} else if !p.is(")") {
+			return nil, p.errorf("expected \",\" or \")\", found %s", p.describe())
+		}
+	}
+	return args, p.advance()
+}
+
+// directives parses any number of "@name" or "@name(...)" directives.
+func (p *parser) directives() (*Filter, []Directive, error) {
+	var (
+		filter *Filter
+		dirs   []Directive
+	)
+	for p.is("@") {
+		if err := p.advance(); err != nil {
+			return nil, nil, err
+		}
+		name, err := p.word()
+		if err != nil {
+			return nil, nil, err
+		}
+		if name == "filter" {
+			if filter != nil {
+				return nil, nil, p.errorf("duplicate @filter")
+			}
+			if err := p.expect("("); err != nil {
+				return nil, nil, err
+			}
+			if filter, err = p.orExpr(); err != nil {
+				return nil, nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		d := Directive{Name: name}
+		if p.is("(") {
+			if d.Args, err = p.args(); err != nil {
+				return nil, nil, err
+			}
+		}
+		dirs = append(dirs, d)
+	}
+	return filter, dirs, nil
+}
+
+func (p *parser) orExpr() (*Filter, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isWord("OR", "or", "||") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = join(FilterOr, left, right)
+	}
+	return left, nil
+}
+
+func (p *parser) andExpr() (*Filter, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isWord("AND", "and", "&&") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = join(FilterAnd, left, right)
+	}
+	return left, nil
+}
+
+func (p *parser) unaryExpr() (*Filter, error) {
+	switch {
+	case p.isWord("NOT", "not") || p.is("!"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: FilterNot, Args: []*Filter{operand}}, nil
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		// Keep explicit grouping so that "(a OR b) AND c" is not flattened.
+		if f.Op == FilterAnd || f.Op == FilterOr {
+			return &Filter{Op: f.Op, Args: f.Args}, nil
+		}
+		return f, nil
+	case p.tok.kind == tokWord:
+		fn, err := p.funcCall()
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: FilterFunc, Func: fn}, nil
+	}
+	return nil, p.errorf("expected a filter function, found %s", p.describe())
+}
+
+// join combines left and right under op, extending left when it is already an
+// op node produced by the same chain.
+func join(op FilterOp, left, right *Filter) *Filter {
+	if left.Op == op && left.chain {
+		left.Args = append(left.Args, right)
+		return left
+	}
+	return &Filter{Op: op, Args: []*Filter{left, right}, chain: true}
+}
+
+// funcCall parses "name(value, ...)".
+func (p *parser) funcCall() (*Func, error) {
+	name, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+	fn := &Func{Name: name}
+	if name == "math" && p.is("(") {
+		expr, err := p.mathExpr()
+		if err != nil {
+			return nil, err
+		}
+		fn.Args = []Value{{Kind: Expr, Text: expr}}
+		return fn, nil
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.is(")") {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		fn.Args = append(fn.Args, v)
+		if p.is("@") {
+			// count(pred @filter(...))
+			filter, dirs, err := p.directives()
+			if err != nil {
+				return nil, err
+			}
+			if len(dirs) > 0 || fn.Filter != nil {
+				return nil, p.errorf("only one @filter is allowed inside %s()", fn.Name)
+			}
+			fn.Filter = filter
+		}
+		if p.is(",") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		} else if !p.is(")") {
+			return nil, p.errorf("expected \",\" or \")\", found %s", p.describe())
+		}
+	}
+	return fn, p.advance()
+}
+
+// mathExpr reads the expression of math(...) verbatim, up to the matching ")", with
+// its whitespace collapsed. The current token is the opening "(".
+func (p *parser) mathExpr() (string, error) {
+	start, depth := p.lex.pos, 1
+	for i := start; i < len(p.lex.src); i++ {
+		switch p.lex.src[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				p.lex.pos = i + 1
+				return strings.Join(strings.Fields(p.lex.src[start:i]), " "), p.advance()
+			}
+		}
+	}
+	return "", p.errorf("unterminated math()")
+}
+
+func (p *parser) value() (Value, error) {
+	t := p.tok
+	switch t.kind {
+	case tokString:
+		return Value{Kind: String, Text: t.text}, p.advance()
+	case tokRegex:
+		return Value{Kind: Regex, Text: t.text, Flags: t.flags}, p.advance()
+	case tokParam:
+		return Value{Kind: Param, Text: t.text}, p.advance()
+	case tokWord:
+		next, err := p.lookahead()
+		if err != nil {
+			return Value{}, err
+		}
+		if next.kind == tokPunct && next.text == "(" {
+			fn, err := p.funcCall()
+			if err != nil {
+				return Value{}, err
+			}
+			return Value{Kind: FuncCall, Func: fn}, nil
+		}
+		kind := Ident
+		if isNumber(t.text) {
+			kind = Number
+		}
+		return Value{Kind: kind, Text: t.text}, p.advance()
+	}
+	if p.is("[") {
+		if err := p.advance(); err != nil {
+			return Value{}, err
+		}
+		v := Value{Kind: List}
+		for !p.is("]") {
+			item, err := p.value()
+			if err != nil {
+				return Value{}, err
+			}
+			v.List = append(v.List, item)
+			if p.is(",") {
+				if err := p.advance(); err != nil {
+					return Value{}, err
+				}
+			} else if !p.is("]") {
+				return Value{}, p.errorf("expected \",\" or \"]\", found %s", p.describe())
+			}
+		}
+		return v, p.advance()
+	}
+	return Value{}, p.errorf("expected a value, found %s", p.describe())
+}
+
+// ParseFilter parses a filter expression such as `eq(name, "x") AND has(age)`.
+func ParseFilter(src string) (*Filter, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	f, err := p.orExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s after filter", p.describe())
+	}
+	return f, nil
+}
+
+// ParseCondition parses a mutation condition of the form "@if(expr)". An empty
+// condition yields a nil Filter.
+func ParseCondition(src string) (*Filter, error) {
+	s := strings.TrimSpace(src)
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "@if") {
+		return nil, posErrorf(src, 0, "condition must start with @if")
+	}
+	p, err := newParser(s[len("@if"):])
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	f, err := p.orExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s after condition", p.describe())
+	}
+	return f, nil
+}
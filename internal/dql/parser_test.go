@@ -0,0 +1,173 @@
+package dql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+const parseQueryMock = `{
+  u as var(func: uid(0x1)) @filter(type(User))
+
+  users(func: type(User), orderasc: name, first: 10, offset: 5) @cascade
+  @filter(
+    eq(email, "a@b.io")
+    AND (
+      gt(count(friends), 2)
+      OR NOT uid(u)
+    )
+  ) {
+    uid
+    a as age
+    n: count(friends)
+    friends(first: 2) @filter(regexp(name, /^A.*$/i)) { name }
+    expand(_all_) { uid }
+  }
+}`
+
+func TestParse(t *testing.T) {
+	doc, err := dql.Parse(parseQueryMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(doc.Blocks))
+	}
+	u, users := doc.Blocks[0], doc.Blocks[1]
+	if u.Var != "u" || u.Name != "var" || u.HasBody || u.Func.String() != "uid(0x1)" || u.Filter.String() != "type(User)" {
+		t.Errorf("unexpected var block %+v", u)
+	}
+	if users.Func.String() != "type(User)" || len(users.Args) != 3 || users.Args[2].Name != "offset" {
+		t.Errorf("unexpected block args %+v", users.Args)
+	}
+	if len(users.Directives) != 1 || users.Directives[0].Name != "cascade" {
+		t.Errorf("unexpected directives %+v", users.Directives)
+	}
+	wantFilter := `eq(email, "a@b.io") AND (gt(count(friends), 2) OR NOT uid(u))`
+	if got := users.Filter.String(); got != wantFilter {
+		t.Errorf("expected filter %s, got %s", wantFilter, got)
+	}
+	var keys []string
+	for _, f := range users.Fields {
+		keys = append(keys, f.Key())
+	}
+	if got := strings.Join(keys, " "); got != "uid age n friends expand(_all_)" {
+		t.Errorf("unexpected fields %s", got)
+	}
+	friends := users.Fields[3]
+	if friends.Args[0].Value.Text != "2" || friends.Filter.String() != "regexp(name, /^A.*$/i)" || len(friends.Fields) != 1 {
+		t.Errorf("unexpected nested select %+v", friends)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		`{ me(func: eq(name, "x") { name } }`,
+		`{ me(func: has(name)) { name }`,
+		`{ me(func: eq(name, "x)) { name } }`,
+		`query q($a string) { me(func: has(name)) { name } }`,
+	} {
+		if _, err := dql.Parse(src); err == nil {
+			t.Errorf("expected an error for %s", src)
+		}
+	}
+	_, err := dql.Parse("{\n  me(func: has(name)) {\n    name,,\n    ]\n  }\n}")
+	if err == nil || !strings.Contains(err.Error(), "line 4 col 5") {
+		t.Errorf("expected an error at line 4 col 5, got %v", err)
+	}
+}
+
+func TestParseVariablesAndLang(t *testing.T) {
+	doc, err := dql.Parse(`query people($name: string = "Alice", $n: int!) {
+  me(func: eq(name@en, $name), first: $n) {
+    name@en:fr
+    C as count(~genre @filter(uid(F)))
+    friends@filter(has(name)) { name@. }
+  }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Name != "people" || len(doc.Vars) != 2 || doc.Vars[0].Default.Text != "Alice" || doc.Vars[1].Type != "int!" {
+		t.Errorf("unexpected variables %+v", doc.Vars)
+	}
+	me := doc.Blocks[0]
+	if me.Func.String() != "eq(name@en, $name)" || me.Args[0].Value.String() != "$n" {
+		t.Errorf("unexpected root %s %+v", me.Func, me.Args)
+	}
+	var got []string
+	for _, f := range me.Fields {
+		got = append(got, f.Key())
+	}
+	if strings.Join(got, " ") != "name@en:fr count(~genre @filter(uid(F))) friends" {
+		t.Errorf("unexpected fields %v", got)
+	}
+	if c := me.Fields[1].Func.String(); c != "count(~genre @filter(uid(F)))" {
+		t.Errorf("unexpected count %s", c)
+	}
+	if me.Fields[2].Filter == nil || me.Fields[2].Fields[0].Name != "name@." {
+		t.Errorf("unexpected nested select %+v", me.Fields[2])
+	}
+}
+
+func TestParseMath(t *testing.T) {
+	doc, err := dql.Parse("{ var(func: has(a)) { x as math(a * (b +\n c) / 2) } }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := doc.Blocks[0].Fields[0]
+	if f.Var != "x" || f.Func == nil || f.Func.Args[0].Kind != dql.Expr || f.Func.String() != "math(a * (b + c) / 2)" {
+		t.Errorf("unexpected math field %+v", f)
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	f, err := dql.ParseCondition("@if(eq(len(v), 0) AND eq(len(u), 1))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Op != dql.FilterAnd || len(f.Args) != 2 || f.String() != "eq(len(v), 0) AND eq(len(u), 1)" {
+		t.Errorf("unexpected condition %s", f)
+	}
+	if f, err := dql.ParseCondition(""); f != nil || err != nil {
+		t.Errorf("expected no condition, got %v, %v", f, err)
+	}
+}
+
+func TestParseNQuads(t *testing.T) {
+	quads, err := dql.ParseNQuads(`_:user <name> "Al \"the\" pal" .
+<0x1> <age> "29"^^<xs:int> .
+uid(v) <friend> _:user .
+uid(v) <other> val(a) .
+<0x2> * * .
+_:user <bio> "hi"@en .
+<0x3> <name> "Carol" <0x0> .`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quads) != 7 {
+		t.Fatalf("expected 7 quads, got %d", len(quads))
+	}
+	checks := []struct {
+		got, want any
+	}{
+		{quads[0].Subject, dql.Term{Kind: dql.TermBlank, Value: "user"}},
+		{quads[0].Object.Value, `Al "the" pal`},
+		{quads[1].Object, dql.Term{Kind: dql.TermLiteral, Value: "29", DataType: "xs:int"}},
+		{quads[2].Subject, dql.Term{Kind: dql.TermUIDVar, Value: "v"}},
+		{quads[3].Object, dql.Term{Kind: dql.TermValVar, Value: "a"}},
+		{quads[4].Predicate, "*"},
+		{quads[4].Object.Kind, dql.TermStar},
+		{quads[5].Object.Lang, "en"},
+		{quads[6].Object.Value, "Carol"},
+	}
+	for i, c := range checks {
+		if c.got != c.want {
+			t.Errorf("check %d: expected %+v, got %+v", i, c.want, c.got)
+		}
+	}
+	if _, err := dql.ParseNQuads(`_:a <name> "x"`); err == nil {
+		t.Error("expected an error for a missing terminator")
+	}
+}
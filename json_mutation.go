@@ -0,0 +1,303 @@
+package dquely
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+// Encoding selects the wire format of generated mutations.
+type Encoding int
+
+const (
+	// EncodingNQuads sends RDF N-Quads in SetNquads and DelNquads. It is the default.
+	EncodingNQuads Encoding = iota
+	// EncodingJSON sends the same mutations as JSON objects in SetJson and DeleteJson.
+	EncodingJSON
+)
+
+// ParseMutationJSON is ParseMutation with the mutations encoded as JSON.
+func ParseMutationJSON(input any, deep ...bool) (string, []*api.Mutation, error) {
+	query, mus, err := ParseMutation(input, deep...)
+	if err != nil {
+		return "", nil, err
+	}
+	mus, err = encodeJSON(mus, jsonKinds(input))
+	return query, mus, err
+}
+
+// ParseUpdateJSON is ParseUpdate with the mutations encoded as JSON.
+func ParseUpdateJSON(input any, fields ...string) (string, []*api.Mutation, error) {
+	query, mus, err := ParseUpdate(input, fields...)
+	if err != nil {
+		return "", nil, err
+	}
+	mus, err = encodeJSON(mus, jsonKinds(input))
+	return query, mus, err
+}
+
+// MutationJSON is Mutation as a JSON set object, e.g.
+//
+//	{"uid":"_:user","name":"Alice","age":29,"dgraph.type":"User"}
+func MutationJSON(input any) ([]byte, error) {
+	text, err := Mutation(input)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "{\n  set {\n"), "  }\n}")
+	return nquadsToJSON([]byte(text), false, jsonKinds(input))
+}
+
+// EncodeJSON converts N-Quad mutations into equivalent JSON mutations. Blank nodes
+// keep their names ("uid": "_:user"), so api.Response.Uids and SetUIDs work the same
+// way; uid(v) subjects become "uid": "uid(v)" and wildcard deletes become nulls. A
+// blank node referenced once is nested inside the object that references it.
+//
+// Without the struct the mutations were built from, only literals typed xs:int,
+// xs:float, xs:boolean and the like become JSON numbers and booleans. The ...JSON
+// parsers and a client using EncodingJSON use the kinds of the struct fields instead.
+func EncodeJSON(mus []*api.Mutation) ([]*api.Mutation, error) {
+	return encodeJSON(mus, nil)
+}
+
+// encodeJSON is EncodeJSON with the JSON kinds of the predicates, from jsonKinds.
+func encodeJSON(mus []*api.Mutation, kinds map[string]jsonKind) ([]*api.Mutation, error) {
+	out := make([]*api.Mutation, len(mus))
+	for i, mu := range mus {
+		set, err := nquadsToJSON(mu.SetNquads, false, kinds)
+		if err != nil {
+			return nil, err
+		}
+		del, err := nquadsToJSON(mu.DelNquads, true, kinds)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = &api.Mutation{
+			SetJson:    set,
+			DeleteJson: del,
+			Cond:       mu.Cond,
+			CommitNow:  mu.CommitNow,
+		}
+	}
+	return out, nil
+}
+
+// jsonNode is one subject of the N-Quads being converted.
+type jsonNode struct {
+	ref     string // "_:user", "0x1" or "uid(v)"
+	blank   bool
+	preds   []string
+	values  map[string][]any // predicate -> literals, *jsonNode references or nil (wildcard)
+	refs    int              // times this node is the object of an edge
+	emitted bool
+}
+
+func (n *jsonNode) add(pred string, v any) {
+	if _, ok := n.values[pred]; !ok {
+		n.preds = append(n.preds, pred)
+	}
+	n.values[pred] = append(n.values[pred], v)
+}
+
+// nquadsToJSON converts N-Quads to a JSON object, or an array when there are
+// several top-level subjects. It returns nil for empty input.
+func nquadsToJSON(data []byte, del bool, kinds map[string]jsonKind) ([]byte, error) {
+	quads, err := dql.ParseNQuads(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("dquely: json encoding: %w", err)
+	}
+	if len(quads) == 0 {
+		return nil, nil
+	}
+	var order []*jsonNode
+	nodes := map[string]*jsonNode{}
+	node := func(t dql.Term) *jsonNode {
+		var ref string
+		switch t.Kind {
+		case dql.TermBlank:
+			ref = "_:" + t.Value
+		case dql.TermUIDVar:
+			ref = "uid(" + t.Value + ")"
+		default:
+			ref = t.Value
+		}
+		n := nodes[ref]
+		if n == nil {
+			n = &jsonNode{ref: ref, blank: t.Kind == dql.TermBlank, values: map[string][]any{}}
+			nodes[ref] = n
+			order = append(order, n)
+		}
+		return n
+	}
+	subjects := map[*jsonNode]bool{}
+	for _, q := range quads {
+		subj := node(q.Subject)
+		subjects[subj] = true
+		if q.Predicate == "*" {
+			continue // "<s> * * ." deletes the whole node: {"uid": s}
+		}
+		pred := q.Predicate
+		switch q.Object.Kind {
+		case dql.TermStar:
+			subj.add(pred, nil)
+		case dql.TermLiteral:
+			kind := kinds[pred]
+			if q.Object.Lang != "" {
+				pred += "@" + q.Object.Lang
+			}
+			subj.add(pred, jsonLiteral(q.Object, kind))
+		case dql.TermUID, dql.TermBlank, dql.TermUIDVar:
+			obj := node(q.Object)
+			obj.refs++
+			subj.add(pred, obj)
+		default:
+			return nil, fmt.Errorf("dquely: json encoding: val() objects are not supported")
+		}
+	}
+	var top []*jsonNode
+	for _, n := range order {
+		if subjects[n] && !(n.blank && n.refs == 1 && !del && n != order[0]) {
+			top = append(top, n)
+		}
+	}
+	var buf bytes.Buffer
+	var objects [][]byte
+	write := func(n *jsonNode) error {
+		buf.Reset()
+		if err := writeJSONNode(&buf, n, subjects, del); err != nil {
+			return err
+		}
+		objects = append(objects, append([]byte(nil), buf.Bytes()...))
+		return nil
+	}
+	for _, n := range top {
+		if err := write(n); err != nil {
+			return nil, err
+		}
+	}
+	// Nodes only reachable through a cycle of single references.
+	for _, n := range order {
+		if subjects[n] && !n.emitted {
+			if err := write(n); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(objects) == 1 {
+		return objects[0], nil
+	}
+	return append(append([]byte("["), bytes.Join(objects, []byte(","))...), ']'), nil
+}
+
+func writeJSONNode(buf *bytes.Buffer, n *jsonNode, subjects map[*jsonNode]bool, del bool) error {
+	n.emitted = true
+	buf.WriteString(`{"uid":`)
+	writeJSONValue(buf, n.ref)
+	for _, pred := range n.preds {
+		buf.WriteByte(',')
+		writeJSONValue(buf, pred)
+		buf.WriteByte(':')
+		vals := n.values[pred]
+		if len(vals) > 1 {
+			buf.WriteByte('[')
+		}
+		for i, v := range vals {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			child, ok := v.(*jsonNode)
+			switch {
+			case !ok:
+				writeJSONValue(buf, v)
+			case child.blank && child.refs == 1 && !del && subjects[child] && !child.emitted:
+				if err := writeJSONNode(buf, child, subjects, del); err != nil {
+					return err
+				}
+			default:
+				buf.WriteString(`{"uid":`)
+				writeJSONValue(buf, child.ref)
+				buf.WriteByte('}')
+			}
+		}
+		if len(vals) > 1 {
+			buf.WriteByte(']')
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func writeJSONValue(buf *bytes.Buffer, v any) {
+	b, _ := json.Marshal(v)
+	buf.Write(b)
+}
+
+// jsonKind is how the literals of a predicate are written in JSON.
+type jsonKind int
+
+const (
+	jsonString jsonKind = iota
+	jsonNumber
+	jsonBool
+)
+
+// jsonLiteral returns the JSON value of an N-Quad literal: a number or boolean when
+// kind or the xs: datatype says so, else a string, as untyped N-Quad literals are.
+func jsonLiteral(t dql.Term, kind jsonKind) any {
+	switch {
+	case kind == jsonNumber, slices.Contains([]string{"xs:int", "xs:integer", "xs:float", "xs:double", "xs:decimal"}, t.DataType):
+		var n json.Number
+		if json.Unmarshal([]byte(t.Value), &n) == nil {
+			return n
+		}
+	case kind == jsonBool, t.DataType == "xs:boolean":
+		switch t.Value {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+	return t.Value
+}
+
+// jsonKinds returns the JSON kind of the number and bool predicates written for
+// input, from the kinds of its struct fields and those of the nodes it links to.
+func jsonKinds(input any) map[string]jsonKind {
+	kinds := map[string]jsonKind{}
+	v := reflect.Indirect(reflect.ValueOf(input))
+	if v.Kind() != reflect.Struct {
+		return kinds
+	}
+	eachNode(v, func(node reflect.Value) {
+		for _, field := range structFields(node.Type()) {
+			rawTag := field.Tag.Get("dquely")
+			if rawTag == "-" || !field.IsExported() || isEdgeType(field.Type) {
+				continue
+			}
+			predicate, isJSON, _ := parseTag(rawTag, field.Name)
+			if predicate == "uid" || isJSON {
+				continue
+			}
+			t := scalarOf(field.Type)
+			if isScalarList(t) {
+				t = scalarOf(t.Elem())
+			}
+			switch t.Kind() {
+			case reflect.Bool:
+				kinds[predicate] = jsonBool
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+				kinds[predicate] = jsonNumber
+			}
+		}
+	})
+	return kinds
+}
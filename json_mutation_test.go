@@ -0,0 +1,149 @@
+package dquely_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"github.com/vibros68/dquely"
+)
+
+func TestParseMutationJSON(t *testing.T) {
+	_, mus, err := dquely.ParseMutationJSON(&User{Name: `Al "the" pal`, Age: 29})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetJson); got != userJSONMutationMock {
+		t.Errorf("expected %s, got %s", userJSONMutationMock, got)
+	}
+	if len(mus[0].SetNquads) != 0 || mus[0].DeleteJson != nil {
+		t.Errorf("expected only SetJson, got %+v", mus[0])
+	}
+
+	// Conditions and queries are unchanged; only the mutation body is re-encoded.
+	in := &UserWithUnique{Uid: "0x1", UserName: "alice", Age: 29}
+	wantQuery, nquads, err := dquely.ParseMutation(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, mus, err := dquely.ParseMutationJSON(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != wantQuery || mus[0].Cond != nquads[0].Cond {
+		t.Errorf("expected query %q and cond %q, got %q and %q", wantQuery, nquads[0].Cond, query, mus[0].Cond)
+	}
+	if got := string(mus[0].SetJson); got != userWithUniqueUpdateSetJSONMock {
+		t.Errorf("expected %s, got %s", userWithUniqueUpdateSetJSONMock, got)
+	}
+	if got := string(mus[0].DeleteJson); got != userWithUniqueUpdateDeleteJSONMock {
+		t.Errorf("expected %s, got %s", userWithUniqueUpdateDeleteJSONMock, got)
+	}
+}
+
+func TestParseMutationJSONDeep(t *testing.T) {
+	company := &Company{Name: "Acme", Owner: &ShortUser{Name: "Bob"}, Staffs: []ShortUser{{Name: "C"}, {Uid: "0x9"}}}
+	_, mus, err := dquely.ParseMutationJSON(company, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetJson); got != companyDeepJSONMock {
+		t.Errorf("expected %s, got %s", companyDeepJSONMock, got)
+	}
+	// The blank node names match the N-Quad encoding, so SetUIDs writes back the same way.
+	err = dquely.SetUIDs(company, map[string]string{"company": "0x1", "company.owner": "0x2", "company.staffs0": "0x3"})
+	if err != nil || company.Uid != "0x1" || company.Owner.Uid != "0x2" || company.Staffs[0].Uid != "0x3" {
+		t.Errorf("unexpected uids %+v, %v", company, err)
+	}
+}
+
+func TestParseUpdateJSON(t *testing.T) {
+	company := &Company{Uid: "0x5", Name: "Acme", Staffs: []ShortUser{{Name: "C"}, {Uid: "0x9"}}}
+	_, mus, err := dquely.ParseUpdateJSON(company, dquely.FieldAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetJson); got != companyUpdateSetJSONMock {
+		t.Errorf("expected %s, got %s", companyUpdateSetJSONMock, got)
+	}
+	if got := string(mus[0].DeleteJson); got != companyUpdateDeleteJSONMock {
+		t.Errorf("expected %s, got %s", companyUpdateDeleteJSONMock, got)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	mus, err := dquely.EncodeJSON([]*api.Mutation{{
+		SetNquads: []byte(`_:a <name> "A" .
+_:a <score> "1.5"^^<xs:float> .
+_:a <name@fr> "Aa" .
+_:a <knows> _:b .
+_:a <knows> _:c .
+_:b <knows> _:c .
+_:c <name> "C" .`),
+		DelNquads: []byte(`<0x7> * * .`),
+		CommitNow: true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"uid":"_:a","name":"A","score":1.5,"name@fr":"Aa","knows":[{"uid":"_:b","knows":{"uid":"_:c"}},{"uid":"_:c"}]},{"uid":"_:c","name":"C"}]`
+	if got := string(mus[0].SetJson); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if got := string(mus[0].DeleteJson); got != `{"uid":"0x7"}` || !mus[0].CommitNow {
+		t.Errorf("unexpected delete %s", got)
+	}
+	if _, err := dquely.EncodeJSON([]*api.Mutation{{SetNquads: []byte(`uid(v) <n> val(a) .`)}}); err == nil {
+		t.Error("expected an error for val() objects")
+	}
+}
+
+func TestMutationJSON(t *testing.T) {
+	got, err := dquely.MutationJSON(&User{Name: "Al", Age: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"uid":"_:user","name":"Al","age":3,"dgraph.type":"User"}`; string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestParseMutationJSONValueTypes(t *testing.T) {
+	age, active := 0, false
+	_, mus, err := dquely.ParseMutationJSON(&Profile{Handle: "42", Age: &age, Active: &active, Bio: dquely.Some("7")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile map[string]any
+	if err := json.Unmarshal(mus[len(mus)-1].SetJson, &profile); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"handle": "42", "age": 0.0, "active": false, "score": 0.0, "bio": "7"}
+	for p, v := range want {
+		if profile[p] != v {
+			t.Errorf("expected %s to be %#v, got %#v", p, v, profile[p])
+		}
+	}
+
+	_, mus, err = dquely.ParseMutationJSON(&Recipe{Title: "Pho", Ratings: []int{4, 5}, Weights: []float64{0.5}, Notes: []string{"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recipe map[string]any
+	if err := json.Unmarshal(mus[len(mus)-1].SetJson, &recipe); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(recipe["ratings"], recipe["weights"]); got != "[4 5] 0.5" {
+		t.Errorf("expected numeric ratings and weights, got %s", got)
+	}
+	if _, ok := recipe["ratings"].([]any)[0].(float64); !ok {
+		t.Errorf("expected ratings to be numbers, got %#v", recipe["ratings"])
+	}
+	if _, ok := recipe["weights"].(float64); !ok {
+		t.Errorf("expected weights to be a number, got %#v", recipe["weights"])
+	}
+	if recipe["notes"] != `["1"]` {
+		t.Errorf("expected json-encoded notes to stay a string, got %#v", recipe["notes"])
+	}
+}
@@ -0,0 +1,66 @@
+package dquely
+
+import (
+	"reflect"
+	"strings"
+)
+
+// isScalarList reports whether fields of type t are list predicates, written as one
+// N-quad per element: slices of strings, numbers and bools, but not []byte.
+func isScalarList(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	switch elem.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// listValues returns the values written for the field value fv: the non-nil elements
+// of a scalar list, or fv itself. JSON-encoded fields are always a single value.
+func listValues(fv reflect.Value, isJSON bool) []reflect.Value {
+	if isJSON || !isScalarList(fv.Type()) {
+		return []reflect.Value{fv}
+	}
+	values := make([]reflect.Value, 0, fv.Len())
+	for i := range fv.Len() {
+		ev := fv.Index(i)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				continue
+			}
+			ev = ev.Elem()
+		}
+		values = append(values, ev)
+	}
+	return values
+}
+
+// listOp is how ParseUpdate writes a list field.
+type listOp int
+
+const (
+	listReplace listOp = iota // "tags": delete every value, then write the list
+	listAppend                // "+tags": add the values of the list
+	listRemove                // "-tags": delete the values of the list
+)
+
+// parseUpdateField splits a ParseUpdate field into its predicate and list operation.
+func parseUpdateField(f string) (string, listOp) {
+	if p, ok := strings.CutPrefix(f, "+"); ok {
+		return p, listAppend
+	}
+	if p, ok := strings.CutPrefix(f, "-"); ok {
+		return p, listRemove
+	}
+	return f, listReplace
+}
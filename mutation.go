@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/dgraph-io/dgo/v250/protos/api"
 	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -43,32 +45,40 @@ func Mutation(input any) (string, error) {
 
 	// Strings and json-encoded fields first, then other kinds — each in struct declaration order.
 	for _, stringPass := range []bool{true, false} {
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
+		for i, field := range structFields(t) {
 			rawTag := field.Tag.Get("dquely")
 			if rawTag == "-" {
 				continue
 			}
 			predicate, isJSON, _ := parseTag(rawTag, field.Name)
-			isString := field.Type.Kind() == reflect.String || isJSON
+			isString := scalarOf(field.Type).Kind() == reflect.String || isJSON
 			if isString != stringPass {
 				continue
 			}
-			val := v.Field(i)
-			if val.IsZero() {
+			val, state := fieldValue(fieldByIndex(v, field.Index), rawTag)
+			if state != fieldPresent {
 				continue
 			}
-			var valueStr string
-			if isJSON {
-				b, err := json.Marshal(val.Interface())
-				if err != nil {
-					return "", fmt.Errorf("dquely: failed to marshal field %s as JSON: %w", field.Name, err)
+			for _, val := range listValues(val, isJSON) {
+				var valueStr string
+				if isJSON {
+					b, err := json.Marshal(val.Interface())
+					if err != nil {
+						return "", fmt.Errorf("dquely: failed to marshal field %s as JSON: %w", field.Name, err)
+					}
+					valueStr = escapeLiteral(string(b))
+				} else {
+					valueStr = escapeLiteral(fmt.Sprintf("%v", val.Interface()))
 				}
-				valueStr = strings.ReplaceAll(string(b), `"`, `\"`)
-			} else {
-				valueStr = fmt.Sprintf("%v", val.Interface())
+				sb.WriteString(fmt.Sprintf("    %s <%s> \"%s\" .\n", blankNode, predicate, valueStr))
+			}
+			norm, err := normalizedNquad(blankNode, v, t, i)
+			if err != nil {
+				return "", err
+			}
+			if norm != "" {
+				sb.WriteString("    " + norm + "\n")
 			}
-			sb.WriteString(fmt.Sprintf("    %s <%s> \"%s\" .\n", blankNode, predicate, valueStr))
 		}
 	}
 
@@ -84,7 +94,7 @@ type DgraphMutation interface {
 // parseTag splits a raw dquely struct tag into the predicate name and options.
 // Falls back to fieldName when the name part is empty.
 // Returns isJSON=true when the "json" option is present.
-// Returns isUnique=true when the "unique" option is present.
+// Returns isUnique=true when the "unique" or "unique=<key>" option is present.
 func parseTag(rawTag, fieldName string) (predicate string, isJSON bool, isUnique bool) {
 	predicate = rawTag
 	if idx := strings.Index(rawTag, ","); idx >= 0 {
@@ -95,6 +105,10 @@ func parseTag(rawTag, fieldName string) (predicate string, isJSON bool, isUnique
 				isJSON = true
 			case "unique":
 				isUnique = true
+			default:
+				if strings.HasPrefix(opt, "unique=") {
+					isUnique = true
+				}
 			}
 		}
 	}
@@ -124,18 +138,18 @@ func UniqueFields(input any) ([]UniqueField, error) {
 		return nil, fmt.Errorf("dquely: UniqueFields expects a struct, got %s", v.Kind())
 	}
 	var fields []UniqueField
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
 		if rawTag == "-" {
 			continue
 		}
-		predicate, _, isUnique := parseTag(rawTag, t.Field(i).Name)
+		predicate, _, isUnique := parseTag(rawTag, field.Name)
 		if !isUnique {
 			continue
 		}
 		fields = append(fields, UniqueField{
 			Predicate: predicate,
-			Value:     fmt.Sprintf("%v", v.Field(i).Interface()),
+			Value:     fmt.Sprintf("%v", fieldByIndex(v, field.Index).Interface()),
 		})
 	}
 	return fields, nil
@@ -143,9 +157,9 @@ func UniqueFields(input any) ([]UniqueField, error) {
 
 // hasUIDField reports whether t contains a field whose dquely predicate is "uid".
 func hasUIDField(t reflect.Type) bool {
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
-		predicate, _, _ := parseTag(rawTag, t.Field(i).Name)
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
+		predicate, _, _ := parseTag(rawTag, field.Name)
 		if predicate == "uid" {
 			return true
 		}
@@ -174,80 +188,116 @@ func BlankNodeName(input any) (string, error) {
 	return strings.ToLower(typeName), nil
 }
 
+// dgraphTypeOf returns the dgraph.type name used for input: the struct type name, or
+// DgraphType() if input implements DgraphMutation. Returns "" when input is not a struct.
+func dgraphTypeOf(input any) string {
+	if dm, ok := input.(DgraphMutation); ok {
+		return dm.DgraphType()
+	}
+	t := reflect.TypeOf(input)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	return t.Name()
+}
+
 // SetUIDs distributes UIDs from a DGraph mutation response into a struct and its
-// direct nested structs.  The keys in uids are matched as follows:
-//
-//   - A nested pointer-to-struct field is matched by strings.ToLower(field.Name).
-//   - A nested slice-of-struct element at index j is matched by
-//     strings.ToLower(field.Name) + strconv.Itoa(j).
-//   - Any key that does not match a field pattern is assumed to be the root struct's
-//     UID and is applied via SetUID.
+// nested structs at any depth. Keys are the blank-node names the mutation builders
+// generate, as listed by BlankNodeMap: "company", "company.owner",
+// "company.staffs0.link". For compatibility, keys relative to the root ("owner",
+// "staffs0") are matched too, and when the root's own key is absent an unmatched
+// key is taken as the root struct's UID.
 //
 // input must be a non-nil pointer to a struct with a dquely:"uid" field.
 func SetUIDs(input any, uids map[string]string) error {
 	v := reflect.ValueOf(input)
-	t := reflect.TypeOf(input)
 	if v.Kind() != reflect.Ptr {
 		return fmt.Errorf("dquely: SetUIDs expects a pointer to struct, got %s", v.Kind())
 	}
-	v = v.Elem()
-	t = t.Elem()
-	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("dquely: SetUIDs expects a pointer to struct, got pointer to %s", v.Kind())
+	if v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("dquely: SetUIDs expects a pointer to struct, got pointer to %s", v.Elem().Kind())
 	}
-
-	matched := make(map[string]bool, len(uids))
-
-	// Match nested pointer and slice fields by their dquely tag predicate name.
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		fv := v.Field(i)
-		ft := field.Type
-		predicate, _, _ := parseTag(field.Tag.Get("dquely"), field.Name)
-		if predicate == "uid" {
-			continue
+	nodes, err := BlankNodeMap(input)
+	if err != nil {
+		return err
+	}
+	root, _ := BlankNodeName(input)
+	_, hasRoot := uids[root]
+	keys := make([]string, 0, len(uids))
+	for key := range uids {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		target, ok := nodes[key]
+		if !ok {
+			target, ok = nodes[root+"."+key]
 		}
-
-		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
-			if uid, ok := uids[predicate]; ok {
-				matched[predicate] = true
-				if !fv.IsNil() {
-					if err := SetUID(fv.Interface(), uid); err != nil {
-						return err
-					}
-				}
-			}
-		} else if ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct {
-			if fv.IsNil() {
+		if !ok {
+			if hasRoot {
 				continue
 			}
-			for j := 0; j < fv.Len(); j++ {
-				key := predicate + strconv.Itoa(j)
-				if uid, ok := uids[key]; ok {
-					matched[key] = true
-					elem := fv.Index(j)
-					if elem.CanAddr() {
-						if err := SetUID(elem.Addr().Interface(), uid); err != nil {
-							return err
-						}
-					}
-				}
-			}
+			target, hasRoot = input, true
+		}
+		if err := SetUID(target, uids[key]); err != nil {
+			return err
 		}
-
 	}
+	return nil
+}
 
-	// Any key not matched by a field is treated as the root struct's UID.
-	for key, uid := range uids {
-		if !matched[key] {
-			if err := SetUID(input, uid); err != nil {
-				return err
-			}
-			break
-		}
+// BlankNodeMap returns the blank-node names a deep mutation of input uses, without
+// the "_:" prefix, mapped to pointers to the structs they stand for:
+//
+//	"company"              -> *Company
+//	"company.owner"        -> company.Owner
+//	"company.staffs0"      -> &company.Staffs[0]
+//	"company.staffs0.link" -> company.Staffs[0].Link
+//
+// Names follow the path of predicates and slice indexes from the root, so they are
+// unique within a mutation. A struct reached through several edges is listed once,
+// under the name of the first path; structs that already have a uid are not listed.
+func BlankNodeMap(input any) (map[string]any, error) {
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dquely: BlankNodeMap expects a pointer to struct, got %T", input)
+	}
+	root, err := BlankNodeName(input)
+	if err != nil {
+		return nil, err
+	}
+	nodes := newNquadNodes()
+	nodes.add(v.Elem(), "_:"+root, "")
+	var sb strings.Builder
+	if err := nodes.build(&sb, v.Elem(), v.Elem().Type(), "_:"+root, dgraphTypeOf(input), true); err != nil {
+		return nil, err
 	}
+	out := make(map[string]any, len(nodes.ptrs))
+	for name, ptr := range nodes.ptrs {
+		out[strings.TrimPrefix(name, "_:")] = ptr.Interface()
+	}
+	return out, nil
+}
 
-	return nil
+// childBlankNode names the node at the predicate edge of parent, with the slice
+// index when index >= 0: ("_:company", "staffs", 0) gives "_:company.staffs0". A
+// parent written as <uid> contributes the uid.
+func childBlankNode(parent, predicate string, index int) string {
+	name := strings.TrimPrefix(parent, "_:")
+	if name == parent {
+		name = strings.Trim(parent, "<>")
+	}
+	name += "." + predicate
+	if index >= 0 {
+		name += strconv.Itoa(index)
+	}
+	return "_:" + name
 }
 
 // SetUID writes uid into the field tagged `dquely:"uid"` on the struct that input
@@ -259,15 +309,15 @@ func SetUID(input any, uid string) error {
 	}
 	v = v.Elem()
 	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
-		predicate, _, _ := parseTag(rawTag, t.Field(i).Name)
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
+		predicate, _, _ := parseTag(rawTag, field.Name)
 		if predicate == "uid" {
-			field := v.Field(i)
-			if !field.CanSet() {
-				return fmt.Errorf("dquely: uid field %q is not settable", t.Field(i).Name)
+			fv := settableField(v, field.Index)
+			if !fv.IsValid() || !fv.CanSet() {
+				return fmt.Errorf("dquely: uid field %q is not settable", field.Name)
 			}
-			field.SetString(uid)
+			fv.SetString(uid)
 			return nil
 		}
 	}
@@ -296,13 +346,14 @@ func Upsert(input any, matchExpr FilterExpr, updateFields ...string) (string, er
 	varName := strings.ToLower(typeName)
 
 	// Build predicate → field index map using parseTag so options like ,unique are stripped.
-	tagIndex := make(map[string]int, t.NumField())
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
+	fields := structFields(t)
+	tagIndex := make(map[string]int, len(fields))
+	for i, field := range fields {
+		rawTag := field.Tag.Get("dquely")
 		if rawTag == "" || rawTag == "-" {
 			continue
 		}
-		predicate, _, _ := parseTag(rawTag, t.Field(i).Name)
+		predicate, _, _ := parseTag(rawTag, field.Name)
 		tagIndex[predicate] = i
 	}
 
@@ -316,11 +367,13 @@ func Upsert(input any, matchExpr FilterExpr, updateFields ...string) (string, er
 		if !ok {
 			continue
 		}
-		val := v.Field(idx)
-		if val.IsZero() {
+		val, state := fieldValue(fieldByIndex(v, fields[idx].Index), fields[idx].Tag.Get("dquely"))
+		if state != fieldPresent {
 			continue
 		}
-		sb.WriteString(fmt.Sprintf("      uid(%s) <%s> \"%v\" .\n", varName, field, val.Interface()))
+		for _, val := range listValues(val, false) {
+			sb.WriteString(fmt.Sprintf("      uid(%s) <%s> \"%v\" .\n", varName, field, val.Interface()))
+		}
 	}
 
 	sb.WriteString("    }\n  }\n}")
@@ -444,13 +497,14 @@ func UpsertWithQuery(queryName string, q *DQuely, varRef string, input any, upda
 	}
 
 	// Build predicate → field index map using parseTag so options like ,unique are stripped.
-	tagIndex := make(map[string]int, t.NumField())
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
+	fields := structFields(t)
+	tagIndex := make(map[string]int, len(fields))
+	for i, field := range fields {
+		rawTag := field.Tag.Get("dquely")
 		if rawTag == "" || rawTag == "-" {
 			continue
 		}
-		predicate, _, _ := parseTag(rawTag, t.Field(i).Name)
+		predicate, _, _ := parseTag(rawTag, field.Name)
 		tagIndex[predicate] = i
 	}
 
@@ -478,11 +532,13 @@ func UpsertWithQuery(queryName string, q *DQuely, varRef string, input any, upda
 		if !ok {
 			continue
 		}
-		val := v.Field(idx)
-		if val.IsZero() {
+		val, state := fieldValue(fieldByIndex(v, fields[idx].Index), fields[idx].Tag.Get("dquely"))
+		if state != fieldPresent {
 			continue
 		}
-		sb.WriteString(fmt.Sprintf("      uid(%s) <%s> \"%v\" .\n", varRef, field, val.Interface()))
+		for _, val := range listValues(val, false) {
+			sb.WriteString(fmt.Sprintf("      uid(%s) <%s> \"%v\" .\n", varRef, field, val.Interface()))
+		}
 	}
 
 	sb.WriteString("    }\n  }\n}")
@@ -491,10 +547,10 @@ func UpsertWithQuery(queryName string, q *DQuely, varRef string, input any, upda
 
 // structUID returns the value of the dquely:"uid" field in v, or "" if absent.
 func structUID(v reflect.Value, t reflect.Type) string {
-	for i := 0; i < t.NumField(); i++ {
-		predicate, _, _ := parseTag(t.Field(i).Tag.Get("dquely"), t.Field(i).Name)
+	for _, field := range structFields(t) {
+		predicate, _, _ := parseTag(field.Tag.Get("dquely"), field.Name)
 		if predicate == "uid" {
-			return v.Field(i).String()
+			return fieldByIndex(v, field.Index).String()
 		}
 	}
 	return ""
@@ -508,10 +564,68 @@ func structUID(v reflect.Value, t reflect.Type) string {
 //  4. Recursive content for blank-node children, each preceded by "\n".
 //
 // When a nested struct has a non-empty uid its reference is "<uid>" and no content is emitted
-// (the node already exists in DGraph).
+// (the node already exists in DGraph). A struct already written, because several edges
+// point to it or it closes a cycle, is referenced by its blank node and not repeated; a
+// struct pointing to itself is an error.
 func buildNquads(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode, typeName string, deep bool) error {
+	nodes := newNquadNodes()
+	nodes.add(v, blankNode, "")
+	return nodes.build(sb, v, t, blankNode, typeName, deep)
+}
+
+// nquadNodes tracks the structs a deep mutation has named. A struct reached again,
+// through a second edge or a cycle, is referenced by its first blank node instead of
+// being written twice.
+type nquadNodes struct {
+	names   map[nodeKey]string       // struct -> blank node
+	ptrs    map[string]reflect.Value // blank node -> pointer to the struct
+	parents map[string]string        // blank node -> blank node of its first edge
+	order   []string                 // blank nodes in naming order, root first
+	iris    map[string]string        // blank node -> <uid> written in its place
+}
+
+// nodeKey identifies a struct by address and type, since a struct and its first
+// field share an address.
+type nodeKey struct {
+	addr uintptr
+	t    reflect.Type
+}
+
+func newNquadNodes() *nquadNodes {
+	return &nquadNodes{names: map[nodeKey]string{}, ptrs: map[string]reflect.Value{}, parents: map[string]string{}, iris: map[string]string{}}
+}
+
+func (n *nquadNodes) add(v reflect.Value, blankNode, parent string) {
+	if !v.CanAddr() {
+		return
+	}
+	n.names[nodeKey{v.Addr().Pointer(), v.Type()}] = blankNode
+	n.ptrs[blankNode] = v.Addr()
+	n.parents[blankNode] = parent
+	n.order = append(n.order, blankNode)
+}
+
+func (n *nquadNodes) lookup(v reflect.Value) (string, bool) {
+	if !v.CanAddr() {
+		return "", false
+	}
+	name, ok := n.names[nodeKey{v.Addr().Pointer(), v.Type()}]
+	return name, ok
+}
+
+// subject returns the subject written for blankNode: the <uid> of an existing root
+// whose children are named after blankNode, or blankNode itself.
+func (n *nquadNodes) subject(blankNode string) string {
+	if iri, ok := n.iris[blankNode]; ok {
+		return iri
+	}
+	return blankNode
+}
+
+func (n *nquadNodes) build(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode, typeName string, deep bool) error {
+	subject := n.subject(blankNode)
 	type nestedItem struct {
-		ref         string // "<uid>" for existing nodes, "_:predicate" for new blank nodes
+		ref         string // "<uid>" for existing nodes, "_:parent.predicate" for new blank nodes
 		blankNode   string // blank node name, only used when !skipContent
 		v           reflect.Value
 		t           reflect.Type
@@ -521,8 +635,7 @@ func buildNquads(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode
 	}
 
 	// Single pass in declaration order; nested struct fields are collected separately.
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
+	for i, field := range structFields(t) {
 		rawTag := field.Tag.Get("dquely")
 		if rawTag == "-" {
 			continue
@@ -531,42 +644,80 @@ func buildNquads(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode
 		if predicate == "uid" {
 			continue
 		}
-		ft := field.Type
-		if (ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && hasUIDField(ft.Elem())) ||
-			(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct) ||
-			(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Ptr && ft.Elem().Elem().Kind() == reflect.Struct) {
+		if isEdgeType(field.Type) {
 			continue
 		}
-		fv := v.Field(i)
-		if fv.IsZero() {
+		fv, state := fieldValue(fieldByIndex(v, field.Index), rawTag)
+		if state != fieldPresent {
 			continue
 		}
-		var valStr string
-		if isJSON {
-			b, err := json.Marshal(fv.Interface())
-			if err != nil {
-				return fmt.Errorf("dquely: failed to marshal field %s as JSON: %w", field.Name, err)
-			}
-			valStr = strings.ReplaceAll(string(b), `"`, `\"`)
-		} else {
-			dfv := fv
-			if dfv.Kind() == reflect.Ptr {
-				dfv = dfv.Elem()
-			}
-			if tv, ok := dfv.Interface().(time.Time); ok {
-				valStr = tv.UTC().Format("2006-01-02T15:04:05")
+		for _, fv := range listValues(fv, isJSON) {
+			var valStr string
+			if isJSON {
+				b, err := json.Marshal(fv.Interface())
+				if err != nil {
+					return fmt.Errorf("dquely: failed to marshal field %s as JSON: %w", field.Name, err)
+				}
+				valStr = escapeLiteral(string(b))
 			} else {
-				valStr = fmt.Sprintf("%v", dfv.Interface())
+				dfv := fv
+				if dfv.Kind() == reflect.Ptr {
+					dfv = dfv.Elem()
+				}
+				if tv, ok := dfv.Interface().(time.Time); ok {
+					valStr = tv.UTC().Format("2006-01-02T15:04:05")
+				} else {
+					valStr = escapeLiteral(fmt.Sprintf("%v", dfv.Interface()))
+				}
 			}
+			sb.WriteString(fmt.Sprintf("%s <%s> \"%s\" .\n", subject, predicate, valStr))
+		}
+		norm, err := normalizedNquad(subject, v, t, i)
+		if err != nil {
+			return err
+		}
+		if norm != "" {
+			sb.WriteString(norm + "\n")
 		}
-		sb.WriteString(fmt.Sprintf("%s <%s> \"%s\" .\n", blankNode, predicate, valStr))
 	}
 
 	// Collect nested items in field declaration order (only in deep mode).
 	var nestedItems []nestedItem
+	addChild := func(field reflect.StructField, predicate string, childV reflect.Value, index int) error {
+		childT := childV.Type()
+		if uid := structUID(childV, childT); uid != "" {
+			nestedItems = append(nestedItems, nestedItem{
+				ref:         fmt.Sprintf("<%s>", uid),
+				predicate:   predicate,
+				skipContent: true,
+			})
+			return nil
+		}
+		if childT == t && childV.CanAddr() && v.CanAddr() && childV.Addr().Pointer() == v.Addr().Pointer() {
+			return fmt.Errorf("dquely: %s.%s points to the struct itself; self-references are not supported", t.Name(), field.Name)
+		}
+		if name, ok := n.lookup(childV); ok {
+			nestedItems = append(nestedItems, nestedItem{
+				ref:         name,
+				predicate:   predicate,
+				skipContent: true,
+			})
+			return nil
+		}
+		bn := childBlankNode(blankNode, predicate, index)
+		n.add(childV, bn, blankNode)
+		nestedItems = append(nestedItems, nestedItem{
+			ref:       bn,
+			blankNode: bn,
+			v:         childV,
+			t:         childT,
+			typeName:  nodeType(childV),
+			predicate: predicate,
+		})
+		return nil
+	}
 	if deep {
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
+		for _, field := range structFields(t) {
 			rawTag := field.Tag.Get("dquely")
 			if rawTag == "-" {
 				continue
@@ -576,83 +727,49 @@ func buildNquads(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode
 				continue
 			}
 			ft := field.Type
-			fv := v.Field(i)
+			fv := fieldByIndex(v, field.Index)
 
 			if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && hasUIDField(ft.Elem()) {
 				if fv.IsNil() {
 					continue
 				}
-				childV := fv.Elem()
-				childT := ft.Elem()
-				if uid := structUID(childV, childT); uid != "" {
-					nestedItems = append(nestedItems, nestedItem{
-						ref:         fmt.Sprintf("<%s>", uid),
-						predicate:   predicate,
-						skipContent: true,
-					})
-				} else {
-					bn := "_:" + predicate
-					nestedItems = append(nestedItems, nestedItem{
-						ref:       bn,
-						blankNode: bn,
-						v:         childV,
-						t:         childT,
-						typeName:  childT.Name(),
-						predicate: predicate,
-					})
+				if err := addChild(field, predicate, fv.Elem(), -1); err != nil {
+					return err
 				}
 			} else if ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct {
-				if fv.IsNil() || fv.Len() == 0 {
-					continue
-				}
-				childT := ft.Elem()
 				for j := 0; j < fv.Len(); j++ {
-					childV := fv.Index(j)
-					if uid := structUID(childV, childT); uid != "" {
-						nestedItems = append(nestedItems, nestedItem{
-							ref:         fmt.Sprintf("<%s>", uid),
-							predicate:   predicate,
-							skipContent: true,
-						})
-					} else {
-						bn := fmt.Sprintf("_:%s%d", predicate, j)
-						nestedItems = append(nestedItems, nestedItem{
-							ref:       bn,
-							blankNode: bn,
-							v:         childV,
-							t:         childT,
-							typeName:  childT.Name(),
-							predicate: predicate,
-						})
+					if err := addChild(field, predicate, fv.Index(j), j); err != nil {
+						return err
 					}
 				}
 			} else if ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Ptr && ft.Elem().Elem().Kind() == reflect.Struct {
-				if fv.IsNil() || fv.Len() == 0 {
-					continue
-				}
-				childT := ft.Elem().Elem()
 				for j := 0; j < fv.Len(); j++ {
-					elemPtr := fv.Index(j)
-					if elemPtr.IsNil() {
+					if fv.Index(j).IsNil() {
 						continue
 					}
-					childV := elemPtr.Elem()
-					if uid := structUID(childV, childT); uid != "" {
-						nestedItems = append(nestedItems, nestedItem{
-							ref:         fmt.Sprintf("<%s>", uid),
-							predicate:   predicate,
-							skipContent: true,
-						})
-					} else {
-						bn := fmt.Sprintf("_:%s%d", predicate, j)
-						nestedItems = append(nestedItems, nestedItem{
-							ref:       bn,
-							blankNode: bn,
-							v:         childV,
-							t:         childT,
-							typeName:  childT.Name(),
-							predicate: predicate,
-						})
+					if err := addChild(field, predicate, fv.Index(j).Elem(), j); err != nil {
+						return err
+					}
+				}
+			} else if isInterfaceEdge(ft) {
+				// Polymorphic edges: each value is written as the struct it holds.
+				values, index := []reflect.Value{fv}, -1
+				if ft.Kind() == reflect.Slice {
+					values, index = make([]reflect.Value, fv.Len()), 0
+					for j := range values {
+						values[j] = fv.Index(j)
+					}
+				}
+				for j, ev := range values {
+					childV, ok, err := concreteNode(ev)
+					if err != nil {
+						return fmt.Errorf("dquely: %s.%s: %w", t.Name(), field.Name, err)
+					}
+					if !ok {
+						continue
+					}
+					if err := addChild(field, predicate, childV, index+j); err != nil {
+						return err
 					}
 				}
 			}
@@ -661,11 +778,11 @@ func buildNquads(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode
 
 	// All nested refs go before dgraph.type (uid-based and blank-node alike).
 	for _, item := range nestedItems {
-		sb.WriteString(fmt.Sprintf("%s <%s> %s .\n", blankNode, item.predicate, item.ref))
+		sb.WriteString(fmt.Sprintf("%s <%s> %s .\n", subject, item.predicate, item.ref))
 	}
 
 	// dgraph.type is always the last triple for this node.
-	sb.WriteString(fmt.Sprintf("%s <dgraph.type> \"%s\" .", blankNode, typeName))
+	sb.WriteString(fmt.Sprintf("%s <dgraph.type> \"%s\" .", subject, typeName))
 
 	// Emit recursive content for blank-node children.
 	for _, item := range nestedItems {
@@ -673,7 +790,7 @@ func buildNquads(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode
 			continue
 		}
 		sb.WriteString("\n")
-		if err := buildNquads(sb, item.v, item.t, item.blankNode, item.typeName, true); err != nil {
+		if err := n.build(sb, item.v, item.t, item.blankNode, item.typeName, true); err != nil {
 			return err
 		}
 	}
@@ -681,83 +798,151 @@ func buildNquads(sb *strings.Builder, v reflect.Value, t reflect.Type, blankNode
 	return nil
 }
 
-// findUniquenessQuery recursively walks every nested struct field (both pointer-to-struct
-// and slice-of-struct) and returns the first DGraph query block (variable "v") for a
-// struct that has no uid but has at least one non-zero unique field.
-// Returns an empty string when no such struct is found at any depth.
-func findUniquenessQuery(v reflect.Value, t reflect.Type) string {
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
-		if rawTag == "-" {
-			continue
-		}
-		ft := t.Field(i).Type
-		fv := v.Field(i)
+// uniquenessBlock returns the query block binding name to the nodes of typeName that
+// match any of keys.
+func uniquenessBlock(name, typeName string, keys []uniqueKey) string {
+	return fmt.Sprintf("  %s as var(func: type(%s))\n    @filter(%s)", name, typeName, uniqueFilter(keys))
+}
 
-		// Collect all child struct values for this field.
-		type child struct {
-			v reflect.Value
-			t reflect.Type
+// uniqueBlocks returns a query block for every nested blank node with a complete
+// unique key, binding the existing nodes that hold those values to v1, v2, … in naming
+// order, and the variable of each such blank node.
+func (n *nquadNodes) uniqueBlocks(names mutationNames) ([]string, map[string]string, error) {
+	var blocks []string
+	vars := map[string]string{}
+	for _, bn := range n.order[1:] {
+		v := n.ptrs[bn].Elem()
+		keys, err := uniqueKeys(v, v.Type())
+		if err != nil {
+			return nil, nil, err
 		}
-		var children []child
-		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
-			if !fv.IsNil() {
-				children = append(children, child{fv.Elem(), ft.Elem()})
-			}
-		} else if ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct {
-			childT := ft.Elem()
-			for j := 0; j < fv.Len(); j++ {
-				children = append(children, child{fv.Index(j), childT})
-			}
+		if len(keys) == 0 {
+			continue
 		}
+		name := names.name("v" + strconv.Itoa(len(vars)+1))
+		vars[bn] = name
+		blocks = append(blocks, uniquenessBlock(name, nodeType(v), keys),
+			fmt.Sprintf("  %s(func: uid(%s)) {\n    uid\n  }", linkedBlock(name), name))
+	}
+	return blocks, vars, nil
+}
 
-		for _, c := range children {
-			if structUID(c.v, c.t) != "" {
-				continue // existing node — no insert query needed
-			}
+// linkedBlock names the query block returning the existing node bound to the
+// variable name, which a nested unique node is linked to instead of being created.
+func linkedBlock(name string) string {
+	return "linked_" + name
+}
 
-			// Collect non-zero unique fields on this child.
-			childTypeName := c.t.Name()
-			var nonZeroUniques []struct {
-				index     int
-				predicate string
-			}
-			for j := 0; j < c.t.NumField(); j++ {
-				rawChildTag := c.t.Field(j).Tag.Get("dquely")
-				if rawChildTag == "-" {
-					continue
-				}
-				pred, _, isUniq := parseTag(rawChildTag, c.t.Field(j).Name)
-				if pred == "uid" || !isUniq || c.v.Field(j).IsZero() {
-					continue
-				}
-				nonZeroUniques = append(nonZeroUniques, struct {
-					index     int
-					predicate string
-				}{j, pred})
-			}
+// linkedUIDs returns the uids of the existing nodes the nested unique nodes of a deep
+// mutation of data were linked to, keyed by blank node without "_:" or prefix, as
+// SetUIDs takes them. raw is the query result of the mutation.
+func linkedUIDs(data any, names mutationNames, raw []byte) (map[string]string, error) {
+	uids := map[string]string{}
+	if len(raw) == 0 {
+		return uids, nil
+	}
+	var result map[string][]struct {
+		Uid string `json:"uid"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	linked := false
+	for block := range result {
+		linked = linked || strings.HasPrefix(block, linkedBlock(""))
+	}
+	if !linked {
+		return uids, nil
+	}
+	root, err := BlankNodeName(data)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(data).Elem()
+	nodes := newNquadNodes()
+	nodes.add(v, "_:"+root, "")
+	var sb strings.Builder
+	if err := nodes.build(&sb, v, v.Type(), "_:"+root, dgraphTypeOf(data), true); err != nil {
+		return nil, err
+	}
+	_, vars, err := nodes.uniqueBlocks(names)
+	if err != nil {
+		return nil, err
+	}
+	for bn, name := range vars {
+		if existing := result[linkedBlock(name)]; len(existing) == 1 {
+			uids[strings.TrimPrefix(bn, "_:")] = existing[0].Uid
+		}
+	}
+	return uids, nil
+}
 
-			if len(nonZeroUniques) > 0 {
-				var qb strings.Builder
-				qb.WriteString("{\n")
-				qb.WriteString(fmt.Sprintf("  v as var(func: type(%s))\n    @filter(", childTypeName))
-				for k, f := range nonZeroUniques {
-					if k > 0 {
-						qb.WriteString(" OR ")
-					}
-					qb.WriteString(fmt.Sprintf("eq(%s, \"%v\")", f.predicate, c.v.Field(f.index).Interface()))
-				}
-				qb.WriteString(")\n}\n")
-				return qb.String()
+// guardNquads splits the N-quads of a deep mutation into conditional mutations. A
+// node with a variable in vars is only created when the variable is empty, together
+// with everything below it; otherwise the edges to it are written to uid(var), the
+// existing node. rootGuard conditions every line. Lines with the same conditions share
+// a mutation, in order of appearance.
+func (n *nquadNodes) guardNquads(nquads string, rootGuard []string, vars map[string]string) []*api.Mutation {
+	guards := map[string][]string{}
+	var guard func(bn string) []string
+	guard = func(bn string) []string {
+		if g, ok := guards[bn]; ok {
+			return g
+		}
+		parent, ok := n.parents[bn]
+		if !ok || parent == "" {
+			return rootGuard
+		}
+		g := append([]string(nil), guard(parent)...)
+		if name, ok := vars[bn]; ok {
+			g = append(g, fmt.Sprintf("eq(len(%s), 0)", name))
+		}
+		guards[bn] = g
+		return g
+	}
+	union := func(a, b []string) []string {
+		out := append([]string(nil), a...)
+		for _, atom := range b {
+			if !slices.Contains(out, atom) {
+				out = append(out, atom)
 			}
+		}
+		return out
+	}
 
-			// No unique fields on this child — recurse into its nested fields.
-			if q := findUniquenessQuery(c.v, c.t); q != "" {
-				return q
-			}
+	var conds []string
+	lines := map[string][]string{}
+	add := func(atoms []string, line string) {
+		cond := ""
+		if len(atoms) > 0 {
+			cond = "@if(" + strings.Join(atoms, " AND ") + ")"
+		}
+		if _, ok := lines[cond]; !ok {
+			conds = append(conds, cond)
 		}
+		lines[cond] = append(lines[cond], line)
 	}
-	return ""
+	for _, line := range strings.Split(nquads, "\n") {
+		subject, rest, _ := strings.Cut(line, " ")
+		predicate, object, _ := strings.Cut(rest, " ")
+		object = strings.TrimSuffix(object, " .")
+		atoms := guard(subject)
+		if !strings.HasPrefix(object, "_:") {
+			add(atoms, line)
+			continue
+		}
+		add(union(atoms, guard(object)), line)
+		if name, ok := vars[object]; ok {
+			add(union(atoms, []string{fmt.Sprintf("gt(len(%s), 0)", name)}),
+				fmt.Sprintf("%s %s uid(%s) .", subject, predicate, name))
+		}
+	}
+
+	mus := make([]*api.Mutation, len(conds))
+	for i, cond := range conds {
+		mus[i] = &api.Mutation{SetNquads: []byte(strings.Join(lines[cond], "\n")), Cond: cond}
+	}
+	return mus
 }
 
 // ParseMutation inspects input (a non-nil pointer to a struct with a dquely:"uid" field)
@@ -783,10 +968,37 @@ func findUniquenessQuery(v reflect.Value, t reflect.Type) string {
 //
 //   - "v" selects any other node of the same type whose unique predicates overlap with
 //     the provided values, excluding the current uid (must be 0 for no duplicates).
-//     SetNquads updates non-zero fields using the concrete uid reference (e.g. <0x1>).
-//     DelNquads deletes zero-value fields: non-unique predicates first, unique ones after.
+//     SetNquads updates the provided fields using the concrete uid reference (e.g. <0x1>).
+//     DelNquads deletes the fields that are not provided (zero values, nil pointers) and
+//     null Optionals: non-unique predicates first, unique ones after. Unset Optionals
+//     are left alone.
 //     The condition @if(eq(len(v), 0) AND eq(len(u), 1)) ensures both invariants hold.
+//
+// With deep set, every nested struct without a uid but with non-zero unique fields gets
+// its own variable (v1, v2, …) and the N-quads are split into conditional mutations:
+// the nested node is inserted when its variable is empty and linked through uid(vN)
+// otherwise.
 func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
+	return parseMutation(input, UniqueQuery, mutationNames{}, deep...)
+}
+
+// mutationNames makes the names a mutation defines distinct from those of other
+// mutations sent in the same request. The zero value keeps the plain names.
+type mutationNames struct {
+	prefix string // prepended to blank nodes, e.g. "m3." for _:m3.user
+	suffix string // appended to query variables and blocks, e.g. "_3" for v_3
+}
+
+// name returns the query variable or block name for this mutation.
+func (n mutationNames) name(name string) string {
+	return name + n.suffix
+}
+
+// parseMutation is ParseMutation with unique fields enforced by mode and the names
+// given by names. Under UniqueServer only composite keys are checked by the query;
+// without them an insert has no query or condition and an update only checks that
+// its node exists.
+func parseMutation(input any, mode UniqueMode, names mutationNames, deep ...bool) (string, []*api.Mutation, error) {
 	v := reflect.ValueOf(input)
 	t := reflect.TypeOf(input)
 	if v.Kind() != reflect.Ptr {
@@ -805,14 +1017,17 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 	if dm, ok := input.(DgraphMutation); ok {
 		typeName = dm.DgraphType()
 	}
-	blankNode := "_:" + strings.ToLower(typeName)
+	blankNode := "_:" + names.prefix + strings.ToLower(typeName)
+	uVar, vVar, dupsBlock := names.name("u"), names.name("v"), names.name(duplicatesBlock)
+
+	fields := structFields(t)
 
 	// Get uid value.
 	uid := ""
-	for i := 0; i < t.NumField(); i++ {
-		predicate, _, _ := parseTag(t.Field(i).Tag.Get("dquely"), t.Field(i).Name)
+	for _, field := range fields {
+		predicate, _, _ := parseTag(field.Tag.Get("dquely"), field.Name)
 		if predicate == "uid" {
-			uid = v.Field(i).String()
+			uid = fieldByIndex(v, field.Index).String()
 			break
 		}
 	}
@@ -826,12 +1041,12 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 	}
 	var allFields []fieldMeta
 	var uniqueFields []fieldMeta
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
+	for i, field := range fields {
+		rawTag := field.Tag.Get("dquely")
 		if rawTag == "-" {
 			continue
 		}
-		predicate, isJSON, isUnique := parseTag(rawTag, t.Field(i).Name)
+		predicate, isJSON, isUnique := parseTag(rawTag, field.Name)
 		if predicate == "uid" {
 			continue
 		}
@@ -844,77 +1059,69 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 
 	isDeep := len(deep) > 0 && deep[0]
 
-	// Structs with nested pointer-to-struct or slice-of-struct fields always use the
-	// buildNquads path regardless of unique fields.  Uniqueness for such structs must be
-	// enforced by the caller (the nested graph is mutated atomically).
+	// The unique keys whose fields are all set; only those are checked.
+	keys, err := uniqueKeys(v, t)
+	if err != nil {
+		return "", nil, err
+	}
+	keys = queryKeys(keys, mode)
+	// Dgraph enforces every unique field itself: no uniqueness query is needed.
+	serverOnly := mode == UniqueServer && !hasCompositeKey(t)
+
+	// Structs with nested pointer-to-struct, slice-of-struct or interface edge fields
+	// always use the buildNquads path regardless of unique fields.
 	hasNested := false
-	for i := 0; i < t.NumField(); i++ {
-		rawTag := t.Field(i).Tag.Get("dquely")
+	for _, field := range fields {
+		rawTag := field.Tag.Get("dquely")
 		if rawTag == "-" {
 			continue
 		}
-		ft := t.Field(i).Type
+		ft := field.Type
 		if (ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct) ||
 			(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct) ||
-			(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Ptr && ft.Elem().Elem().Kind() == reflect.Struct) {
+			(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Ptr && ft.Elem().Elem().Kind() == reflect.Struct) ||
+			isInterfaceEdge(ft) {
 			hasNested = true
 			break
 		}
 	}
 	if hasNested {
+		nodes := newNquadNodes()
+		nodes.add(v, blankNode, "")
 		var sb strings.Builder
-		if err := buildNquads(&sb, v, t, blankNode, typeName, isDeep); err != nil {
+		if err := nodes.build(&sb, v, t, blankNode, typeName, isDeep); err != nil {
 			return "", nil, err
 		}
-		nquads := []byte(sb.String())
 
-		// No unique fields on root: recursively search nested fields for unique fields.
-		if len(uniqueFields) == 0 {
-			if isDeep {
-				if q := findUniquenessQuery(v, t); q != "" {
-					mu := &api.Mutation{
-						SetNquads: nquads,
-						Cond:      "@if(eq(len(v), 0))",
-					}
-					return q, []*api.Mutation{mu}, nil
-				}
+		// Has unique fields and uid is empty (nested Case B): the root is only inserted
+		// when no node holds its unique values.
+		var blocks, rootGuard []string
+		if len(uniqueFields) > 0 && uid == "" && !serverOnly {
+			blocks = append(blocks, uniquenessBlock(vVar, typeName, keys))
+			if len(keys) > 0 {
+				blocks = append(blocks, duplicatesQuery(dupsBlock, vVar, keys))
 			}
-			return "", []*api.Mutation{{SetNquads: nquads}}, nil
+			rootGuard = []string{fmt.Sprintf("eq(len(%s), 0)", vVar)}
 		}
 
-		// Has unique fields and uid is empty (nested Case B): generate query+condition
-		// for duplicate prevention while using the deep N-quads as the mutation body.
-		if uid == "" {
-			var nonZeroUniques []fieldMeta
-			for _, f := range uniqueFields {
-				if !v.Field(f.index).IsZero() {
-					nonZeroUniques = append(nonZeroUniques, f)
-				}
-			}
-			var qb strings.Builder
-			qb.WriteString("{\n")
-			qb.WriteString(fmt.Sprintf("  v as var(func: type(%s))\n    @filter(", typeName))
-			for i, f := range nonZeroUniques {
-				if i > 0 {
-					qb.WriteString(" OR ")
-				}
-				val := fmt.Sprintf("%v", v.Field(f.index).Interface())
-				qb.WriteString(fmt.Sprintf("eq(%s, \"%s\")", f.predicate, val))
+		// Nested nodes with unique fields are linked to the existing node holding
+		// their values instead of being inserted again.
+		var vars map[string]string
+		if isDeep {
+			var nested []string
+			if nested, vars, err = nodes.uniqueBlocks(names); err != nil {
+				return "", nil, err
 			}
+			blocks = append(blocks, nested...)
+		}
+		query := ""
+		if len(blocks) > 0 {
+			query = "{\n" + strings.Join(blocks, "\n\n") + "\n}"
 			if isDeep {
-				qb.WriteString(")\n}\n")
-			} else {
-				qb.WriteString(")\n}")
-			}
-			mu := &api.Mutation{
-				SetNquads: nquads,
-				Cond:      "@if(eq(len(v), 0))",
+				query += "\n"
 			}
-			return qb.String(), []*api.Mutation{mu}, nil
 		}
-
-		// uid is non-empty: uid-based update, no duplicate query needed.
-		return "", []*api.Mutation{{SetNquads: nquads}}, nil
+		return query, nodes.guardNquads(sb.String(), rootGuard, vars), nil
 	}
 
 	// Case A: No unique fields, no nested structs — raw N-quads, no condition.
@@ -926,44 +1133,38 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 		return "", []*api.Mutation{{SetNquads: []byte(sb.String())}}, nil
 	}
 
-	// Non-zero unique fields used for query filter.
-	var nonZeroUniques []fieldMeta
-	for _, f := range uniqueFields {
-		if !v.Field(f.index).IsZero() {
-			nonZeroUniques = append(nonZeroUniques, f)
-		}
-	}
-
 	// valueStr returns the string representation of a field value.
-	valueStr := func(fm fieldMeta) (string, error) {
-		fv := v.Field(fm.index)
+	valueStr := func(fm fieldMeta, fv reflect.Value) (string, error) {
 		if fm.isJSON {
 			b, err := json.Marshal(fv.Interface())
 			if err != nil {
 				return "", fmt.Errorf("dquely: failed to marshal field %s as JSON: %w",
-					t.Field(fm.index).Name, err)
+					fields[fm.index].Name, err)
 			}
-			return strings.ReplaceAll(string(b), `"`, `\"`), nil
+			return escapeLiteral(string(b)), nil
 		}
-		return fmt.Sprintf("%v", fv.Interface()), nil
+		return escapeLiteral(fmt.Sprintf("%v", fv.Interface())), nil
 	}
 
 	// Case B: Insert (uid == "").
+	if uid == "" && serverOnly {
+		var sb strings.Builder
+		if err := buildNquads(&sb, v, t, blankNode, typeName, false); err != nil {
+			return "", nil, err
+		}
+		return "", []*api.Mutation{{SetNquads: []byte(sb.String())}}, nil
+	}
 	if uid == "" {
 		var qb strings.Builder
 		qb.WriteString("{\n")
-		qb.WriteString(fmt.Sprintf("  v as var(func: type(%s))\n    @filter(", typeName))
-		for i, f := range nonZeroUniques {
-			if i > 0 {
-				qb.WriteString(" OR ")
-			}
-			val := fmt.Sprintf("%v", v.Field(f.index).Interface())
-			qb.WriteString(fmt.Sprintf("eq(%s, \"%s\")", f.predicate, val))
+		qb.WriteString(uniquenessBlock(vVar, typeName, keys))
+		if len(keys) > 0 {
+			qb.WriteString("\n\n" + duplicatesQuery(dupsBlock, vVar, keys))
 		}
 		if isDeep {
-			qb.WriteString(")\n}\n")
+			qb.WriteString("\n}\n")
 		} else {
-			qb.WriteString(")\n}")
+			qb.WriteString("\n}")
 		}
 
 		var sb strings.Builder
@@ -974,7 +1175,7 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 
 		mu := &api.Mutation{
 			SetNquads: nquads,
-			Cond:      "@if(eq(len(v), 0))",
+			Cond:      fmt.Sprintf("@if(eq(len(%s), 0))", vVar),
 		}
 		return qb.String(), []*api.Mutation{mu}, nil
 	}
@@ -985,53 +1186,74 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 	// Build query with two-variable block.
 	var qb strings.Builder
 	qb.WriteString("{\n")
-	qb.WriteString(fmt.Sprintf("  u as var(func: uid(%s)) @filter(type(%s))\n\n", uid, typeName))
-	qb.WriteString(fmt.Sprintf("  v as var(func: type(%s))\n", typeName))
-	if len(nonZeroUniques) >= 2 {
+	qb.WriteString(fmt.Sprintf("  %s as var(func: uid(%s)) @filter(type(%s))\n", uVar, uid, typeName))
+	cond := fmt.Sprintf("@if(eq(len(%s), 0) AND eq(len(%s), 1))", vVar, uVar)
+	if serverOnly {
+		cond = fmt.Sprintf("@if(eq(len(%s), 1))", uVar)
+	} else {
+		qb.WriteString(fmt.Sprintf("\n  %s as var(func: type(%s))\n", vVar, typeName))
+	}
+	if len(keys) >= 2 {
 		// Tab-indented @filter for multiple unique conditions.
-		qb.WriteString("\t@filter(\n\t  (")
-		for i, f := range nonZeroUniques {
-			if i > 0 {
-				qb.WriteString(" OR ")
-			}
-			val := fmt.Sprintf("%v", v.Field(f.index).Interface())
-			qb.WriteString(fmt.Sprintf("eq(%s, \"%s\")", f.predicate, val))
-		}
-		qb.WriteString(")\n")
-		qb.WriteString(fmt.Sprintf("\t  AND NOT uid(%s)\n\t)\n}", uid))
-	} else if len(nonZeroUniques) == 1 {
+		qb.WriteString(fmt.Sprintf("\t@filter(\n\t  (%s)\n", uniqueFilter(keys)))
+		qb.WriteString(fmt.Sprintf("\t  AND NOT uid(%s)\n\t)\n", uid))
+	} else if len(keys) == 1 {
 		// 4-space-indented @filter for a single unique condition.
-		f := nonZeroUniques[0]
-		val := fmt.Sprintf("%v", v.Field(f.index).Interface())
-		qb.WriteString(fmt.Sprintf("    @filter(\n      eq(%s, \"%s\") AND NOT uid(%s)\n    )\n}", f.predicate, val, uid))
-	} else {
-		qb.WriteString("}")
+		qb.WriteString(fmt.Sprintf("    @filter(\n      %s AND NOT uid(%s)\n    )\n", keys[0].filter(), uid))
+	}
+	if len(keys) > 0 {
+		// The nodes that block the update, for DuplicateError.
+		qb.WriteString("\n" + duplicatesQuery(dupsBlock, vVar, keys) + "\n")
+	}
+	qb.WriteString("}")
+
+	// deleted reports whether an update deletes the field: a null Optional, or an
+	// absent value other than an unset Optional.
+	deleted := func(fm fieldMeta) bool {
+		_, state := fieldValue(fieldByIndex(v, fields[fm.index].Index), fields[fm.index].Tag.Get("dquely"))
+		_, isOptional := optionalElem(fields[fm.index].Type)
+		return state == fieldNull || state == fieldAbsent && !isOptional
+	}
+	// replaced reports whether an update writes the field as a list.
+	replaced := func(fm fieldMeta) bool {
+		fv, state := fieldValue(fieldByIndex(v, fields[fm.index].Index), fields[fm.index].Tag.Get("dquely"))
+		return state == fieldPresent && !fm.isJSON && isScalarList(fv.Type())
 	}
 
-	// Build SetNquads: declaration order, non-uid non-zero fields, no dgraph.type.
+	// Build SetNquads: declaration order, non-uid present fields, no dgraph.type.
 	var setSB strings.Builder
 	firstSet := true
 	for _, fm := range allFields {
-		fv := v.Field(fm.index)
-		if fv.IsZero() {
+		fv, state := fieldValue(fieldByIndex(v, fields[fm.index].Index), fields[fm.index].Tag.Get("dquely"))
+		if state != fieldPresent {
 			continue
 		}
-		val, err := valueStr(fm)
+		for _, fv := range listValues(fv, fm.isJSON) {
+			val, err := valueStr(fm, fv)
+			if err != nil {
+				return "", nil, err
+			}
+			if !firstSet {
+				setSB.WriteByte('\n')
+			}
+			setSB.WriteString(fmt.Sprintf("%s <%s> \"%s\" .", uidRef, fm.predicate, val))
+			firstSet = false
+		}
+		norm, err := normalizedNquad(uidRef, v, t, fm.index)
 		if err != nil {
 			return "", nil, err
 		}
-		if !firstSet {
-			setSB.WriteByte('\n')
+		if norm != "" {
+			setSB.WriteString("\n" + norm)
 		}
-		setSB.WriteString(fmt.Sprintf("%s <%s> \"%s\" .", uidRef, fm.predicate, val))
-		firstSet = false
 	}
 
-	// Build DelNquads: non-unique zero fields first, then unique zero fields.
+	// Build DelNquads: non-unique deleted or replaced fields first, then unique deleted
+	// fields. A list is replaced by deleting its values before the new ones are set.
 	var delSB strings.Builder
 	firstDel := true
 	for _, fm := range allFields {
-		if fm.isUnique || !v.Field(fm.index).IsZero() {
+		if fm.isUnique || !deleted(fm) && !replaced(fm) {
 			continue
 		}
 		if !firstDel {
@@ -1041,7 +1263,7 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 		firstDel = false
 	}
 	for _, fm := range uniqueFields {
-		if !v.Field(fm.index).IsZero() {
+		if !deleted(fm) {
 			continue
 		}
 		if !firstDel {
@@ -1049,12 +1271,15 @@ func ParseMutation(input any, deep ...bool) (string, []*api.Mutation, error) {
 		}
 		delSB.WriteString(fmt.Sprintf("%s <%s> * .", uidRef, fm.predicate))
 		firstDel = false
+		if norm := normalizedDelete(uidRef, fields[fm.index].Tag.Get("dquely"), fm.predicate); norm != "" {
+			delSB.WriteString("\n" + norm)
+		}
 	}
 
 	mu := &api.Mutation{
 		SetNquads: []byte(setSB.String()),
 		DelNquads: []byte(delSB.String()),
-		Cond:      "@if(eq(len(v), 0) AND eq(len(u), 1))",
+		Cond:      cond,
 	}
 	return qb.String(), []*api.Mutation{mu}, nil
 }
@@ -1070,7 +1295,7 @@ func formatFieldValue(fv reflect.Value, isJSON bool) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		return `"` + strings.ReplaceAll(string(b), `"`, `\"`) + `"`, nil
+		return `"` + escapeLiteral(string(b)) + `"`, nil
 	}
 	if fv.Kind() == reflect.Ptr {
 		fv = fv.Elem()
@@ -1078,7 +1303,15 @@ func formatFieldValue(fv reflect.Value, isJSON bool) (string, error) {
 	if t, ok := fv.Interface().(time.Time); ok {
 		return `"` + t.UTC().Format("2006-01-02T15:04:05") + `"`, nil
 	}
-	return `"` + fmt.Sprintf("%v", fv.Interface()) + `"`, nil
+	return `"` + escapeLiteral(fmt.Sprintf("%v", fv.Interface())) + `"`, nil
+}
+
+// literalEscaper escapes the characters that would end or corrupt an N-Quad literal.
+var literalEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// escapeLiteral escapes s for use between the quotes of an N-Quad literal.
+func escapeLiteral(s string) string {
+	return literalEscaper.Replace(s)
 }
 
 
@@ -1088,12 +1321,14 @@ func formatFieldValue(fv reflect.Value, isJSON bool) (string, error) {
 //
 // Pass FieldAll ("_all_") to include all non-uid, non-zero fields in the update.
 // Pass one or more predicate names to limit the update to those specific fields.
+// A list field replaces the stored values; prefix its predicate with "+" to append
+// the values instead, or with "-" to remove them.
 //
 // The returned query string is wrapped in a "{}" block, suitable for use directly
 // in an api.Request. The mutation carries:
 //   - SetNquads: scalar values as typed literals; relationship fields as <uid> references.
-//   - DelNquads: a wildcard delete for every relationship field that was requested, so
-//     stale edges are cleared before the new references are written.
+//   - DelNquads: a wildcard delete for every relationship or replaced list field that
+//     was requested, so stale values are cleared before the new ones are written.
 //   - Cond: "@if(eq(len(v), 1))" — only fires when exactly one node matches the uid
 func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 	v := reflect.ValueOf(input)
@@ -1115,10 +1350,10 @@ func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 		typeName = dm.DgraphType()
 	}
 	uid := ""
-	for i := 0; i < t.NumField(); i++ {
-		predicate, _, _ := parseTag(t.Field(i).Tag.Get("dquely"), t.Field(i).Name)
+	for _, field := range structFields(t) {
+		predicate, _, _ := parseTag(field.Tag.Get("dquely"), field.Name)
 		if predicate == "uid" {
-			uid = v.Field(i).String()
+			uid = fieldByIndex(v, field.Index).String()
 			break
 		}
 	}
@@ -1126,11 +1361,12 @@ func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 		return "", nil, fmt.Errorf("dquely: ParseUpdate requires a non-empty uid field")
 	}
 
-	var fieldSet map[string]bool
+	var fieldSet map[string]listOp
 	if !(len(fields) == 1 && fields[0] == FieldAll) {
-		fieldSet = make(map[string]bool, len(fields))
+		fieldSet = make(map[string]listOp, len(fields))
 		for _, f := range fields {
-			fieldSet[f] = true
+			predicate, op := parseUpdateField(f)
+			fieldSet[predicate] = op
 		}
 	}
 
@@ -1155,16 +1391,17 @@ func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 		firstDel = false
 	}
 
-	// blankChild holds a []Struct element that has no uid and needs inline N-quad content.
+	// blankChild holds a []Struct or interface slice element that has no uid and needs
+	// inline N-quad content.
 	type blankChild struct {
-		bn        string
-		v         reflect.Value
-		t         reflect.Type
+		bn       string
+		v        reflect.Value
+		t        reflect.Type
+		typeName string // dgraph.type of a polymorphic child, resolved at run time
 	}
 	var blankChildren []blankChild
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
+	for i, field := range structFields(t) {
 		rawTag := field.Tag.Get("dquely")
 		if rawTag == "-" {
 			continue
@@ -1173,11 +1410,16 @@ func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 		if predicate == "uid" {
 			continue
 		}
-		if fieldSet != nil && !fieldSet[predicate] {
+		op, ok := fieldSet[predicate]
+		if fieldSet != nil && !ok {
 			continue
 		}
 		ft := field.Type
-		fv := v.Field(i)
+		fv := fieldByIndex(v, field.Index)
+		isList := !isJSON && isScalarList(scalarOf(ft))
+		if op != listReplace && !isList {
+			return "", nil, fmt.Errorf("dquely: ParseUpdate: only list fields can be appended to or removed from, got %s", field.Name)
+		}
 
 		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && hasUIDField(ft.Elem()) {
 			if !fv.IsNil() {
@@ -1193,10 +1435,9 @@ func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 				if childUID := structUID(childV, childT); childUID != "" {
 					appendSet(fmt.Sprintf("uid(v) <%s> <%s> .", predicate, childUID))
 				} else {
-					name := childT.Name()
-				bn := fmt.Sprintf("_:%s%s%d", strings.ToLower(name[:1]), name[1:], j)
+					bn := childBlankNode("_:"+strings.ToLower(typeName), predicate, j)
 					appendSet(fmt.Sprintf("uid(v) <%s> %s .", predicate, bn))
-					blankChildren = append(blankChildren, blankChild{bn, childV, childT})
+					blankChildren = append(blankChildren, blankChild{bn, childV, childT, ""})
 				}
 			}
 			appendDel(fmt.Sprintf("uid(v) <%s> * .", predicate))
@@ -1211,22 +1452,74 @@ func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 					appendSet(fmt.Sprintf("uid(v) <%s> <%s> .", predicate, childUID))
 				}
 			}
+		} else if ft.Kind() == reflect.Interface && isInterfaceEdge(ft) {
+			childV, ok, err := concreteNode(fv)
+			if err != nil {
+				return "", nil, fmt.Errorf("dquely: %s.%s: %w", t.Name(), field.Name, err)
+			}
+			if ok {
+				if childUID := structUID(childV, childV.Type()); childUID != "" {
+					appendSet(fmt.Sprintf("uid(v) <%s> <%s> .", predicate, childUID))
+				}
+			}
+			appendDel(fmt.Sprintf("uid(v) <%s> * .", predicate))
+		} else if isInterfaceEdge(ft) {
+			for j := 0; j < fv.Len(); j++ {
+				childV, ok, err := concreteNode(fv.Index(j))
+				if err != nil {
+					return "", nil, fmt.Errorf("dquely: %s.%s: %w", t.Name(), field.Name, err)
+				}
+				if !ok {
+					continue
+				}
+				if childUID := structUID(childV, childV.Type()); childUID != "" {
+					appendSet(fmt.Sprintf("uid(v) <%s> <%s> .", predicate, childUID))
+				} else {
+					bn := childBlankNode("_:"+strings.ToLower(typeName), predicate, j)
+					appendSet(fmt.Sprintf("uid(v) <%s> %s .", predicate, bn))
+					blankChildren = append(blankChildren, blankChild{bn, childV, childV.Type(), nodeType(childV)})
+				}
+			}
+			appendDel(fmt.Sprintf("uid(v) <%s> * .", predicate))
 		} else {
-			if fv.IsZero() {
+			fv, state := fieldValue(fv, rawTag)
+			if state == fieldNull {
+				appendDel(fmt.Sprintf("uid(v) <%s> * .", predicate))
+				if norm := normalizedDelete("uid(v)", rawTag, predicate); norm != "" {
+					appendDel(norm)
+				}
+				continue
+			}
+			if state != fieldPresent {
 				continue
 			}
-			val, err := formatFieldValue(fv, isJSON)
+			if isList && op == listReplace {
+				appendDel(fmt.Sprintf("uid(v) <%s> * .", predicate))
+			}
+			for _, fv := range listValues(fv, isJSON) {
+				val, err := formatFieldValue(fv, isJSON)
+				if err != nil {
+					return "", nil, fmt.Errorf("dquely: field %s: %w", field.Name, err)
+				}
+				if op == listRemove {
+					appendDel(fmt.Sprintf("uid(v) <%s> %s .", predicate, val))
+				} else {
+					appendSet(fmt.Sprintf("uid(v) <%s> %s .", predicate, val))
+				}
+			}
+			norm, err := normalizedNquad("uid(v)", v, t, i)
 			if err != nil {
-				return "", nil, fmt.Errorf("dquely: field %s: %w", field.Name, err)
+				return "", nil, err
+			}
+			if norm != "" {
+				appendSet(norm)
 			}
-			appendSet(fmt.Sprintf("uid(v) <%s> %s .", predicate, val))
 		}
 	}
 
 	// Emit inline N-quad content for []Struct blank-node children (no uid).
 	for _, bc := range blankChildren {
-		for k := 0; k < bc.t.NumField(); k++ {
-			cf := bc.t.Field(k)
+		for k, cf := range structFields(bc.t) {
 			cRawTag := cf.Tag.Get("dquely")
 			if cRawTag == "-" {
 				continue
@@ -1236,26 +1529,39 @@ func ParseUpdate(input any, fields ...string) (string, []*api.Mutation, error) {
 				continue
 			}
 			cft := cf.Type
-			cfv := bc.v.Field(k)
+			cfv := fieldByIndex(bc.v, cf.Index)
 			if cft.Kind() == reflect.Ptr && cft.Elem().Kind() == reflect.Struct {
 				if !cfv.IsNil() {
 					if nestedUID := structUID(cfv.Elem(), cft.Elem()); nestedUID != "" {
 						appendSet(fmt.Sprintf("%s <%s> <%s> .", bc.bn, cPredicate, nestedUID))
 					}
 				}
-			} else if cft.Kind() == reflect.Slice {
+			} else if cft.Kind() == reflect.Slice && !isScalarList(cft) {
 				// skip slices in child content for now
 			} else {
-				if cfv.IsZero() {
+				cfv, state := fieldValue(cfv, cRawTag)
+				if state != fieldPresent {
 					continue
 				}
-				val, err := formatFieldValue(cfv, cIsJSON)
+				for _, cfv := range listValues(cfv, cIsJSON) {
+					val, err := formatFieldValue(cfv, cIsJSON)
+					if err != nil {
+						return "", nil, fmt.Errorf("dquely: field %s: %w", cf.Name, err)
+					}
+					appendSet(fmt.Sprintf("%s <%s> %s .", bc.bn, cPredicate, val))
+				}
+				norm, err := normalizedNquad(bc.bn, bc.v, bc.t, k)
 				if err != nil {
-					return "", nil, fmt.Errorf("dquely: field %s: %w", cf.Name, err)
+					return "", nil, err
+				}
+				if norm != "" {
+					appendSet(norm)
 				}
-				appendSet(fmt.Sprintf("%s <%s> %s .", bc.bn, cPredicate, val))
 			}
 		}
+		if bc.typeName != "" {
+			appendSet(fmt.Sprintf("%s <dgraph.type> \"%s\" .", bc.bn, bc.typeName))
+		}
 	}
 
 	query := fmt.Sprintf("{\n  v as var(func: uid(%s))\n    @filter(type(%s))\n}", uid, typeName)
@@ -1,6 +1,10 @@
 package dquely_test
 
-import "time"
+import (
+	"time"
+
+	"github.com/vibros68/dquely"
+)
 
 const userMutationMock = `uid(v) <name> "Alice" .
 uid(v) <age> "29" .`
@@ -150,6 +154,12 @@ const userWithUniqueMutationFullMock = `{
 const userUniqueSingleQuery = `{
   v as var(func: type(User))
     @filter(eq(userName, "alice") OR eq(email, "alice@example.com"))
+
+  duplicates(func: uid(v)) {
+    uid
+    userName
+    email
+  }
 }`
 
 const userUniqueCondMock = `@if(eq(len(v), 0))`
@@ -158,6 +168,11 @@ const userUniqueWithUidCondMock = `@if(eq(len(v), 0) AND eq(len(u), 1))`
 const userUniqueLackingSingleQuery = `{
   v as var(func: type(User))
     @filter(eq(userName, "alice"))
+
+  duplicates(func: uid(v)) {
+    uid
+    userName
+  }
 }`
 
 const userWithUniqueLackingMutationMock = `_:user <userName> "alice" .
@@ -172,6 +187,12 @@ const userUniqueSingleWithUidQuery = `{
 	  (eq(userName, "alice") OR eq(email, "alice@example.com"))
 	  AND NOT uid(0x1)
 	)
+
+  duplicates(func: uid(v)) {
+    uid
+    userName
+    email
+  }
 }`
 
 const userUniqueLackingSingleWithUidQuery = `{
@@ -181,6 +202,11 @@ const userUniqueLackingSingleWithUidQuery = `{
     @filter(
       eq(userName, "alice") AND NOT uid(0x1)
     )
+
+  duplicates(func: uid(v)) {
+    uid
+    userName
+  }
 }`
 
 const userUniqueLackingWithUidSquads = `<0x1> <userName> "alice" .
@@ -251,3 +277,353 @@ type Tax struct {
 	Description string  `json:"description,omitempty" dquely:"description"`
 	Value       float64 `json:"value,omitempty" dquely:"value"`
 }
+
+const userJSONMutationMock = `{"uid":"_:user","name":"Al \"the\" pal","age":29,"dgraph.type":"User"}`
+
+const userWithUniqueUpdateSetJSONMock = `{"uid":"0x1","userName":"alice","age":29}`
+
+const userWithUniqueUpdateDeleteJSONMock = `{"uid":"0x1","email":null}`
+
+const companyDeepJSONMock = `{"uid":"_:company","name":"Acme","owner":{"uid":"_:company.owner","name":"Bob","dgraph.type":"ShortUser"},"staffs":[{"uid":"_:company.staffs0","name":"C","dgraph.type":"ShortUser"},{"uid":"0x9"}],"dgraph.type":"Company"}`
+
+const companyUpdateSetJSONMock = `{"uid":"uid(v)","name":"Acme","staffs":[{"uid":"_:company.staffs0","name":"C"},{"uid":"0x9"}]}`
+
+const companyUpdateDeleteJSONMock = `{"uid":"uid(v)","owner":null,"staffs":null}`
+
+const rdfWriterMock = `_:r0.company <name> "Acme" .
+_:r0.company <owner> _:r0.company.owner .
+_:r0.company <staffs> _:r0.company.staffs0 .
+_:r0.company <staffs> <0x9> .
+_:r0.company <dgraph.type> "Company" .
+_:r0.company.owner <name> "Bob" .
+_:r0.company.owner <dgraph.type> "ShortUser" .
+_:r0.company.staffs0 <name> "C" .
+_:r0.company.staffs0 <dgraph.type> "ShortUser" .
+_:r1.company <name> "Initech" .
+_:r1.company <owner> _:r1.company.owner .
+_:r1.company <dgraph.type> "Company" .
+_:r1.company.owner <name> "Bill" .
+_:r1.company.owner <dgraph.type> "ShortUser" .
+_:r2.user <userName> "alice" .
+_:r2.user <email> "alice@example.com" .
+_:r2.user <dgraph.type> "User" .
+`
+
+const rdfWriterSchemaMock = `age: int .
+email: string @index(exact) @upsert .
+link: uid .
+name: string .
+owner: uid .
+staffs: [uid] .
+userName: string @index(exact) @upsert .
+
+type Company {
+  name
+  owner
+  staffs
+}
+
+type ShortUser {
+  name
+  link
+}
+
+type User {
+  name
+  age
+  email
+  userName
+}
+`
+
+type Contact struct {
+	Uid       string         `dquely:"uid"`
+	Name      string         `dquely:"name"`
+	Nickname  string         `dquely:"name@en"`
+	Email     string         `dquely:"email,unique"`
+	Roles     map[string]int `dquely:"roles,json"`
+	CreatedAt time.Time      `dquely:"createdAt"`
+	Friends   []*Contact     `dquely:"friends"`
+}
+
+// contactExportMock is in the format of a Dgraph export, namespace label included.
+const contactExportMock = `<0x1> <name> "Alice" <0x0> .
+<0x1> <name> "Ali"@en <0x0> .
+<0x1> <email> "alice@example.com" <0x0> .
+<0x1> <roles> "{\"admin\":2}" <0x0> .
+<0x1> <createdAt> "2024-05-01T10:00:00Z"^^<xs:dateTime> <0x0> .
+<0x1> <friends> <0x2> <0x0> .
+<0x1> <dgraph.type> "Contact" <0x0> .
+<0x2> <name> "Bob" <0x0> .
+`
+
+const companyLinksMutationMock = `_:company <name> "A" .
+_:company <owner> _:company.owner .
+_:company <staffs> _:company.staffs0 .
+_:company <dgraph.type> "Company" .
+_:company.owner <name> "U" .
+_:company.owner <link> _:company.owner.link .
+_:company.owner <dgraph.type> "ShortUser" .
+_:company.owner.link <name> "UL" .
+_:company.owner.link <dgraph.type> "User" .
+_:company.staffs0 <name> "S1" .
+_:company.staffs0 <link> _:company.staffs0.link .
+_:company.staffs0 <dgraph.type> "ShortUser" .
+_:company.staffs0.link <name> "SL" .
+_:company.staffs0.link <dgraph.type> "User" .`
+
+// companySharedMutationMock writes the User shared by the owner and the staff once.
+const companySharedMutationMock = `_:company <name> "A" .
+_:company <owner> _:company.owner .
+_:company <staffs> _:company.staffs0 .
+_:company <dgraph.type> "Company" .
+_:company.owner <name> "U" .
+_:company.owner <link> _:company.owner.link .
+_:company.owner <dgraph.type> "ShortUser" .
+_:company.owner.link <name> "L" .
+_:company.owner.link <dgraph.type> "User" .
+_:company.staffs0 <name> "S1" .
+_:company.staffs0 <link> _:company.owner.link .
+_:company.staffs0 <dgraph.type> "ShortUser" .`
+
+const contactCycleQueryMock = `{
+  v as var(func: type(Contact))
+    @filter(eq(email, "alice@example.com"))
+
+  duplicates(func: uid(v)) {
+    uid
+    email
+  }
+}
+`
+
+// contactCycleMutationMock closes the Alice -> Bob -> Alice cycle with an edge to _:contact.
+const contactCycleMutationMock = `_:contact <name> "Alice" .
+_:contact <email> "alice@example.com" .
+_:contact <friends> _:contact.friends0 .
+_:contact <friends> _:contact.friends0 .
+_:contact <dgraph.type> "Contact" .
+_:contact.friends0 <name> "Bob" .
+_:contact.friends0 <friends> _:contact .
+_:contact.friends0 <dgraph.type> "Contact" .`
+
+const contactNestedUniqueQueryMock = `{
+  v as var(func: type(Contact))
+    @filter(eq(email, "alice@example.com"))
+
+  duplicates(func: uid(v)) {
+    uid
+    email
+  }
+
+  v1 as var(func: type(Contact))
+    @filter(eq(email, "bob@example.com"))
+
+  linked_v1(func: uid(v1)) {
+    uid
+  }
+
+  v2 as var(func: type(Contact))
+    @filter(eq(email, "dave@example.com"))
+
+  linked_v2(func: uid(v2)) {
+    uid
+  }
+}
+`
+
+// contactNestedUniqueMutationMocks inserts Bob and Dave only when their emails are
+// new, and otherwise links the existing nodes.
+var contactNestedUniqueMutationMocks = []struct{ cond, set string }{
+	{"@if(eq(len(v), 0))", `_:contact <name> "Alice" .
+_:contact <email> "alice@example.com" .
+_:contact <friends> _:contact.friends1 .
+_:contact <dgraph.type> "Contact" .
+_:contact.friends1 <name> "Carol" .
+_:contact.friends1 <dgraph.type> "Contact" .`},
+	{"@if(eq(len(v), 0) AND eq(len(v1), 0))", `_:contact <friends> _:contact.friends0 .
+_:contact.friends0 <name> "Bob" .
+_:contact.friends0 <email> "bob@example.com" .
+_:contact.friends0 <dgraph.type> "Contact" .`},
+	{"@if(eq(len(v), 0) AND gt(len(v1), 0))", `_:contact <friends> uid(v1) .`},
+	{"@if(eq(len(v), 0) AND eq(len(v1), 0) AND eq(len(v2), 0))", `_:contact.friends0 <friends> _:contact.friends0.friends0 .
+_:contact.friends0.friends0 <name> "Dave" .
+_:contact.friends0.friends0 <email> "dave@example.com" .
+_:contact.friends0.friends0 <dgraph.type> "Contact" .`},
+	{"@if(eq(len(v), 0) AND eq(len(v1), 0) AND gt(len(v2), 0))", `_:contact.friends0 <friends> uid(v2) .`},
+}
+
+const userUpsertQueryMock = `{
+  existing(func: type(User)) @filter(eq(userName, "alice") OR eq(email, "alice@example.com")) {
+    v as uid
+    userName
+    email
+  }
+}`
+
+const userUpsertCreateMock = `_:user <userName> "alice" .
+_:user <email> "alice@example.com" .
+_:user <age> "29" .
+_:user <dgraph.type> "User" .`
+
+const userUpsertUpdateMock = `uid(v) <age> "29" .`
+
+// TenantUser has a composite key, tenant plus normalized email, and a handle that is
+// unique regardless of case.
+type TenantUser struct {
+	Uid    string `dquely:"uid"`
+	Tenant string `dquely:"tenant,unique=tenant_email"`
+	Email  string `dquely:"email,unique=tenant_email,fold,trim"`
+	Handle string `dquely:"handle,unique,fold"`
+	Name   string `dquely:"name"`
+}
+
+const tenantUserQueryMock = `{
+  v as var(func: type(TenantUser))
+    @filter((eq(tenant, "acme") AND eq(email_norm, "alice@example.com")) OR eq(handle_norm, "ally"))
+
+  duplicates(func: uid(v)) {
+    uid
+    tenant
+    email_norm
+    handle_norm
+  }
+}`
+
+const tenantUserMutationMock = `_:tenantuser <tenant> "acme" .
+_:tenantuser <email> " Alice@Example.com" .
+_:tenantuser <email_norm> "alice@example.com" .
+_:tenantuser <handle> "Ally" .
+_:tenantuser <handle_norm> "ally" .
+_:tenantuser <name> "Alice" .
+_:tenantuser <dgraph.type> "TenantUser" .`
+
+const tenantUserUpdateQueryMock = `{
+  u as var(func: uid(0x1)) @filter(type(TenantUser))
+
+  v as var(func: type(TenantUser))
+    @filter(
+      (eq(tenant, "acme") AND eq(email_norm, "alice@example.com")) AND NOT uid(0x1)
+    )
+
+  duplicates(func: uid(v)) {
+    uid
+    tenant
+    email_norm
+  }
+}`
+
+const tenantUserUpdateSetMock = `<0x1> <tenant> "acme" .
+<0x1> <email> "Alice@Example.com" .
+<0x1> <email_norm> "alice@example.com" .
+<0x1> <name> "Alice" .`
+
+const tenantUserUpdateDelMock = `<0x1> <handle> * .
+<0x1> <handle_norm> * .`
+
+// Profile has nullable fields: pointers, a keepzero value and Optionals.
+type Profile struct {
+	Uid    string                  `dquely:"uid"`
+	Handle string                  `dquely:"handle,unique"`
+	Age    *int                    `dquely:"age"`
+	Active *bool                   `dquely:"active"`
+	Score  int                     `dquely:"score,keepzero"`
+	Rank   int                     `dquely:"rank"`
+	Bio    dquely.Optional[string] `dquely:"bio"`
+	Nick   dquely.Optional[string] `dquely:"nick"`
+}
+
+const profileMutationMock = `_:profile <handle> "ally" .
+_:profile <age> "0" .
+_:profile <active> "false" .
+_:profile <score> "0" .
+_:profile <bio> "" .
+_:profile <dgraph.type> "Profile" .`
+
+const profileUpdateSetMock = `<0x1> <handle> "ally" .
+<0x1> <active> "false" .
+<0x1> <score> "0" .
+<0x1> <bio> "" .`
+
+const profileUpdateDelMock = `<0x1> <age> * .
+<0x1> <rank> * .
+<0x1> <nick> * .`
+
+// Recipe has scalar list fields, written as one N-quad per element.
+type Recipe struct {
+	Uid     string    `dquely:"uid"`
+	Title   string    `dquely:"title,unique"`
+	Tags    []string  `dquely:"tags"`
+	Ratings []int     `dquely:"ratings"`
+	Weights []float64 `dquely:"weights"`
+	Notes   []string  `dquely:"notes,json"`
+}
+
+const recipeMutationMock = `_:recipe <title> "Pho" .
+_:recipe <tags> "soup" .
+_:recipe <tags> "vietnamese" .
+_:recipe <ratings> "4" .
+_:recipe <ratings> "5" .
+_:recipe <weights> "0.5" .
+_:recipe <notes> "[\"simmer\",\"serve\"]" .
+_:recipe <dgraph.type> "Recipe" .`
+
+const recipeUpdateSetMock = `<0x1> <title> "Pho" .
+<0x1> <tags> "soup" .
+<0x1> <tags> "noodles" .`
+
+const recipeUpdateDelMock = `<0x1> <tags> * .
+<0x1> <ratings> * .
+<0x1> <weights> * .
+<0x1> <notes> * .`
+
+// BaseModel holds the fields every model shares; embedding it promotes them.
+type BaseModel struct {
+	Uid       string    `dquely:"uid"`
+	CreatedAt time.Time `dquely:"createdAt"`
+}
+
+// Entity is implemented by the node types an Article can point to.
+type Entity interface {
+	EntityName() string
+}
+
+type Team struct {
+	BaseModel
+	Name string `dquely:"name"`
+}
+
+func (t *Team) EntityName() string { return t.Name }
+
+type Writer struct {
+	Uid    string `dquely:"uid"`
+	Handle string `dquely:"handle"`
+}
+
+func (w *Writer) EntityName() string { return w.Handle }
+
+func (w *Writer) DgraphType() string { return "Author" }
+
+// Article embeds BaseModel and has polymorphic edges.
+type Article struct {
+	BaseModel
+	Title   string   `dquely:"title"`
+	Owner   Entity   `dquely:"owner"`
+	Editors []Entity `dquely:"editors"`
+}
+
+const articleMutationMock = `_:article <createdAt> "2026-01-02T03:04:05" .
+_:article <title> "Launch" .
+_:article <owner> _:article.owner .
+_:article <editors> _:article.editors0 .
+_:article <editors> <0x7> .
+_:article <dgraph.type> "Article" .
+_:article.owner <name> "Core" .
+_:article.owner <dgraph.type> "Team" .
+_:article.editors0 <handle> "ann" .
+_:article.editors0 <dgraph.type> "Author" .`
+
+const articleUpdateSetMock = `uid(v) <owner> <0x7> .
+uid(v) <editors> _:article.editors0 .
+_:article.editors0 <handle> "ann" .
+_:article.editors0 <dgraph.type> "Author" .`
@@ -1,6 +1,7 @@
 package dquely_test
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -105,6 +106,12 @@ func TestUniqueFieldsPointer(t *testing.T) {
 	const expectedQuery = `{
   v as var(func: type(User))
     @filter(eq(userName, "bob") OR eq(email, "bob@example.com"))
+
+  duplicates(func: uid(v)) {
+    uid
+    userName
+    email
+  }
 }
 `
 	if query != expectedQuery {
@@ -444,10 +451,10 @@ func TestDeepMutation(t *testing.T) {
 		t.Fatalf("expected ParseMutation() to get Condition be empty, got %s", cond.Cond)
 	}
 	const expectedSet = `_:company <name> "A" .
-_:company <owner> _:owner .
+_:company <owner> _:company.owner .
 _:company <dgraph.type> "Company" .
-_:owner <name> "U" .
-_:owner <dgraph.type> "ShortUser" .`
+_:company.owner <name> "U" .
+_:company.owner <dgraph.type> "ShortUser" .`
 	if string(cond.SetNquads) != expectedSet {
 		t.Errorf("expected ParseMutation() to get Mutation %s, got %s", expectedSet, string(cond.SetNquads))
 	}
@@ -552,16 +559,16 @@ func TestDeepMultiMutation(t *testing.T) {
 		t.Fatalf("expected ParseMutation() to get Condition be empty, got %s", cond.Cond)
 	}
 	const expectedSet = `_:company <name> "A" .
-_:company <owner> _:owner .
-_:company <staffs> _:staffs0 .
-_:company <staffs> _:staffs1 .
+_:company <owner> _:company.owner .
+_:company <staffs> _:company.staffs0 .
+_:company <staffs> _:company.staffs1 .
 _:company <dgraph.type> "Company" .
-_:owner <name> "U" .
-_:owner <dgraph.type> "ShortUser" .
-_:staffs0 <name> "S1" .
-_:staffs0 <dgraph.type> "ShortUser" .
-_:staffs1 <name> "S2" .
-_:staffs1 <dgraph.type> "ShortUser" .`
+_:company.owner <name> "U" .
+_:company.owner <dgraph.type> "ShortUser" .
+_:company.staffs0 <name> "S1" .
+_:company.staffs0 <dgraph.type> "ShortUser" .
+_:company.staffs1 <name> "S2" .
+_:company.staffs1 <dgraph.type> "ShortUser" .`
 	if string(cond.SetNquads) != expectedSet {
 		t.Errorf("expected ParseMutation() to get Mutation %s, got %s", expectedSet, string(cond.SetNquads))
 	}
@@ -598,14 +605,14 @@ func TestMoreDeepMultiMutation(t *testing.T) {
 		t.Fatalf("expected ParseMutation() to get Condition be empty, got %s", cond.Cond)
 	}
 	const expectedSet = `_:company <name> "A" .
-_:company <owner> _:owner .
-_:company <staffs> _:staffs0 .
+_:company <owner> _:company.owner .
+_:company <staffs> _:company.staffs0 .
 _:company <dgraph.type> "Company" .
-_:owner <name> "U" .
-_:owner <dgraph.type> "ShortUser" .
-_:staffs0 <name> "S1" .
-_:staffs0 <link> <0x1> .
-_:staffs0 <dgraph.type> "ShortUser" .`
+_:company.owner <name> "U" .
+_:company.owner <dgraph.type> "ShortUser" .
+_:company.staffs0 <name> "S1" .
+_:company.staffs0 <link> <0x1> .
+_:company.staffs0 <dgraph.type> "ShortUser" .`
 	if string(cond.SetNquads) != expectedSet {
 		t.Errorf("expected ParseMutation() to get Mutation %s, got %s", expectedSet, string(cond.SetNquads))
 	}
@@ -614,9 +621,9 @@ _:staffs0 <dgraph.type> "ShortUser" .`
 	}
 	// test SetUIDs
 	err = dquely.SetUIDs(&company, map[string]string{
-		"company": "0x2",
-		"owner":   "0x3",
-		"staffs0": "0x4",
+		"company":         "0x2",
+		"company.owner":   "0x3",
+		"company.staffs0": "0x4",
 	})
 	if err != nil {
 		t.Fatalf("dquely.SetUIDs: expect error to be nil got %v", err)
@@ -686,3 +693,307 @@ _:product <dgraph.type> "Product" .`
 			string(cond.DelNquads))
 	}
 }
+
+func TestDeepSharedMutation(t *testing.T) {
+	link := &User{Name: "L"}
+	company := &Company{
+		Name:   "A",
+		Owner:  &ShortUser{Name: "U", Link: link},
+		Staffs: []ShortUser{{Name: "S1", Link: link}},
+	}
+	_, mus, err := dquely.ParseMutation(company, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != companySharedMutationMock {
+		t.Errorf("expected\n%s\ngot\n%s", companySharedMutationMock, got)
+	}
+	nodes, err := dquely.BlankNodeMap(company)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 4 || nodes["company.owner.link"] != any(link) {
+		t.Errorf("unexpected blank nodes %v", nodes)
+	}
+}
+
+func TestDeepCycleMutation(t *testing.T) {
+	alice := &Contact{Name: "Alice", Email: "alice@example.com"}
+	bob := &Contact{Name: "Bob", Friends: []*Contact{alice}}
+	alice.Friends = []*Contact{bob, bob}
+	query, mus, err := dquely.ParseMutation(alice, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != contactCycleQueryMock {
+		t.Errorf("expected\n%s\ngot\n%s", contactCycleQueryMock, query)
+	}
+	if got := string(mus[0].SetNquads); got != contactCycleMutationMock {
+		t.Errorf("expected\n%s\ngot\n%s", contactCycleMutationMock, got)
+	}
+	err = dquely.SetUIDs(alice, map[string]string{"contact": "0x1", "contact.friends0": "0x2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Uid != "0x1" || bob.Uid != "0x2" {
+		t.Errorf("unexpected uids %q and %q", alice.Uid, bob.Uid)
+	}
+}
+
+func TestDeepSelfReferenceMutation(t *testing.T) {
+	alice := &Contact{Name: "Alice"}
+	alice.Friends = []*Contact{alice}
+	_, _, err := dquely.ParseMutation(alice, true)
+	if err == nil || !strings.Contains(err.Error(), "Contact.Friends points to the struct itself") {
+		t.Errorf("expected a self-reference error, got %v", err)
+	}
+}
+
+func TestDeepNestedUniqueMutation(t *testing.T) {
+	dave := &Contact{Name: "Dave", Email: "dave@example.com"}
+	bob := &Contact{Name: "Bob", Email: "bob@example.com", Friends: []*Contact{dave}}
+	alice := &Contact{Name: "Alice", Email: "alice@example.com", Friends: []*Contact{bob, {Name: "Carol"}}}
+	query, mus, err := dquely.ParseMutation(alice, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != contactNestedUniqueQueryMock {
+		t.Errorf("expected\n%s\ngot\n%s", contactNestedUniqueQueryMock, query)
+	}
+	if len(mus) != len(contactNestedUniqueMutationMocks) {
+		t.Fatalf("expected %d mutations, got %d", len(contactNestedUniqueMutationMocks), len(mus))
+	}
+	for i, want := range contactNestedUniqueMutationMocks {
+		if mus[i].Cond != want.cond {
+			t.Errorf("mutation %d: expected condition %s, got %s", i, want.cond, mus[i].Cond)
+		}
+		if got := string(mus[i].SetNquads); got != want.set {
+			t.Errorf("mutation %d: expected\n%s\ngot\n%s", i, want.set, got)
+		}
+	}
+}
+
+func TestCompositeUniqueMutation(t *testing.T) {
+	user := &TenantUser{Tenant: "acme", Email: " Alice@Example.com", Handle: "Ally", Name: "Alice"}
+	query, mus, err := dquely.ParseMutation(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != tenantUserQueryMock {
+		t.Errorf("expected\n%s\ngot\n%s", tenantUserQueryMock, query)
+	}
+	if got := string(mus[0].SetNquads); got != tenantUserMutationMock {
+		t.Errorf("expected\n%s\ngot\n%s", tenantUserMutationMock, got)
+	}
+
+	// Without a tenant the composite key is incomplete and only the handle is checked.
+	query, _, err = dquely.ParseMutation(&TenantUser{Email: "alice@example.com", Handle: "Ally"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, `@filter(eq(handle_norm, "ally"))`) {
+		t.Errorf("expected only the handle key, got\n%s", query)
+	}
+}
+
+func TestCompositeUniqueUpdate(t *testing.T) {
+	user := &TenantUser{Uid: "0x1", Tenant: "acme", Email: "Alice@Example.com", Name: "Alice"}
+	query, mus, err := dquely.ParseMutation(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != tenantUserUpdateQueryMock {
+		t.Errorf("expected\n%s\ngot\n%s", tenantUserUpdateQueryMock, query)
+	}
+	if got := string(mus[0].SetNquads); got != tenantUserUpdateSetMock {
+		t.Errorf("expected\n%s\ngot\n%s", tenantUserUpdateSetMock, got)
+	}
+	if got := string(mus[0].DelNquads); got != tenantUserUpdateDelMock {
+		t.Errorf("expected\n%s\ngot\n%s", tenantUserUpdateDelMock, got)
+	}
+}
+
+func TestNullableMutation(t *testing.T) {
+	age, active := 0, false
+	profile := &Profile{Handle: "ally", Age: &age, Active: &active, Bio: dquely.Some("")}
+	_, mus, err := dquely.ParseMutation(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != profileMutationMock {
+		t.Errorf("expected\n%s\ngot\n%s", profileMutationMock, got)
+	}
+
+	text, err := dquely.Mutation(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{`_:profile <age> "0" .`, `_:profile <score> "0" .`, `_:profile <bio> "" .`} {
+		if !strings.Contains(text, line) {
+			t.Errorf("expected %s in\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, "<rank>") || strings.Contains(text, "<nick>") {
+		t.Errorf("expected rank and nick to be omitted, got\n%s", text)
+	}
+}
+
+func TestNullableUpdate(t *testing.T) {
+	active := false
+	// Age is nil and Rank zero, so they are deleted as before; Nick is null and
+	// deleted too. An unset Optional is left alone.
+	profile := &Profile{Uid: "0x1", Handle: "ally", Active: &active, Bio: dquely.Some(""), Nick: dquely.Null[string]()}
+	_, mus, err := dquely.ParseMutation(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != profileUpdateSetMock {
+		t.Errorf("expected\n%s\ngot\n%s", profileUpdateSetMock, got)
+	}
+	if got := string(mus[0].DelNquads); got != profileUpdateDelMock {
+		t.Errorf("expected\n%s\ngot\n%s", profileUpdateDelMock, got)
+	}
+
+	profile = &Profile{Uid: "0x1", Nick: dquely.Null[string]()}
+	_, mus, err = dquely.ParseUpdate(profile, dquely.FieldAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != `uid(v) <score> "0" .` {
+		t.Errorf("unexpected set %s", got)
+	}
+	if got := string(mus[0].DelNquads); got != `uid(v) <nick> * .` {
+		t.Errorf("unexpected delete %s", got)
+	}
+}
+
+func TestListMutation(t *testing.T) {
+	recipe := &Recipe{
+		Title:   "Pho",
+		Tags:    []string{"soup", "vietnamese"},
+		Ratings: []int{4, 5},
+		Weights: []float64{0.5},
+		Notes:   []string{"simmer", "serve"},
+	}
+	_, mus, err := dquely.ParseMutation(recipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != recipeMutationMock {
+		t.Errorf("expected\n%s\ngot\n%s", recipeMutationMock, got)
+	}
+
+	text, err := dquely.Mutation(recipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{`_:recipe <tags> "soup" .`, `_:recipe <tags> "vietnamese" .`, `_:recipe <ratings> "5" .`} {
+		if !strings.Contains(text, line) {
+			t.Errorf("expected %s in\n%s", line, text)
+		}
+	}
+}
+
+func TestListUpdate(t *testing.T) {
+	// A list that is set replaces the stored values; a nil list is deleted.
+	recipe := &Recipe{Uid: "0x1", Title: "Pho", Tags: []string{"soup", "noodles"}}
+	_, mus, err := dquely.ParseMutation(recipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != recipeUpdateSetMock {
+		t.Errorf("expected\n%s\ngot\n%s", recipeUpdateSetMock, got)
+	}
+	if got := string(mus[0].DelNquads); got != recipeUpdateDelMock {
+		t.Errorf("expected\n%s\ngot\n%s", recipeUpdateDelMock, got)
+	}
+
+	tests := []struct {
+		field    string
+		set, del string
+	}{
+		{"tags", `uid(v) <tags> "soup" .` + "\n" + `uid(v) <tags> "noodles" .`, `uid(v) <tags> * .`},
+		{"+tags", `uid(v) <tags> "soup" .` + "\n" + `uid(v) <tags> "noodles" .`, ""},
+		{"-tags", "", `uid(v) <tags> "soup" .` + "\n" + `uid(v) <tags> "noodles" .`},
+	}
+	for _, tt := range tests {
+		_, mus, err := dquely.ParseUpdate(recipe, tt.field)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.field, err)
+		}
+		if got := string(mus[0].SetNquads); got != tt.set {
+			t.Errorf("%s: expected set\n%s\ngot\n%s", tt.field, tt.set, got)
+		}
+		if got := string(mus[0].DelNquads); got != tt.del {
+			t.Errorf("%s: expected delete\n%s\ngot\n%s", tt.field, tt.del, got)
+		}
+	}
+
+	if _, _, err := dquely.ParseUpdate(recipe, "+title"); err == nil {
+		t.Error("expected an error appending to a scalar field")
+	}
+}
+
+func newArticle() *Article {
+	return &Article{
+		BaseModel: BaseModel{CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		Title:     "Launch",
+		Owner:     &Team{Name: "Core"},
+		Editors:   []Entity{&Writer{Handle: "ann"}, &Team{BaseModel: BaseModel{Uid: "0x7"}}},
+	}
+}
+
+func TestEmbeddedAndInterfaceMutation(t *testing.T) {
+	article := newArticle()
+	_, mus, err := dquely.ParseMutation(article, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != articleMutationMock {
+		t.Errorf("expected\n%s\ngot\n%s", articleMutationMock, got)
+	}
+
+	text, err := dquely.Mutation(article)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, `_:article <createdAt> "2026-01-02 03:04:05 +0000 UTC" .`) || !strings.Contains(text, `_:article <title> "Launch" .`) {
+		t.Errorf("expected the promoted fields, got\n%s", text)
+	}
+
+	uids := map[string]string{"article": "0x1", "article.owner": "0x2", "article.editors0": "0x3"}
+	if err := dquely.SetUIDs(article, uids); err != nil {
+		t.Fatal(err)
+	}
+	if article.Uid != "0x1" || article.Owner.(*Team).Uid != "0x2" || article.Editors[0].(*Writer).Uid != "0x3" {
+		t.Errorf("unexpected uids %+v", article)
+	}
+
+	_, _, err = dquely.ParseMutation(&Article{Owner: badEntity("x")}, true)
+	if err == nil || !strings.Contains(err.Error(), "Article.Owner") {
+		t.Errorf("expected an error for a non-struct entity, got %v", err)
+	}
+}
+
+// badEntity implements Entity without being a node.
+type badEntity string
+
+func (b badEntity) EntityName() string { return string(b) }
+
+func TestInterfaceUpdate(t *testing.T) {
+	article := &Article{
+		BaseModel: BaseModel{Uid: "0x1"},
+		Owner:     &Team{BaseModel: BaseModel{Uid: "0x7"}},
+		Editors:   []Entity{&Writer{Handle: "ann"}},
+	}
+	_, mus, err := dquely.ParseUpdate(article, "owner", "editors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(mus[0].SetNquads); got != articleUpdateSetMock {
+		t.Errorf("expected\n%s\ngot\n%s", articleUpdateSetMock, got)
+	}
+	if got, want := string(mus[0].DelNquads), "uid(v) <owner> * .\nuid(v) <editors> * ."; got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
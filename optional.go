@@ -0,0 +1,154 @@
+package dquely
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Optional is a field that is unset, set to a value, or explicitly null:
+//
+//	type Profile struct {
+//		Uid string                  `dquely:"uid"`
+//		Bio dquely.Optional[string] `dquely:"bio"`
+//	}
+//	p.Bio = dquely.Some("")        // written as "", unlike a plain empty string
+//	p.Bio = dquely.Null[string]() // deleted by updates
+//
+// The zero Optional is unset: inserts omit it and updates leave the predicate alone.
+// Optional values decode from query results and RDF files, where a missing predicate
+// stays unset.
+type Optional[T any] struct {
+	value T
+	set   bool
+	null  bool
+}
+
+// Some returns an Optional holding v, written even when v is a zero value.
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{value: v, set: true}
+}
+
+// Null returns an Optional that deletes its predicate on update.
+func Null[T any]() Optional[T] {
+	return Optional[T]{set: true, null: true}
+}
+
+// Get returns the value and whether o holds one.
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.set && !o.null
+}
+
+// IsSet reports whether o holds a value or is null.
+func (o Optional[T]) IsSet() bool {
+	return o.set
+}
+
+// IsNull reports whether o is null.
+func (o Optional[T]) IsNull() bool {
+	return o.null
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.set || o.null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*o = Null[T]()
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*o = Some(v)
+	return nil
+}
+
+// optional gives reflection access to an Optional of any T.
+type optional interface {
+	optional() (value any, set, null bool)
+}
+
+func (o Optional[T]) optional() (any, bool, bool) {
+	return o.value, o.set, o.null
+}
+
+// optionalTarget lets decoders fill an Optional of any T.
+type optionalTarget interface {
+	target() any
+}
+
+// target marks o as set and returns a pointer to its value.
+func (o *Optional[T]) target() any {
+	o.set, o.null = true, false
+	return &o.value
+}
+
+var optionalType = reflect.TypeOf((*optional)(nil)).Elem()
+
+// optionalElem returns T when t is an Optional[T].
+func optionalElem(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() != reflect.Struct || !t.Implements(optionalType) {
+		return nil, false
+	}
+	return t.Field(0).Type, true
+}
+
+// fieldState is what a mutation does with a scalar field.
+type fieldState int
+
+const (
+	fieldAbsent  fieldState = iota // omitted: a zero value, a nil pointer or an unset Optional
+	fieldPresent                   // written, even when it holds a zero value
+	fieldNull                      // a null Optional: deleted by updates, omitted otherwise
+)
+
+// fieldValue returns the state of the scalar field fv with the dquely tag rawTag and
+// the value to write. Pointers are written when non-nil, Optionals when set, and
+// other values when non-zero or tagged keepzero.
+func fieldValue(fv reflect.Value, rawTag string) (reflect.Value, fieldState) {
+	if _, ok := optionalElem(fv.Type()); ok && fv.CanInterface() {
+		value, set, null := fv.Interface().(optional).optional()
+		switch {
+		case null:
+			return reflect.Value{}, fieldNull
+		case set:
+			return reflect.ValueOf(value), fieldPresent
+		}
+		return reflect.Value{}, fieldAbsent
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return reflect.Value{}, fieldAbsent
+		}
+		return fv.Elem(), fieldPresent
+	}
+	if fv.IsZero() && !hasTagOption(rawTag, "keepzero") {
+		return reflect.Value{}, fieldAbsent
+	}
+	return fv, fieldPresent
+}
+
+// hasTagOption reports whether the dquely tag rawTag has the option opt.
+func hasTagOption(rawTag, opt string) bool {
+	_, opts, _ := strings.Cut(rawTag, ",")
+	return slices.Contains(strings.Split(opts, ","), opt)
+}
+
+// scalarOf returns the type a field of type t holds: the element of a pointer or
+// an Optional, or t itself.
+func scalarOf(t reflect.Type) reflect.Type {
+	if elem, ok := optionalElem(t); ok {
+		return elem
+	}
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,64 @@
+package dquely_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vibros68/dquely"
+)
+
+func TestOptionalJSON(t *testing.T) {
+	var out struct {
+		Bio  dquely.Optional[string] `json:"bio"`
+		Nick dquely.Optional[string] `json:"nick"`
+		Age  dquely.Optional[int]    `json:"age"`
+	}
+	if err := json.Unmarshal([]byte(`{"bio":"","nick":null}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if bio, ok := out.Bio.Get(); !ok || bio != "" {
+		t.Errorf("expected an empty bio, got %q %v", bio, ok)
+	}
+	if !out.Nick.IsNull() || !out.Nick.IsSet() {
+		t.Error("expected a null nick")
+	}
+	if out.Age.IsSet() {
+		t.Error("expected age to be unset")
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"bio":"","nick":null,"age":null}`; string(b) != want {
+		t.Errorf("expected %s, got %s", want, b)
+	}
+}
+
+func TestOptionalRDF(t *testing.T) {
+	var profile Profile
+	rdf := "<0x1> <handle> \"ally\" .\n<0x1> <age> \"0\" .\n<0x1> <bio> \"\" .\n"
+	if err := dquely.UnmarshalRDF([]byte(rdf), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Age == nil || *profile.Age != 0 {
+		t.Errorf("expected age 0, got %v", profile.Age)
+	}
+	if bio, ok := profile.Bio.Get(); !ok || bio != "" {
+		t.Errorf("expected an empty bio, got %q %v", bio, ok)
+	}
+	if profile.Nick.IsSet() {
+		t.Error("expected nick to be unset")
+	}
+}
+
+func TestSchemaOfOptional(t *testing.T) {
+	s, err := dquely.SchemaOf(&Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, typ := range map[string]string{"age": "int", "active": "bool", "bio": "string", "nick": "string"} {
+		if p := s.Predicates[name]; p == nil || p.Type != typ || p.List {
+			t.Errorf("%s: expected %s, got %+v", name, typ, p)
+		}
+	}
+}
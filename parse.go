@@ -0,0 +1,317 @@
+package dquely
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+// Document is a DQL query parsed by ParseDQL. Its blocks are ordinary DQuely
+// values, so they can be rewritten with the builder methods and rendered again.
+type Document struct {
+	Name   string     // operation name of "query name { ... }", empty for a bare "{ ... }"
+	Vars   []QueryVar // variables declared as "query name($a: string = "x")"
+	Blocks []*DQuely
+}
+
+// QueryVar is a query variable declaration such as "$name: string = "Alice"".
+type QueryVar struct {
+	Name    string // without the leading "$"
+	Type    string // e.g. "string", "int!"
+	Default string // rendered literal, empty when there is no default
+}
+
+// ParseDQL parses a DQL query into the structures DQuely renders:
+//
+//	doc, err := dquely.ParseDQL(text)
+//	doc.Blocks[0] = doc.Blocks[0].Filter(dquely.Eq("tenant", "acme")).First(100)
+//	query := doc.String()
+//
+// Text produced by Build parses back to the same text; hand-written queries are
+// normalised to Build's layout.
+func ParseDQL(src string) (*Document, error) {
+	ast, err := dql.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("dquely: %w", err)
+	}
+	doc := &Document{Name: ast.Name}
+	for _, v := range ast.Vars {
+		qv := QueryVar{Name: v.Name, Type: v.Type}
+		if v.Default != nil {
+			qv.Default = renderArg(*v.Default)
+		}
+		doc.Vars = append(doc.Vars, qv)
+	}
+	for _, b := range ast.Blocks {
+		block, err := blockFromAST(b)
+		if err != nil {
+			return nil, err
+		}
+		doc.Blocks = append(doc.Blocks, block)
+	}
+	return doc, nil
+}
+
+// Block returns the first block with the given name, or nil. Variable blocks are
+// named "var".
+func (doc *Document) Block(name string) *DQuely {
+	for _, b := range doc.Blocks {
+		if b.DgraphKey() == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// String renders the document with Build, preceded by the "query" header when the
+// document has a name or variables.
+func (doc *Document) String() string {
+	body := Build(doc.Blocks...)
+	if doc.Name == "" && len(doc.Vars) == 0 {
+		return body
+	}
+	header := "query " + doc.Name
+	if len(doc.Vars) > 0 {
+		vars := make([]string, len(doc.Vars))
+		for i, v := range doc.Vars {
+			vars[i] = "$" + v.Name + ": " + v.Type
+			if v.Default != "" {
+				vars[i] += " = " + v.Default
+			}
+		}
+		header += "(" + strings.Join(vars, ", ") + ")"
+	}
+	return header + " " + body
+}
+
+func blockFromAST(b *dql.Block) (*DQuely, error) {
+	d := &DQuely{dgKey: b.Name, name: b.Name}
+	switch {
+	case !b.HasBody && b.Var != "":
+		d.condVar = b.Var
+	case b.Name == "var":
+		d.isVar = true
+		d.blockVarName = b.Var
+	default:
+		d.blockVarName = b.Var
+	}
+	if b.Func != nil {
+		d.filters = append(d.filters, filter{isFuncPart: true, expr: renderFunc(b.Func)})
+	}
+	if err := d.applyArgs(b.Args); err != nil {
+		return nil, err
+	}
+	d.applyDirectives(b.Directives)
+	d.filters = append(d.filters, rootFilters(b.Filter)...)
+	selects, err := selectsFromAST(b.Fields)
+	if err != nil {
+		return nil, err
+	}
+	d.selects = selects
+	return d, nil
+}
+
+func selectsFromAST(fields []*dql.Field) ([]any, error) {
+	var out []any
+	for _, f := range fields {
+		name := f.Name
+		if f.Func != nil {
+			name = renderFunc(f.Func)
+		}
+		if f.Alias != "" {
+			name = f.Alias + ": " + name
+		}
+		if !f.HasBody && f.Filter == nil && len(f.Args) == 0 && len(f.Directives) == 0 {
+			if f.Var != "" {
+				name = f.Var + " as " + name
+			}
+			out = append(out, name)
+			continue
+		}
+		nested := &DQuely{name: name, varName: f.Var}
+		if err := nested.applyArgs(f.Args); err != nil {
+			return nil, err
+		}
+		nested.applyDirectives(f.Directives)
+		nested.filters = nestedFilters(f.Filter)
+		selects, err := selectsFromAST(f.Fields)
+		if err != nil {
+			return nil, err
+		}
+		nested.selects = selects
+		if f.Func != nil && f.Func.Name == "expand" {
+			nested.inline = true
+			for _, s := range selects {
+				if _, ok := s.(string); !ok {
+					nested.inline = false
+				}
+			}
+		}
+		out = append(out, nested)
+	}
+	return out, nil
+}
+
+// applyArgs maps block or field arguments onto First, Offset and the ordering args.
+func (d *DQuely) applyArgs(args []dql.Arg) error {
+	for _, a := range args {
+		if a.Name == "first" || a.Name == "offset" {
+			if n, err := strconv.Atoi(a.Value.Text); err == nil && a.Value.Kind == dql.Number {
+				if a.Name == "first" {
+					d.firstN = &n
+				} else {
+					d.offsetN = &n
+				}
+				continue
+			}
+		}
+		if a.Value.Kind == dql.List {
+			return fmt.Errorf("dquely: invalid value for argument %s", a.Name)
+		}
+		d.queryArgs = append(d.queryArgs, a.Name+": "+renderArg(a.Value))
+	}
+	return nil
+}
+
+func (d *DQuely) applyDirectives(dirs []dql.Directive) {
+	for _, dir := range dirs {
+		switch {
+		case dir.Name == "cascade" && len(dir.Args) == 0:
+			d.cascade = true
+		case dir.Name == "groupby" && len(dir.Args) == 1 && dir.Args[0].Name == "":
+			d.groupBy = renderArg(dir.Args[0].Value)
+		default:
+			args := make([]string, len(dir.Args))
+			for i, a := range dir.Args {
+				args[i] = renderArg(a.Value)
+				if a.Name != "" {
+					args[i] = a.Name + ": " + args[i]
+				}
+			}
+			d.directives = append(d.directives, renderDirective(dir.Name, args))
+		}
+	}
+}
+
+// rootFilters splits a block's @filter into the AND-ed items renderBlock writes,
+// turning a top-level OR of simple expressions into an Or group.
+func rootFilters(f *dql.Filter) []filter {
+	if f == nil {
+		return nil
+	}
+	parts := []*dql.Filter{f}
+	if f.Op == dql.FilterAnd {
+		parts = f.Args
+	}
+	var out []filter
+	for _, p := range parts {
+		if p.Op == dql.FilterOr && simpleTerms(p.Args) {
+			ors := make([]string, len(p.Args))
+			for i, a := range p.Args {
+				ors[i] = renderFilter(a, false)
+			}
+			out = append(out, filter{orExprs: ors})
+			continue
+		}
+		out = append(out, filter{expr: renderFilter(p, true)})
+	}
+	return out
+}
+
+// nestedFilters splits a nested select's @filter into expressions that
+// inlineFilter joins with AND.
+func nestedFilters(f *dql.Filter) []filter {
+	if f == nil {
+		return nil
+	}
+	if f.Op != dql.FilterAnd {
+		return []filter{{expr: renderFilter(f, false)}}
+	}
+	out := make([]filter, len(f.Args))
+	for i, p := range f.Args {
+		out[i] = filter{expr: renderFilter(p, true)}
+	}
+	return out
+}
+
+// simpleTerms reports whether every filter is a function or a negated function.
+func simpleTerms(fs []*dql.Filter) bool {
+	for _, f := range fs {
+		if f.Op == dql.FilterNot {
+			f = f.Args[0]
+		}
+		if f.Op != dql.FilterFunc {
+			return false
+		}
+	}
+	return true
+}
+
+// renderFilter renders f in the builder's syntax; groups are parenthesised when
+// nested is set.
+func renderFilter(f *dql.Filter, nested bool) string {
+	switch f.Op {
+	case dql.FilterFunc:
+		return renderFunc(f.Func)
+	case dql.FilterNot:
+		return "NOT " + renderFilter(f.Args[0], true)
+	}
+	op := " AND "
+	if f.Op == dql.FilterOr {
+		op = " OR "
+	}
+	parts := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		parts[i] = renderFilter(a, true)
+	}
+	s := strings.Join(parts, op)
+	if nested {
+		s = "(" + s + ")"
+	}
+	return s
+}
+
+// renderFunc renders a function call the way the builder's constructors do.
+func renderFunc(fn *dql.Func) string {
+	if fn.Name == "uid_in" && len(fn.Args) == 2 {
+		switch v := fn.Args[1]; v.Kind {
+		case dql.List:
+			return UidIn(renderArg(fn.Args[0]), listArgs(v)...).expr
+		case dql.FuncCall:
+			return UidIn(renderArg(fn.Args[0]), FilterExpr{expr: renderFunc(v.Func)}).expr
+		}
+	}
+	args := make([]string, len(fn.Args))
+	for i, a := range fn.Args {
+		args[i] = renderArg(a)
+	}
+	s := strings.Join(args, ", ")
+	if fn.Filter != nil {
+		s += " @filter(" + renderFilter(fn.Filter, false) + ")"
+	}
+	return fn.Name + "(" + s + ")"
+}
+
+func listArgs(v dql.Value) []any {
+	out := make([]any, len(v.List))
+	for i, item := range v.List {
+		out[i] = renderArg(item)
+	}
+	return out
+}
+
+func renderArg(v dql.Value) string {
+	switch v.Kind {
+	case dql.FuncCall:
+		return renderFunc(v.Func)
+	case dql.List:
+		items := make([]string, len(v.List))
+		for i, item := range v.List {
+			items[i] = renderArg(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return v.String()
+}
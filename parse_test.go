@@ -0,0 +1,121 @@
+package dquely_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vibros68/dquely"
+)
+
+func TestParseDQLRoundTrip(t *testing.T) {
+	mocks := map[string]string{
+		"simple": simpleMock, "filter": filterMock, "and": complexMockAnd, "or": complexMockOr,
+		"fulltextAndDate": complexFullTextAndDate, "not": ComplexMockNot, "advanced": AdvancedMock,
+		"regexp": regexpMock, "alloftext": alloftextMock, "anyoftext": anyoftextMock,
+		"multiQuery": multiQueryMock, "allofterms": alloftermsMock, "alloftermsField": alloftermsFieldMock,
+		"anyofterms": anyoftermsMock, "anyoftermsField": anyoftermsFieldMock, "between": betweenMock,
+		"simpleUid": simpleUidMock, "variableUid": variableUidMock, "uid_in": uid_inMock,
+		"uid_inMulti": uid_inMultiMock, "uid_inWithVar": uid_inWithVarMock,
+		"gtValKey": gtValKeyMock, "geValKey": geValKeyMock, "leValKey": leValKeyMock, "ltValKey": ltValKeyMock,
+		"gtValValue": gtValValueMock, "geValValue": geValValueMock, "leValValue": leValValueMock,
+		"ltValValue": ltValValueMock, "gtCount": gtCountMock, "geCount": geCountMock,
+		"leCount": leCountMock, "ltCount": ltCountMock, "limit": queryLimitItems,
+		"complexLimit": queryComplexLimitItems, "offset": queryWithOffsetMock, "count": countMock,
+		"countField": countFieldMock, "countAssigned": countAssignedToValueVariableMock,
+		"orderAsc": orderAscMock, "orderComplex": orderComplexMock, "expandAll": expandAllMock,
+		"cascade": cascadeDirectiveMock,
+	}
+	for name, mock := range mocks {
+		doc, err := dquely.ParseDQL(mock)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		// Aliases are rendered as "n: name", like arguments.
+		if want := strings.ReplaceAll(mock, " : ", ": "); doc.String() != want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, want, doc.String())
+		}
+	}
+}
+
+func TestParseDQLMath(t *testing.T) {
+	const mock = `{
+  var(func: type(Film)) {
+    a as count(starring)
+    b as count(genre)
+    score as math(a + b * 2)
+    ratio as math(a / (b + 1))
+  }
+
+  films(func: uid(score), orderdesc: val(score)) {
+    name
+    total: math(a+b)
+    s: val(score)
+  }
+}`
+	doc, err := dquely.ParseDQL(mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.String(); got != mock {
+		t.Errorf("expected\n%s\ngot\n%s", mock, got)
+	}
+	if _, err := dquely.ParseDQL("{ q(func: has(a)) { x as math(a + (b) } }"); err == nil {
+		t.Error("expected an error for an unterminated math()")
+	}
+}
+
+func TestParseDQLNormalises(t *testing.T) {
+	// Comments are dropped and spacing follows Build, but the query is unchanged.
+	for _, mock := range []string{complexVariableAndUidMock, groupByWithCommentMock} {
+		doc, err := dquely.ParseDQL(mock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := dquely.ParseDQL(doc.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.String() != doc.String() {
+			t.Errorf("expected a stable rendering, got\n%s\nthen\n%s", doc, again)
+		}
+	}
+}
+
+func TestParseDQLRewrite(t *testing.T) {
+	doc, err := dquely.ParseDQL(`query people($name: string = "Alice") {
+  p as var(func: eq(name, $name))
+  people(func: uid(p), first: 1000) @normalize {
+    name
+    friends @filter(has(email) OR has(phone)) { n: name }
+  }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	people := doc.Block("people")
+	if people == nil {
+		t.Fatal("expected a people block")
+	}
+	doc.Blocks[1] = people.Filter(dquely.Eq("tenant", "acme")).First(10)
+	want := `query people($name: string = "Alice") {
+  p as var(func: eq(name, $name))
+
+  people(func: uid(p), first: 10) @normalize @filter(eq(tenant, "acme")) {
+    name
+    friends @filter(has(email) OR has(phone)) {
+      n: name
+    }
+  }
+}`
+	if got := doc.String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestParseDQLError(t *testing.T) {
+	_, err := dquely.ParseDQL("{\n  people(func: has(name) {\n  }\n}")
+	if err == nil || !strings.HasPrefix(err.Error(), "dquely: dql: line 2") {
+		t.Errorf("expected a positioned parse error, got %v", err)
+	}
+}
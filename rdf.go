@@ -0,0 +1,159 @@
+package dquely
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RDFOptions tunes an RDFWriter.
+type RDFOptions struct {
+	Deep   bool       // write nested structs, as Mutate(ctx, data, true)
+	Unique UniqueMode // the unique enforcement the schema is written for
+}
+
+// RDFWriter serializes dquely-tagged structs as gzipped N-Quads for the Dgraph bulk
+// and live loaders, and the schema of the written types next to them:
+//
+//	w, err := dquely.CreateRDFFiles("out/users", dquely.RDFOptions{Deep: true})
+//	for _, u := range users {
+//		if err := w.Write(u); err != nil {
+//			return err
+//		}
+//	}
+//	err = w.Close() // out/users.rdf.gz and out/users.schema
+//	// dgraph bulk -f out/users.rdf.gz -s out/users.schema
+//
+// The N-Quads are those Mutate sends, without the uniqueness query and condition.
+// Blank nodes are numbered by write order, so the same stream always produces the
+// same file: the 13th item's "_:user" is written as "_:r12.user". An item whose
+// unique values repeat an earlier item is rejected by Write with "duplicated".
+type RDFWriter struct {
+	gz     *gzip.Writer
+	schema io.Writer
+	closer []io.Closer
+	opts   RDFOptions
+	n      int
+	seen   map[string]bool
+	models []any
+	types  map[reflect.Type]bool
+	closed bool
+}
+
+// NewRDFWriter writes gzipped N-Quads to rdf and, on Close, the schema of the written
+// types to schema, which may be nil. The caller closes rdf and schema after Close.
+func NewRDFWriter(rdf, schema io.Writer, opts ...RDFOptions) *RDFWriter {
+	w := &RDFWriter{
+		gz:     gzip.NewWriter(rdf),
+		schema: schema,
+		seen:   map[string]bool{},
+		types:  map[reflect.Type]bool{},
+	}
+	if len(opts) > 0 {
+		w.opts = opts[0]
+	}
+	return w
+}
+
+// CreateRDFFiles creates name.rdf.gz and name.schema and returns a writer for them.
+// Close closes both files.
+func CreateRDFFiles(name string, opts ...RDFOptions) (*RDFWriter, error) {
+	rdf, err := os.Create(name + ".rdf.gz")
+	if err != nil {
+		return nil, fmt.Errorf("dgo: %w", err)
+	}
+	schema, err := os.Create(name + ".schema")
+	if err != nil {
+		rdf.Close()
+		return nil, fmt.Errorf("dgo: %w", err)
+	}
+	w := NewRDFWriter(rdf, schema, opts...)
+	w.closer = []io.Closer{rdf, schema}
+	return w, nil
+}
+
+// Write serializes one pointer to a struct.
+func (w *RDFWriter) Write(item any) error {
+	if w.closed {
+		return errors.New("dgo: RDFWriter is closed")
+	}
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("dgo: RDFWriter expects a pointer to struct, got %T", item)
+	}
+	v, t := v.Elem(), v.Elem().Type()
+	if structUID(v, t) == "" {
+		if key, dup := batchDuplicate(item, w.seen); dup {
+			return fmt.Errorf("dgo: %w: %s repeats an earlier item", errDuplicated, key)
+		}
+	}
+	typeName := dgraphTypeOf(item)
+	root := "_:r" + strconv.Itoa(w.n) + "." + strings.ToLower(typeName)
+	nodes := newNquadNodes()
+	nodes.add(v, root, "")
+	if uid := structUID(v, t); uid != "" {
+		nodes.iris[root] = "<" + uid + ">"
+	}
+	var sb strings.Builder
+	if err := nodes.build(&sb, v, t, root, typeName, w.opts.Deep); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w.gz, sb.String()+"\n"); err != nil {
+		return fmt.Errorf("dgo: write rdf: %w", err)
+	}
+	w.n++
+	if w.opts.Deep {
+		// Nested nodes, including those behind interface edges, need type
+		// definitions too.
+		eachNode(v, w.addType)
+	} else {
+		w.addType(v)
+	}
+	return nil
+}
+
+// addType records the type of the node v for the schema.
+func (w *RDFWriter) addType(v reflect.Value) {
+	if w.types[v.Type()] {
+		return
+	}
+	w.types[v.Type()] = true
+	if v.CanAddr() {
+		v = v.Addr()
+	}
+	w.models = append(w.models, v.Interface())
+}
+
+// Count returns the number of items written.
+func (w *RDFWriter) Count() int {
+	return w.n
+}
+
+// Close flushes the N-Quads, writes the schema and closes the files created by
+// CreateRDFFiles.
+func (w *RDFWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	errs := []error{w.gz.Close()}
+	if w.schema != nil {
+		s, err := schemaOf(w.opts.Unique, w.models...)
+		if err == nil {
+			_, err = io.WriteString(w.schema, s.String())
+		}
+		errs = append(errs, err)
+	}
+	for _, c := range w.closer {
+		errs = append(errs, c.Close())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("dgo: close rdf: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package dquely
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+// RDFDecoder populates dquely-tagged structs from RDF N-Quads: the files written by
+// RDFWriter, Dgraph exports or RDF query responses. Each subject's dgraph.type
+// selects a registered Go type, and edges are followed through the field types:
+//
+//	dec := dquely.NewRDFDecoder(&User{}, &Company{})
+//	nodes, err := dec.Decode(file) // []any of *User and *Company
+//
+// Literals are converted to the field's kind, fields tagged json are unmarshalled
+// and uid fields receive the subject's uid (blank nodes leave them empty). A node
+// reached through several pointer edges is decoded once and shared.
+type RDFDecoder struct {
+	types map[string]reflect.Type // dgraph.type -> struct type
+}
+
+// NewRDFDecoder returns a decoder for the given models, keyed by the dgraph.type
+// Mutation writes for them.
+func NewRDFDecoder(models ...any) *RDFDecoder {
+	dec := &RDFDecoder{types: map[string]reflect.Type{}}
+	for _, m := range models {
+		dec.Register(m)
+	}
+	return dec
+}
+
+// Register adds a model; a later model with the same dgraph.type replaces it.
+func (dec *RDFDecoder) Register(model any) {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return
+	}
+	dec.types[dgraphTypeOf(reflect.New(t).Interface())] = t
+}
+
+// Decode reads N-Quads, gzipped or not, and returns a pointer for every subject
+// whose dgraph.type is registered, in the order the subjects first appear.
+func (dec *RDFDecoder) Decode(r io.Reader) ([]any, error) {
+	g, err := readRDF(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, n := range g.order {
+		for _, typ := range n.types {
+			if t, ok := dec.types[typ]; ok {
+				v, err := g.pointer(n, t)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v.Interface())
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// UnmarshalRDF decodes the nodes of one type from N-Quads into out, which is a
+// *[]*T, *[]T or *T. Nodes are selected by T's dgraph.type; when no subject has a
+// dgraph.type, as in query responses without it, every subject that is not the
+// object of an edge is decoded instead.
+func UnmarshalRDF(data []byte, out any) error {
+	ov := reflect.ValueOf(out)
+	if ov.Kind() != reflect.Ptr || ov.IsNil() {
+		return fmt.Errorf("dquely: UnmarshalRDF expects a pointer, got %T", out)
+	}
+	target := ov.Elem()
+	t, isSlice, isPtr := target.Type(), false, false
+	if t.Kind() == reflect.Slice {
+		isSlice = true
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		isPtr = true
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || (!isSlice && isPtr) {
+		return fmt.Errorf("dquely: UnmarshalRDF expects a *[]*T, *[]T or *T of a struct, got %T", out)
+	}
+	g, err := readRDF(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	typeName := dgraphTypeOf(reflect.New(t).Interface())
+	var nodes []*rdfNode
+	for _, n := range g.order {
+		if len(g.typed) == 0 && !g.referenced[n] || containsString(n.types, typeName) {
+			nodes = append(nodes, n)
+		}
+	}
+	if !isSlice {
+		if len(nodes) == 0 {
+			return fmt.Errorf("dquely: rdf: no %s node", typeName)
+		}
+		v, err := g.pointer(nodes[0], t)
+		if err != nil {
+			return err
+		}
+		target.Set(v.Elem())
+		return nil
+	}
+	list := reflect.MakeSlice(target.Type(), 0, len(nodes))
+	for _, n := range nodes {
+		v, err := g.pointer(n, t)
+		if err != nil {
+			return err
+		}
+		if !isPtr {
+			v = v.Elem()
+		}
+		list = reflect.Append(list, v)
+	}
+	target.Set(list)
+	return nil
+}
+
+// rdfNode is one subject and its statements.
+type rdfNode struct {
+	key    string // "0x1" or "_:name"
+	blank  bool
+	types  []string
+	values map[string][]dql.Term // predicate, with "@lang" for tagged literals -> objects
+}
+
+// rdfGraph is parsed N-Quads grouped by subject.
+type rdfGraph struct {
+	nodes      map[string]*rdfNode
+	order      []*rdfNode
+	referenced map[*rdfNode]bool
+	typed      map[*rdfNode]bool
+	decoded    map[rdfKey]reflect.Value // pointers already built
+	active     map[rdfKey]bool          // value structs being filled, to stop cycles
+}
+
+type rdfKey struct {
+	node *rdfNode
+	t    reflect.Type
+}
+
+// readRDF parses N-Quads from r, which may be gzipped.
+func readRDF(r io.Reader) (*rdfGraph, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("dquely: rdf: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("dquely: rdf: %w", err)
+	}
+	quads, err := dql.ParseNQuads(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("dquely: rdf: %w", err)
+	}
+	g := &rdfGraph{
+		nodes:      map[string]*rdfNode{},
+		referenced: map[*rdfNode]bool{},
+		typed:      map[*rdfNode]bool{},
+		decoded:    map[rdfKey]reflect.Value{},
+		active:     map[rdfKey]bool{},
+	}
+	for _, q := range quads {
+		subj := g.node(q.Subject)
+		if subj == nil || q.Predicate == "*" {
+			return nil, fmt.Errorf("dquely: rdf: only <uid> and _:blank subjects with a predicate are supported")
+		}
+		switch q.Object.Kind {
+		case dql.TermLiteral:
+			if q.Predicate == "dgraph.type" {
+				subj.types = append(subj.types, q.Object.Value)
+				g.typed[subj] = true
+				continue
+			}
+			pred := q.Predicate
+			if q.Object.Lang != "" {
+				pred += "@" + q.Object.Lang
+			}
+			subj.values[pred] = append(subj.values[pred], q.Object)
+		case dql.TermUID, dql.TermBlank:
+			g.referenced[g.node(q.Object)] = true
+			subj.values[q.Predicate] = append(subj.values[q.Predicate], q.Object)
+		default:
+			return nil, fmt.Errorf("dquely: rdf: unsupported object for %s", q.Predicate)
+		}
+	}
+	return g, nil
+}
+
+// node returns the node of a uid or blank-node term, creating it on first use.
+func (g *rdfGraph) node(t dql.Term) *rdfNode {
+	var key string
+	switch t.Kind {
+	case dql.TermUID:
+		key = t.Value
+	case dql.TermBlank:
+		key = "_:" + t.Value
+	default:
+		return nil
+	}
+	n := g.nodes[key]
+	if n == nil {
+		n = &rdfNode{key: key, blank: t.Kind == dql.TermBlank, values: map[string][]dql.Term{}}
+		g.nodes[key] = n
+		g.order = append(g.order, n)
+	}
+	return n
+}
+
+// pointer returns the *t decoded from n, building it once.
+func (g *rdfGraph) pointer(n *rdfNode, t reflect.Type) (reflect.Value, error) {
+	k := rdfKey{n, t}
+	if v, ok := g.decoded[k]; ok {
+		return v, nil
+	}
+	v := reflect.New(t)
+	g.decoded[k] = v
+	return v, g.fill(v.Elem(), n)
+}
+
+// fill sets the fields of the struct v from the statements of n.
+func (g *rdfGraph) fill(v reflect.Value, n *rdfNode) error {
+	t := v.Type()
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
+		// The concrete type of an interface edge is not known here.
+		if rawTag == "-" || !field.IsExported() || isInterfaceEdge(field.Type) {
+			continue
+		}
+		predicate, isJSON, _ := parseTag(rawTag, field.Name)
+		if predicate != "uid" && predicate != "dgraph.type" && len(n.values[predicate]) == 0 {
+			continue
+		}
+		fv := settableField(v, field.Index)
+		if !fv.IsValid() {
+			continue
+		}
+		switch predicate {
+		case "uid":
+			if !n.blank && fv.Kind() == reflect.String {
+				fv.SetString(n.key)
+			}
+			continue
+		case "dgraph.type":
+			if len(n.types) > 0 {
+				if fv.Kind() == reflect.String {
+					fv.SetString(n.types[0])
+				} else if fv.Type() == reflect.TypeOf([]string(nil)) {
+					fv.Set(reflect.ValueOf(append([]string(nil), n.types...)))
+				}
+			}
+			continue
+		}
+		if err := g.set(fv, n.values[predicate], isJSON); err != nil {
+			return fmt.Errorf("dquely: rdf: %s.%s: %w", t.Name(), field.Name, err)
+		}
+	}
+	return nil
+}
+
+// set stores the objects of one predicate in the field fv.
+func (g *rdfGraph) set(fv reflect.Value, objs []dql.Term, isJSON bool) error {
+	ft := fv.Type()
+	if isJSON {
+		return json.Unmarshal([]byte(objs[0].Value), fv.Addr().Interface())
+	}
+	if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+		list := reflect.MakeSlice(ft, 0, len(objs))
+		for _, obj := range objs {
+			item := reflect.New(ft.Elem()).Elem()
+			ok, err := g.setOne(item, obj)
+			if err != nil {
+				return err
+			}
+			if ok {
+				list = reflect.Append(list, item)
+			}
+		}
+		fv.Set(list)
+		return nil
+	}
+	_, err := g.setOne(fv, objs[0])
+	return err
+}
+
+// setOne stores a single object in fv: an edge for struct kinds, a literal
+// otherwise. It reports false when the object does not fit, e.g. a cycle through
+// value structs.
+func (g *rdfGraph) setOne(fv reflect.Value, obj dql.Term) (bool, error) {
+	ft := fv.Type()
+	if _, ok := optionalElem(ft); ok && fv.CanAddr() {
+		target := fv.Addr().Interface().(optionalTarget).target()
+		return g.setOne(reflect.ValueOf(target).Elem(), obj)
+	}
+	st := ft
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct || st == timeType {
+		if obj.Kind != dql.TermLiteral {
+			return false, fmt.Errorf("expected a literal, got an edge")
+		}
+		return true, setLiteral(fv, obj.Value)
+	}
+	if obj.Kind == dql.TermLiteral {
+		return false, fmt.Errorf("expected an edge, got %q", obj.Value)
+	}
+	child := g.node(obj)
+	if ft.Kind() == reflect.Ptr {
+		p, err := g.pointer(child, st)
+		if err != nil {
+			return false, err
+		}
+		fv.Set(p)
+		return true, nil
+	}
+	k := rdfKey{child, st}
+	if g.active[k] {
+		return false, nil
+	}
+	g.active[k] = true
+	defer delete(g.active, k)
+	return true, g.fill(fv, child)
+}
+
+// rdfTimeLayouts are the datetime forms Dgraph, Mutate and RDFWriter write, and the
+// time.Time String form Mutation writes.
+var rdfTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+}
+
+// setLiteral converts a literal to the kind of fv.
+func setLiteral(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		p := reflect.New(fv.Type().Elem())
+		if err := setLiteral(p.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	if fv.Type() == timeType {
+		for _, layout := range rdfTimeLayouts {
+			if tv, err := time.Parse(layout, s); err == nil {
+				fv.Set(reflect.ValueOf(tv))
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid datetime %q", s)
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("cannot decode %q into %s", s, fv.Type())
+	}
+	return nil
+}
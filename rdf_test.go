@@ -0,0 +1,277 @@
+package dquely_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vibros68/dquely"
+)
+
+func gunzip(t *testing.T, r io.Reader) string {
+	t.Helper()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRDFWriter(t *testing.T) {
+	var rdf, schema bytes.Buffer
+	w := dquely.NewRDFWriter(&rdf, &schema, dquely.RDFOptions{Deep: true})
+	items := []any{
+		&Company{Name: "Acme", Owner: &ShortUser{Name: "Bob"}, Staffs: []ShortUser{{Name: "C"}, {Uid: "0x9"}}},
+		&Company{Name: "Initech", Owner: &ShortUser{Name: "Bill"}},
+		&UserWithUnique{UserName: "alice", Email: "alice@example.com"},
+	}
+	for _, item := range items {
+		if err := w.Write(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.Write(&UserWithUnique{UserName: "alice2", Email: "alice@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "duplicated") {
+		t.Errorf("expected a duplicate error, got %v", err)
+	}
+	if w.Count() != 3 {
+		t.Errorf("expected 3 items, got %d", w.Count())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, &rdf); got != rdfWriterMock {
+		t.Errorf("expected\n%s\ngot\n%s", rdfWriterMock, got)
+	}
+	if got := schema.String(); got != rdfWriterSchemaMock {
+		t.Errorf("expected\n%s\ngot\n%s", rdfWriterSchemaMock, got)
+	}
+	if err := w.Write(&User{Name: "late"}); err == nil {
+		t.Error("expected an error after Close")
+	}
+}
+
+func TestRDFWriterExistingRoot(t *testing.T) {
+	var rdf bytes.Buffer
+	w := dquely.NewRDFWriter(&rdf, nil, dquely.RDFOptions{Deep: true})
+	for _, owner := range []string{"Bob", "Bill"} {
+		if err := w.Write(&Company{Uid: "0x1", Name: "Acme", Owner: &ShortUser{Name: owner}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The owners of the two writes are distinct new nodes of the existing company.
+	want := "<0x1> <name> \"Acme\" .\n" +
+		"<0x1> <owner> _:r0.company.owner .\n" +
+		"<0x1> <dgraph.type> \"Company\" .\n" +
+		"_:r0.company.owner <name> \"Bob\" .\n" +
+		"_:r0.company.owner <dgraph.type> \"ShortUser\" .\n" +
+		"<0x1> <name> \"Acme\" .\n" +
+		"<0x1> <owner> _:r1.company.owner .\n" +
+		"<0x1> <dgraph.type> \"Company\" .\n" +
+		"_:r1.company.owner <name> \"Bill\" .\n" +
+		"_:r1.company.owner <dgraph.type> \"ShortUser\" .\n"
+	if got := gunzip(t, &rdf); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestCreateRDFFiles(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "users")
+	w, err := dquely.CreateRDFFiles(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&User{Name: "Alice", Age: 29}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name + ".rdf.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := "_:r0.user <name> \"Alice\" .\n_:r0.user <age> \"29\" .\n_:r0.user <dgraph.type> \"User\" .\n"
+	if got := gunzip(t, f); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+	schema, err := os.ReadFile(name + ".schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(schema), "type User {") {
+		t.Errorf("unexpected schema\n%s", schema)
+	}
+	if err := dquely.NewRDFWriter(io.Discard, nil).Write(User{}); err == nil || errors.Unwrap(err) != nil {
+		t.Errorf("expected a plain error for a struct value, got %v", err)
+	}
+}
+
+func TestRDFDecoderRoundTrip(t *testing.T) {
+	var rdf bytes.Buffer
+	w := dquely.NewRDFWriter(&rdf, nil, dquely.RDFOptions{Deep: true})
+	in := &Company{Name: "Acme", Owner: &ShortUser{Name: "Bob", Link: &User{Name: "Bobby", Age: 40}}, Staffs: []ShortUser{{Name: "C"}, {Name: "D"}}}
+	if err := w.Write(in); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := dquely.NewRDFDecoder(&Company{}, &ShortUser{}).Decode(&rdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The company and its three ShortUsers; User is not registered.
+	if len(nodes) != 4 {
+		t.Fatalf("expected 4 nodes, got %d", len(nodes))
+	}
+	out, ok := nodes[0].(*Company)
+	if !ok {
+		t.Fatalf("expected a *Company, got %T", nodes[0])
+	}
+	if out.Name != "Acme" || out.Owner == nil || out.Owner.Name != "Bob" || out.Owner.Link.Age != 40 {
+		t.Errorf("unexpected company %+v", out)
+	}
+	if len(out.Staffs) != 2 || out.Staffs[0].Name != "C" || out.Staffs[1].Name != "D" {
+		t.Errorf("unexpected staffs %+v", out.Staffs)
+	}
+	if nodes[1] != any(out.Owner) {
+		t.Error("expected the owner to be the shared *ShortUser")
+	}
+}
+
+func TestUnmarshalRDF(t *testing.T) {
+	var contacts []*Contact
+	if err := dquely.UnmarshalRDF([]byte(contactExportMock), &contacts); err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 1 {
+		t.Fatalf("expected 1 contact, got %d", len(contacts))
+	}
+	a := contacts[0]
+	if a.Uid != "0x1" || a.Name != "Alice" || a.Nickname != "Ali" || a.Email != "alice@example.com" {
+		t.Errorf("unexpected contact %+v", a)
+	}
+	if a.Roles["admin"] != 2 || !a.CreatedAt.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected roles %v or created at %v", a.Roles, a.CreatedAt)
+	}
+	if len(a.Friends) != 1 || a.Friends[0].Uid != "0x2" || a.Friends[0].Name != "Bob" {
+		t.Errorf("unexpected friends %+v", a.Friends)
+	}
+
+	// RDF query responses carry no dgraph.type: the unreferenced subjects are decoded.
+	var user User
+	if err := dquely.UnmarshalRDF([]byte("<0x5> <name> \"Eve\" .\n<0x5> <age> \"33\"^^<xs:int> .\n"), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Uid != "0x5" || user.Name != "Eve" || user.Age != 33 {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	var users []User
+	err := dquely.UnmarshalRDF([]byte(`<0x5> <age> "old" .`), &users)
+	if err == nil || !strings.Contains(err.Error(), "User.Age") {
+		t.Errorf("expected a conversion error, got %v", err)
+	}
+	if err := dquely.UnmarshalRDF([]byte(`<0x5> <age> "1" .`), users); err == nil {
+		t.Error("expected an error for a non-pointer")
+	}
+}
+
+func TestRDFLists(t *testing.T) {
+	var rdf, schema bytes.Buffer
+	w := dquely.NewRDFWriter(&rdf, &schema)
+	if err := w.Write(&Recipe{Title: "Pho", Tags: []string{"soup", "vietnamese"}, Weights: []float64{0.5, 1.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"tags: [string] .", "ratings: [int] .", "weights: [float] ."} {
+		if !strings.Contains(schema.String(), line) {
+			t.Errorf("expected %q in\n%s", line, schema.String())
+		}
+	}
+	var recipe Recipe
+	if err := dquely.UnmarshalRDF(rdf.Bytes(), &recipe); err != nil {
+		t.Fatal(err)
+	}
+	if len(recipe.Tags) != 2 || recipe.Tags[0] != "soup" || recipe.Tags[1] != "vietnamese" {
+		t.Errorf("unexpected tags %v", recipe.Tags)
+	}
+	if len(recipe.Weights) != 2 || recipe.Weights[1] != 1.5 {
+		t.Errorf("unexpected weights %v", recipe.Weights)
+	}
+}
+
+func TestUnmarshalRDFEmbedded(t *testing.T) {
+	var team Team
+	rdf := "<0x7> <name> \"Core\" .\n<0x7> <createdAt> \"2026-01-02T03:04:05\" .\n"
+	if err := dquely.UnmarshalRDF([]byte(rdf), &team); err != nil {
+		t.Fatal(err)
+	}
+	if team.Uid != "0x7" || team.Name != "Core" || team.CreatedAt.Year() != 2026 {
+		t.Errorf("unexpected team %+v", team)
+	}
+}
+
+func TestRDFTimeRoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	team := &Team{BaseModel: BaseModel{CreatedAt: created}, Name: "Core"}
+
+	var rdf bytes.Buffer
+	w := dquely.NewRDFWriter(&rdf, nil)
+	if err := w.Write(team); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Mutation writes a time.Time as its String form.
+	text := `<0x7> <name> "Core" .` + "\n" + `<0x7> <createdAt> "` + created.String() + `" .`
+	for _, data := range [][]byte{[]byte(gunzip(t, &rdf)), []byte(text)} {
+		var got Team
+		if err := dquely.UnmarshalRDF(data, &got); err != nil {
+			t.Fatalf("decoding\n%s\n%v", data, err)
+		}
+		if !got.CreatedAt.Equal(created) || got.Name != "Core" {
+			t.Errorf("unexpected team %+v from\n%s", got, data)
+		}
+	}
+}
+
+func TestRDFWriterInterfaceTypes(t *testing.T) {
+	var rdf, schema bytes.Buffer
+	w := dquely.NewRDFWriter(&rdf, &schema, dquely.RDFOptions{Deep: true})
+	items := []*Article{
+		{Title: "Launch", Owner: &Team{Name: "Core"}},
+		{Title: "Recap", Editors: []Entity{&Writer{Handle: "ann"}}},
+	}
+	for _, item := range items {
+		if err := w.Write(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, def := range []string{"type Article {", "type Team {\n  createdAt\n  name\n}", "type Author {\n  handle\n}"} {
+		if !strings.Contains(schema.String(), def) {
+			t.Errorf("expected %q in\n%s", def, schema.String())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package dquely
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RenderOptions controls how QueryWith, BuildWith and FormatDQL lay out DQL. The
+// zero value renders exactly like Query and Build.
+type RenderOptions struct {
+	Indent    string // indentation per nesting level; empty keeps two spaces
+	Compact   bool   // single line with minimal whitespace, e.g. for the wire; overrides Indent
+	Canonical bool   // sort selects, filters and directives so equivalent queries render identically
+}
+
+// QueryWith is Query with explicit render options.
+func (d *DQuely) QueryWith(opts RenderOptions) string {
+	if opts.Canonical {
+		d = d.canonical()
+	}
+	return opts.layout(d.Query())
+}
+
+// BuildWith is Build with explicit render options.
+func BuildWith(opts RenderOptions, queries ...*DQuely) string {
+	if opts.Canonical {
+		queries = canonicalAll(queries)
+	}
+	return opts.layout(Build(queries...))
+}
+
+// StringWith renders the document with explicit render options.
+func (doc *Document) StringWith(opts RenderOptions) string {
+	if opts.Canonical {
+		doc = &Document{Name: doc.Name, Vars: doc.Vars, Blocks: canonicalAll(doc.Blocks)}
+	}
+	return opts.layout(doc.String())
+}
+
+// FormatDQL reformats query text, which need not come from this package:
+//
+//	pretty, err := dquely.FormatDQL(text, dquely.RenderOptions{Indent: "\t"})
+//	wire, err := dquely.FormatDQL(text, dquely.RenderOptions{Compact: true})
+func FormatDQL(src string, opts RenderOptions) (string, error) {
+	doc, err := ParseDQL(src)
+	if err != nil {
+		return "", err
+	}
+	return doc.StringWith(opts), nil
+}
+
+// layout applies Indent and Compact to text rendered with the default layout,
+// which indents every level by two spaces.
+func (opts RenderOptions) layout(text string) string {
+	switch {
+	case opts.Compact:
+		return compact(text)
+	case opts.Indent == "" || opts.Indent == "  ":
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		n := len(line) - len(trimmed)
+		lines[i] = strings.Repeat(opts.Indent, n/2) + strings.Repeat(" ", n%2) + trimmed
+	}
+	return strings.Join(lines, "\n")
+}
+
+// regexpArg matches compacted text that ends at the pattern argument of regexp(),
+// the only place a '/' opens a regular expression rather than dividing.
+var regexpArg = regexp.MustCompile(`\bregexp\([^(),]*,$`)
+
+// compact collapses whitespace to single spaces, drops it next to brackets and
+// commas, and removes comments. Strings, regular expressions and <iri>s are copied
+// verbatim.
+func compact(text string) string {
+	var sb strings.Builder
+	space, last := false, byte(0)
+	tight := func(c byte) bool { return strings.IndexByte("{}()[],", c) >= 0 }
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			continue
+		case c == '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		}
+		if space && last != 0 && !tight(c) && !tight(last) {
+			sb.WriteByte(' ')
+		}
+		space = false
+		end := i + 1
+		switch {
+		case c == '"', c == '/' && regexpArg.MatchString(sb.String()):
+			for end < len(text) && text[end] != c {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			if c == '/' {
+				for end < len(text) && 'a' <= text[end] && text[end] <= 'z' {
+					end++
+				}
+			}
+		case c == '<':
+			if j := strings.IndexByte(text[i:], '>'); j > 0 {
+				end = i + j + 1
+			}
+		}
+		if end > len(text) {
+			end = len(text)
+		}
+		sb.WriteString(text[i:end])
+		last = text[end-1]
+		i = end - 1
+	}
+	return sb.String()
+}
+
+func canonicalAll(queries []*DQuely) []*DQuely {
+	out := make([]*DQuely, len(queries))
+	for i, q := range queries {
+		out[i] = q.canonical()
+	}
+	return out
+}
+
+// canonical returns a copy with selects, AND-ed filters, OR terms and directives
+// sorted and comments dropped. Ordering args and block order are kept: they are
+// significant.
+func (d *DQuely) canonical() *DQuely {
+	clone := d.getInstance()
+	clone.filters = make([]filter, 0, len(d.filters))
+	var atFilters []filter
+	for _, f := range d.filters {
+		if f.isFuncPart {
+			clone.filters = append(clone.filters, f)
+			continue
+		}
+		if len(f.orExprs) > 0 {
+			f.orExprs = append([]string{}, f.orExprs...)
+			sort.Strings(f.orExprs)
+		}
+		atFilters = append(atFilters, f)
+	}
+	sort.SliceStable(atFilters, func(i, j int) bool { return filterKey(atFilters[i]) < filterKey(atFilters[j]) })
+	clone.filters = append(clone.filters, atFilters...)
+	clone.directives = append([]string{}, d.directives...)
+	sort.Strings(clone.directives)
+	clone.selects = make([]any, 0, len(d.selects))
+	for _, s := range d.selects {
+		switch v := s.(type) {
+		case string:
+			if !strings.HasPrefix(strings.TrimSpace(v), "#") {
+				clone.selects = append(clone.selects, v)
+			}
+		case *DQuely:
+			clone.selects = append(clone.selects, v.canonical())
+		default:
+			clone.selects = append(clone.selects, s)
+		}
+	}
+	sort.SliceStable(clone.selects, func(i, j int) bool { return selectKey(clone.selects[i]) < selectKey(clone.selects[j]) })
+	return clone
+}
+
+func filterKey(f filter) string {
+	if len(f.orExprs) > 0 {
+		return strings.Join(f.orExprs, " OR ")
+	}
+	return f.expr
+}
+
+// selectKey orders selects by the name they render under, ignoring variable
+// assignments: "a as age" sorts as "age".
+func selectKey(s any) string {
+	switch v := s.(type) {
+	case string:
+		if _, after, ok := strings.Cut(v, " as "); ok {
+			return strings.TrimSpace(after)
+		}
+		return strings.TrimSpace(v)
+	case *DQuely:
+		return strings.TrimSpace(v.name)
+	}
+	return ""
+}
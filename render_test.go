@@ -0,0 +1,72 @@
+package dquely_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vibros68/dquely"
+)
+
+func TestQueryWithIndent(t *testing.T) {
+	q := dquely.NewDQL("people").Type("Person").Select("uid", dquely.NewDQL("").Select("name").As("friends"))
+	if got := q.QueryWith(dquely.RenderOptions{}); got != q.Query() {
+		t.Errorf("expected the zero options to match Query, got %s", got)
+	}
+	want := "{\n\tpeople(func: type(Person)) {\n\t\tuid\n\t\tfriends {\n\t\t\tname\n\t\t}\n\t}\n}"
+	if got := q.QueryWith(dquely.RenderOptions{Indent: "\t"}); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestBuildWithCompact(t *testing.T) {
+	q := dquely.NewDQL("").As("people").Type("Person").Eq("name", "Al  {Bob}").
+		Or(dquely.Regexp("email", "^a b"), dquely.Has("phone")).
+		Select("uid", "name@en", dquely.NewDQL("").Select("uid").As("friends").First(2))
+	want := `{people(func: type(Person))@filter(eq(name,"Al  {Bob}")AND(regexp(email,/^a b/)OR has(phone))){uid name@en friends(first: 2){uid}}}`
+	if got := dquely.BuildWith(dquely.RenderOptions{Compact: true}, q); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestBuildWithCompactMath(t *testing.T) {
+	q := dquely.NewDQL("").As("people").Type("Person").Filter(dquely.Regexp("name", "^A  B")).
+		Select("a as age", "half : math(a  /  2)", "third : math(a  /  3)")
+	want := `{people(func: type(Person))@filter(regexp(name,/^A  B/)){a as age half : math(a / 2)third : math(a / 3)}}`
+	if got := dquely.BuildWith(dquely.RenderOptions{Compact: true}, q); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	a := dquely.NewDQL("people").Type("Person").Eq("name", "Al").Filter(dquely.Has("email")).
+		Select("uid", "name", "a as age")
+	b := dquely.NewDQL("people").Type("Person").Filter(dquely.Has("email"), dquely.Eq("name", "Al")).
+		Select("a as age", "name", "uid")
+	opts := dquely.RenderOptions{Canonical: true}
+	if a.QueryWith(opts) != b.QueryWith(opts) {
+		t.Errorf("expected equal canonical forms, got\n%s\nand\n%s", a.QueryWith(opts), b.QueryWith(opts))
+	}
+	if a.Query() == b.Query() {
+		t.Error("expected the default rendering to keep builder order")
+	}
+}
+
+func TestFormatDQL(t *testing.T) {
+	got, err := dquely.FormatDQL(groupByWithCommentMock, dquely.RenderOptions{Compact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "\n") || strings.Contains(got, "#") {
+		t.Errorf("expected a single line without comments, got %s", got)
+	}
+	pretty, err := dquely.FormatDQL(got, dquely.RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := dquely.FormatDQL(pretty, dquely.RenderOptions{Compact: true}); again != got {
+		t.Errorf("expected compact output to be stable, got\n%s\nthen\n%s", got, again)
+	}
+	if _, err := dquely.FormatDQL("{ broken(", dquely.RenderOptions{}); err == nil {
+		t.Error("expected a parse error")
+	}
+}
@@ -0,0 +1,138 @@
+package dquely
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/dgraph-io/dgo/v250"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults applied by RetryPolicy when retries are enabled but a field is zero.
+const (
+	DefaultInitialBackoff = 50 * time.Millisecond
+	DefaultMaxBackoff     = 2 * time.Second
+	DefaultMultiplier     = 2.0
+)
+
+// RetryPolicy controls how DoTxn, Mutate and Update retry failed attempts.
+// The zero value makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// Multiplier grows the delay after every retry.
+	Multiplier float64 `mapstructure:"multiplier"`
+	// Jitter randomizes each delay by up to ±Jitter of its value (0 to 1).
+	Jitter float64 `mapstructure:"jitter"`
+	// Retryable classifies errors. When nil, DoTxn uses IsRetryable until it commits
+	// and IsAborted for the commit, and the writes committed in a single request
+	// (Mutate, Update, Upsert, MutateMany) use IsAborted.
+	Retryable func(err error) bool `mapstructure:"-"`
+	// OnRetry, when set, is called before sleeping ahead of every retry.
+	OnRetry func(RetryEvent) `mapstructure:"-"`
+}
+
+// RetryEvent describes a failed attempt that is about to be retried.
+type RetryEvent struct {
+	Operation string        // e.g. "Mutate", "Update", "DoTxn"
+	Attempt   int           // the attempt that failed, starting at 1
+	Err       error         // the error returned by that attempt
+	Delay     time.Duration // how long the client waits before the next attempt
+}
+
+// IsRetryable reports whether err is worth retrying: an aborted transaction
+// (dgo.ErrAborted or codes.Aborted) or a transient gRPC failure
+// (codes.Unavailable, codes.ResourceExhausted).
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, dgo.ErrAborted) {
+		return true
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Aborted, codes.Unavailable, codes.ResourceExhausted:
+			return true
+		}
+	}
+	return false
+}
+
+// IsAborted reports whether err is an aborted transaction (dgo.ErrAborted or
+// codes.Aborted). Only these failures are retried by default for requests that
+// commit immediately: after a transient error their commit may have gone through,
+// and sending them again would write twice.
+func IsAborted(err error) bool {
+	if errors.Is(err, dgo.ErrAborted) {
+		return true
+	}
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.Aborted
+}
+
+// backoff returns the delay before retrying after the given failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial, maxDelay, mult := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxBackoff
+	}
+	if mult < 1 {
+		mult = DefaultMultiplier
+	}
+	delay := math.Min(float64(initial)*math.Pow(mult, float64(attempt-1)), float64(maxDelay))
+	if p.Jitter > 0 {
+		delay += delay * math.Min(p.Jitter, 1) * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// retryCommit runs a request with CommitNow, which by default is only repeated when
+// it was aborted.
+func (p RetryPolicy) retryCommit(ctx context.Context, op string, fn func() error) error {
+	return p.run(ctx, op, IsAborted, fn)
+}
+
+// run runs fn until it succeeds, returns an error retryable does not accept, or the
+// policy runs out of attempts. p.Retryable replaces retryable when set. Every retry
+// is recorded as an event on the span in ctx.
+func (p RetryPolicy) run(ctx context.Context, op string, retryable func(error) bool, fn func() error) error {
+	if p.Retryable != nil {
+		retryable = p.Retryable
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		delay := p.backoff(attempt)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("dquely.retry.attempt", attempt),
+			attribute.String("dquely.retry.error", err.Error()),
+			attribute.Int64("dquely.retry.delay_ms", delay.Milliseconds()),
+		))
+		if p.OnRetry != nil {
+			p.OnRetry(RetryEvent{Operation: op, Attempt: attempt, Err: err, Delay: delay})
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
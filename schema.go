@@ -0,0 +1,406 @@
+package dquely
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema describes the predicates and types of a Dgraph schema. Build one with
+// ParseSchema, SchemaOf or Dgo.Schema, and check queries against it with Validate.
+type Schema struct {
+	Predicates map[string]*PredicateSchema
+	Types      map[string][]string // type name -> predicates, in definition order
+}
+
+// PredicateSchema is the schema of one predicate.
+type PredicateSchema struct {
+	Name       string
+	Type       string   // default, string, int, float, bool, datetime, geo, password or uid
+	List       bool     // declared as [type]
+	Tokenizers []string // @index(...) tokenizers such as exact, hash, term, fulltext, trigram
+	Reverse    bool
+	Count      bool
+	Upsert     bool
+	Lang       bool
+	Unique     bool
+}
+
+// Indexed reports whether the predicate has any of the given tokenizers, or any
+// index at all when none are given.
+func (p *PredicateSchema) Indexed(tokenizers ...string) bool {
+	if len(tokenizers) == 0 {
+		return len(p.Tokenizers) > 0
+	}
+	for _, t := range p.Tokenizers {
+		for _, want := range tokenizers {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// predicateTypes are the scalar types accepted in schema text.
+var predicateTypes = map[string]bool{
+	"default": true, "string": true, "int": true, "float": true, "bool": true,
+	"datetime": true, "geo": true, "password": true, "uid": true, "float32vector": true,
+}
+
+func newSchema() *Schema {
+	return &Schema{Predicates: map[string]*PredicateSchema{}, Types: map[string][]string{}}
+}
+
+// ParseSchema parses schema text as passed to SetSchema:
+//
+//	name: string @index(exact, term) @upsert .
+//	friends: [uid] @reverse @count .
+//	type Person { name friends }
+func ParseSchema(text string) (*Schema, error) {
+	s := newSchema()
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if j := strings.IndexByte(line, '#'); j >= 0 {
+			line = strings.TrimSpace(line[:j])
+		}
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "type ") {
+			// The type body may span several lines.
+			body := line
+			for !strings.Contains(body, "}") && i+1 < len(lines) {
+				i++
+				body += "\n" + lines[i]
+			}
+			if err := s.parseType(body); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := s.parsePredicate(line); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) parseType(body string) error {
+	open := strings.IndexByte(body, '{')
+	end := strings.LastIndexByte(body, '}')
+	if open < 0 || end < open {
+		return fmt.Errorf("dquely: invalid type definition %q", body)
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(body[:open], "type "))
+	var fields []string
+	for _, f := range strings.Fields(body[open+1 : end]) {
+		if f = strings.Trim(f, "<>:"); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	s.Types[name] = fields
+	return nil
+}
+
+func (s *Schema) parsePredicate(line string) error {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 || !strings.HasSuffix(line, ".") {
+		return fmt.Errorf("dquely: invalid schema line %q", line)
+	}
+	p := &PredicateSchema{Name: strings.Trim(strings.TrimSpace(line[:colon]), "<>")}
+	rest := strings.TrimSpace(strings.TrimSuffix(line[colon+1:], "."))
+	typ, rest, _ := strings.Cut(rest, " ")
+	if strings.HasPrefix(typ, "[") {
+		p.List = true
+		typ = strings.Trim(typ, "[]")
+	}
+	if !predicateTypes[typ] {
+		return fmt.Errorf("dquely: unknown type %q for predicate %s", typ, p.Name)
+	}
+	p.Type = typ
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		if rest[0] != '@' {
+			return fmt.Errorf("dquely: invalid directive %q for predicate %s", rest, p.Name)
+		}
+		end := strings.IndexAny(rest, " (")
+		if end < 0 {
+			end = len(rest)
+		}
+		name := rest[1:end]
+		rest = rest[end:]
+		var args []string
+		if strings.HasPrefix(rest, "(") {
+			close := strings.IndexByte(rest, ')')
+			if close < 0 {
+				return fmt.Errorf("dquely: unterminated @%s for predicate %s", name, p.Name)
+			}
+			for _, a := range strings.Split(rest[1:close], ",") {
+				if a = strings.TrimSpace(a); a != "" {
+					args = append(args, a)
+				}
+			}
+			rest = rest[close+1:]
+		}
+		switch name {
+		case "index":
+			p.Tokenizers = append(p.Tokenizers, args...)
+		case "reverse":
+			p.Reverse = true
+		case "count":
+			p.Count = true
+		case "upsert":
+			p.Upsert = true
+		case "lang":
+			p.Lang = true
+		case "unique":
+			p.Unique = true
+		}
+	}
+	s.Predicates[p.Name] = p
+	return nil
+}
+
+// String renders the schema as text for SetSchema, predicates and types sorted by name.
+func (s *Schema) String() string {
+	var sb strings.Builder
+	names := make([]string, 0, len(s.Predicates))
+	for name := range s.Predicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := s.Predicates[name]
+		typ := p.Type
+		if p.List {
+			typ = "[" + typ + "]"
+		}
+		sb.WriteString(name + ": " + typ)
+		if len(p.Tokenizers) > 0 {
+			sb.WriteString(" @index(" + strings.Join(p.Tokenizers, ", ") + ")")
+		}
+		for _, d := range []struct {
+			on   bool
+			name string
+		}{{p.Reverse, "reverse"}, {p.Count, "count"}, {p.Upsert, "upsert"}, {p.Lang, "lang"}, {p.Unique, "unique"}} {
+			if d.on {
+				sb.WriteString(" @" + d.name)
+			}
+		}
+		sb.WriteString(" .\n")
+	}
+	types := make([]string, 0, len(s.Types))
+	for name := range s.Types {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	for _, name := range types {
+		sb.WriteString("\ntype " + name + " {\n")
+		for _, f := range s.Types[name] {
+			sb.WriteString("  " + f + "\n")
+		}
+		sb.WriteString("}\n")
+	}
+	return sb.String()
+}
+
+// SchemaOf generates a schema from model structs, following the dquely tags that
+// Mutation uses. Nested structs become uid edges and are included as types too.
+// Interface edges are uid edges to the structs the models hold in them; pass a model
+// of every other implementation to include its type.
+// Fields tagged unique get @index(exact) @upsert, as do the shadow predicates of
+// normalized unique fields; other predicates have no index.
+func SchemaOf(models ...any) (*Schema, error) {
+	return schemaOf(UniqueQuery, models...)
+}
+
+// SchemaOf is the package SchemaOf for the client's Unique mode. Under UniqueServer
+// the predicates of fields tagged unique, or their shadow predicates when the fields
+// are normalized, also get @unique. Fields of composite keys do not.
+func (d *Dgo) SchemaOf(models ...any) (*Schema, error) {
+	return schemaOf(d.Unique, models...)
+}
+
+func schemaOf(mode UniqueMode, models ...any) (*Schema, error) {
+	s := newSchema()
+	seen := map[reflect.Type]bool{}
+	for _, m := range models {
+		t := reflect.TypeOf(m)
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("dquely: SchemaOf expects structs, got %T", m)
+		}
+		s.addStruct(t, mode, seen)
+		if v := reflect.Indirect(reflect.ValueOf(m)); v.Kind() == reflect.Struct {
+			// The structs behind interface edges are only known from the values.
+			eachNode(v, func(node reflect.Value) { s.addStruct(node.Type(), mode, seen) })
+		}
+	}
+	return s, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// addStruct adds the predicates of t and merges them into its Dgraph type, which
+// several Go structs may share.
+func (s *Schema) addStruct(t reflect.Type, mode UniqueMode, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	typeName := dgraphTypeOf(reflect.New(t).Interface())
+	if s.Types[typeName] == nil {
+		s.Types[typeName] = []string{}
+	}
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
+		if rawTag == "-" || !field.IsExported() {
+			continue
+		}
+		predicate, isJSON, isUnique := parseTag(rawTag, field.Name)
+		if predicate == "uid" || predicate == "dgraph.type" {
+			continue
+		}
+		p := &PredicateSchema{Name: predicate}
+		ft := field.Type
+		if elem, ok := optionalElem(ft); ok {
+			ft = elem
+		}
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 && !isJSON {
+			p.List = true
+			ft = ft.Elem()
+		}
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch {
+		case isJSON:
+			p.Type = "string"
+		case ft == timeType:
+			p.Type = "datetime"
+		case ft.Kind() == reflect.Struct:
+			p.Type = "uid"
+			s.addStruct(ft, mode, seen)
+		case isInterfaceEdge(ft):
+			// Its concrete types are added from the model values by schemaOf.
+			p.Type = "uid"
+		default:
+			p.Type = scalarType(ft.Kind())
+		}
+		group, fold, trim := uniqueOptions(rawTag)
+		normalized := isUnique && (fold || trim)
+		// Dgraph enforces the values of the predicate the uniqueness query compares.
+		serverUnique := isUnique && mode == UniqueServer && group == ""
+		if isUnique {
+			p.Tokenizers = []string{"exact"}
+			p.Upsert = true
+			p.Unique = serverUnique && !normalized
+		}
+		if prev := s.Predicates[predicate]; prev != nil {
+			// A predicate shared by several types keeps the strongest definition.
+			p.Tokenizers = mergeTokenizers(prev.Tokenizers, p.Tokenizers)
+			p.Upsert = p.Upsert || prev.Upsert
+			p.List = p.List || prev.List
+			p.Unique = p.Unique || prev.Unique
+		}
+		s.Predicates[predicate] = p
+		if !containsString(s.Types[typeName], predicate) {
+			s.Types[typeName] = append(s.Types[typeName], predicate)
+		}
+		if normalized {
+			norm := normalizedPredicate(predicate)
+			s.Predicates[norm] = &PredicateSchema{Name: norm, Type: "string", Tokenizers: []string{"exact"}, Upsert: true, Unique: serverUnique}
+			if !containsString(s.Types[typeName], norm) {
+				s.Types[typeName] = append(s.Types[typeName], norm)
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func scalarType(k reflect.Kind) string {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Bool:
+		return "bool"
+	}
+	return "string"
+}
+
+func mergeTokenizers(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, t := range b {
+		if !containsString(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// schemaResponse is the JSON answer to a "schema {}" query.
+type schemaResponse struct {
+	Schema []struct {
+		Predicate string   `json:"predicate"`
+		Type      string   `json:"type"`
+		Index     bool     `json:"index"`
+		Tokenizer []string `json:"tokenizer"`
+		Reverse   bool     `json:"reverse"`
+		Count     bool     `json:"count"`
+		List      bool     `json:"list"`
+		Upsert    bool     `json:"upsert"`
+		Lang      bool     `json:"lang"`
+		Unique    bool     `json:"unique"`
+	} `json:"schema"`
+	Types []struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	} `json:"types"`
+}
+
+// Schema fetches the current schema from Dgraph.
+func (d *Dgo) Schema(ctx context.Context) (*Schema, error) {
+	resp, err := d.Query(ctx, "schema {}", TxnOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("dgo: schema: %w", err)
+	}
+	var raw schemaResponse
+	if err := json.Unmarshal(resp.Json, &raw); err != nil {
+		return nil, fmt.Errorf("dgo: schema: %w", err)
+	}
+	s := newSchema()
+	for _, p := range raw.Schema {
+		s.Predicates[p.Predicate] = &PredicateSchema{
+			Name: p.Predicate, Type: p.Type, List: p.List, Tokenizers: p.Tokenizer,
+			Reverse: p.Reverse, Count: p.Count, Upsert: p.Upsert, Lang: p.Lang, Unique: p.Unique,
+		}
+	}
+	for _, t := range raw.Types {
+		fields := make([]string, len(t.Fields))
+		for i, f := range t.Fields {
+			fields[i] = f.Name
+		}
+		s.Types[t.Name] = fields
+	}
+	return s, nil
+}
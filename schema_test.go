@@ -0,0 +1,204 @@
+package dquely_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vibros68/dquely"
+)
+
+const validateSchemaMock = `age: int @index(int) .
+email: string @index(exact) @upsert .
+flag: bool .
+friends: [uid] @count .
+name: string @index(term) @lang .
+owner: uid @reverse .
+
+type Person {
+  name
+  age
+  friends
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	s, err := dquely.ParseSchema(validateSchemaMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Predicates["friends"]; p == nil || p.Type != "uid" || !p.List || !p.Count {
+		t.Errorf("unexpected friends schema %+v", p)
+	}
+	if p := s.Predicates["email"]; !p.Indexed("exact") || p.Indexed("term") || !p.Upsert {
+		t.Errorf("unexpected email schema %+v", p)
+	}
+	if got := strings.Join(s.Types["Person"], " "); got != "name age friends" {
+		t.Errorf("unexpected Person fields %s", got)
+	}
+	if got := s.String(); got != validateSchemaMock {
+		t.Errorf("expected\n%s\ngot\n%s", validateSchemaMock, got)
+	}
+	if _, err := dquely.ParseSchema("name: text ."); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	s, err := dquely.SchemaOf(&Company{}, UserWithUnique{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `age: int .
+email: string @index(exact) @upsert .
+link: uid .
+name: string .
+owner: uid .
+staffs: [uid] .
+userName: string @index(exact) @upsert .
+
+type Company {
+  name
+  owner
+  staffs
+}
+
+type ShortUser {
+  name
+  link
+}
+
+type User {
+  name
+  age
+  email
+  userName
+}
+`
+	if got := s.String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestSchemaOfNormalized(t *testing.T) {
+	s, err := dquely.SchemaOf(&TenantUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `email: string @index(exact) @upsert .
+email_norm: string @index(exact) @upsert .
+handle: string @index(exact) @upsert .
+handle_norm: string @index(exact) @upsert .
+name: string .
+tenant: string @index(exact) @upsert .
+
+type TenantUser {
+  tenant
+  email
+  email_norm
+  handle
+  handle_norm
+  name
+}
+`
+	if got := s.String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestSchemaOfServerUnique(t *testing.T) {
+	client := &dquely.Dgo{Unique: dquely.UniqueServer}
+	s, err := client.SchemaOf(&UserWithUnique{}, &TenantUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// email is unique on its own in UserWithUnique, which wins over the composite key
+	// of TenantUser.
+	for name, unique := range map[string]bool{
+		"userName": true, "email": true, "handle": false, "handle_norm": true,
+		"tenant": false, "email_norm": false, "age": false,
+	} {
+		if got := s.Predicates[name].Unique; got != unique {
+			t.Errorf("%s: expected unique %v, got %v", name, unique, got)
+		}
+	}
+	if got := s.String(); !strings.Contains(got, "userName: string @index(exact) @upsert @unique .\n") {
+		t.Errorf("expected userName to be @unique, got\n%s", got)
+	}
+}
+
+func TestSchemaOfEmbeddedAndInterface(t *testing.T) {
+	s, err := dquely.SchemaOf(&Article{}, &Team{}, &Writer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"createdAt": "datetime", "owner": "uid", "editors": "uid"} {
+		if p := s.Predicates[name]; p == nil || p.Type != want || p.List != (name == "editors") {
+			t.Errorf("%s: expected %s, got %+v", name, want, p)
+		}
+	}
+	if s.Predicates["BaseModel"] != nil {
+		t.Error("expected BaseModel to be promoted, not a predicate")
+	}
+	if got := strings.Join(s.Types["Team"], " "); got != "createdAt name" {
+		t.Errorf("unexpected Team fields %s", got)
+	}
+
+	// The structs held by interface edges are included without being passed.
+	s, err = dquely.SchemaOf(&Article{Owner: &Team{}, Editors: []Entity{&Writer{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Predicates["owner"]; p == nil || p.Type != "uid" {
+		t.Errorf("expected owner to be a uid edge, got %+v", p)
+	}
+	for name, want := range map[string]string{"Team": "createdAt name", "Author": "handle"} {
+		if got, ok := s.Types[name]; !ok || strings.Join(got, " ") != want {
+			t.Errorf("expected type %s with %s, got %v", name, want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, err := dquely.ParseSchema(validateSchemaMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := dquely.NewDQL("people").AllOfTerms("name", "Al").Gt("age", 18).Order("age", dquely.ASC).
+		Select("uid", "name@en", "count(friends)",
+			dquely.NewDQL("").As("friends").Filter(dquely.Eq("email", "a@b.io")).Select("name"))
+	if err := ok.Validate(s); err != nil {
+		t.Errorf("expected a valid query, got %v", err)
+	}
+
+	bad := dquely.NewDQL("people").Regexp("name", "^A").Order("flag", dquely.DESC).
+		Select("nickname", dquely.NewDQL("").As("age").Select("uid"), "~friends")
+	err = bad.Validate(s)
+	want := []string{
+		"dquely: people: regexp needs @index(trigram) on name",
+		"dquely: people: cannot orderdesc by flag of type bool",
+		"dquely: people.nickname: predicate nickname is not in the schema",
+		"dquely: people.age: age is of type int cannot have a nested select",
+		"dquely: people.~friends: ~friends needs @reverse on friends",
+	}
+	want[3] = "dquely: people.age: age is of type int and cannot have a nested select"
+	if err == nil || err.Error() != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%v", strings.Join(want, "\n"), err)
+	}
+	var se *dquely.SchemaError
+	if !errors.As(err, &se) || se.Path != "people" {
+		t.Errorf("expected a *SchemaError for people, got %v", err)
+	}
+
+	root := dquely.NewDQL("q").Func(dquely.Eq("flag", true))
+	if err := root.Validate(s); err == nil || !strings.Contains(err.Error(), "eq at the root needs an index on flag") {
+		t.Errorf("expected a missing index error, got %v", err)
+	}
+	if err := dquely.NewDQL("q").Has("friends").Eq("flag", true).Validate(s); err != nil {
+		t.Errorf("expected eq in a filter to need no index, got %v", err)
+	}
+	count := dquely.NewDQL("q").Func(dquely.Gt(dquely.Count("name"), 1))
+	if err := count.Validate(s); err == nil || !strings.Contains(err.Error(), "needs @count on name") {
+		t.Errorf("expected a missing @count error, got %v", err)
+	}
+}
@@ -60,3 +60,42 @@ func TestSetUIDs(t *testing.T) {
 		t.Errorf("expected uid to be 0x13893, got %s", employee.CurrentSalary.Uid)
 	}
 }
+
+func TestSetUIDsDeep(t *testing.T) {
+	company := &Company{
+		Name:   "A",
+		Owner:  &ShortUser{Name: "U", Link: &User{Name: "UL"}},
+		Staffs: []ShortUser{{Name: "S1", Link: &User{Name: "SL"}}},
+	}
+	_, mus, err := dquely.ParseMutation(company, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both links used to be named _:link.
+	if got := string(mus[0].SetNquads); got != companyLinksMutationMock {
+		t.Errorf("expected\n%s\ngot\n%s", companyLinksMutationMock, got)
+	}
+	nodes, err := dquely.BlankNodeMap(company)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 5 || nodes["company.staffs0.link"] != any(company.Staffs[0].Link) || nodes["company.staffs0"] != any(&company.Staffs[0]) {
+		t.Errorf("unexpected blank nodes %v", nodes)
+	}
+	err = dquely.SetUIDs(company, map[string]string{
+		"company":              "0x1",
+		"company.owner":        "0x2",
+		"company.owner.link":   "0x3",
+		"company.staffs0":      "0x4",
+		"company.staffs0.link": "0x5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{company.Uid, company.Owner.Uid, company.Owner.Link.Uid, company.Staffs[0].Uid, company.Staffs[0].Link.Uid}
+	for i, want := range []string{"0x1", "0x2", "0x3", "0x4", "0x5"} {
+		if got[i] != want {
+			t.Errorf("uid %d: expected %s, got %s", i, want, got[i])
+		}
+	}
+}
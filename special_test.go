@@ -40,6 +40,11 @@ func TestSpecialDeepMultiMutation(t *testing.T) {
 	const expectedQuery = `{
   v as var(func: type(Companies))
     @filter(eq(slug, "a"))
+
+  duplicates(func: uid(v)) {
+    uid
+    slug
+  }
 }
 `
 	if query != expectedQuery {
@@ -52,11 +57,11 @@ func TestSpecialDeepMultiMutation(t *testing.T) {
 	}
 	const expectedSet = `_:companies <name> "A" .
 _:companies <slug> "a" .
-_:companies <users> _:users0 .
+_:companies <users> _:companies.users0 .
 _:companies <dgraph.type> "Companies" .
-_:users0 <isOwner> "true" .
-_:users0 <user> <0x1> .
-_:users0 <dgraph.type> "Membership" .`
+_:companies.users0 <isOwner> "true" .
+_:companies.users0 <user> <0x1> .
+_:companies.users0 <dgraph.type> "Membership" .`
 	if string(cond.SetNquads) != expectedSet {
 		t.Errorf("expected ParseMutation() to get Mutation %s, got %s", expectedSet, string(cond.SetNquads))
 	}
@@ -64,7 +69,7 @@ _:users0 <dgraph.type> "Membership" .`
 		t.Errorf("expected ParseMutation() to get Mutation be empty, got %s", string(cond.SetNquads))
 	}
 	// test SetUIDs
-	err = dquely.SetUIDs(&company, map[string]string{"company": "0xc352", "users0": "0xc353"})
+	err = dquely.SetUIDs(&company, map[string]string{"companies": "0xc352", "companies.users0": "0xc353"})
 	if err != nil {
 		t.Fatalf("dquely.SetUIDs: expect error to be nil got %v", err)
 	}
@@ -90,37 +95,46 @@ func TestSpecialSecondDeepMultiMutation(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(muConds) != 1 {
-		t.Fatalf("expected 1 condition, got %d", len(muConds))
+	if len(muConds) != 3 {
+		t.Fatalf("expected 3 conditions, got %d", len(muConds))
 	}
 	const expectedQuery = `{
-  v as var(func: type(Companies))
+  v1 as var(func: type(Companies))
     @filter(eq(slug, "a"))
+
+  linked_v1(func: uid(v1)) {
+    uid
+  }
 }
 `
 	if query != expectedQuery {
 		t.Fatalf("expected ParseMutation() to get query be %s, got %s", expectedQuery, query)
 	}
-	var cond = muConds[0]
-	const expectedCond = `@if(eq(len(v), 0))`
-	if cond.Cond != expectedCond {
-		t.Fatalf("expected ParseMutation() to get Condition be %s, got %s", expectedCond, cond.Cond)
-	}
-	const expectedSet = `_:membership <isOwner> "true" .
+	// The membership is always written; the company is inserted, or linked when a
+	// company with slug "a" exists.
+	expected := []struct{ cond, set string }{
+		{"", `_:membership <isOwner> "true" .
 _:membership <user> <0x1> .
-_:membership <company> _:company .
-_:membership <dgraph.type> "Membership" .
-_:company <name> "A" .
-_:company <slug> "a" .
-_:company <dgraph.type> "Companies" .`
-	if string(cond.SetNquads) != expectedSet {
-		t.Errorf("expected ParseMutation() to get Mutation %s, got %s", expectedSet, string(cond.SetNquads))
-	}
-	if string(cond.DelNquads) != "" {
-		t.Errorf("expected ParseMutation() to get Mutation be empty, got %s", string(cond.SetNquads))
+_:membership <dgraph.type> "Membership" .`},
+		{"@if(eq(len(v1), 0))", `_:membership <company> _:membership.company .
+_:membership.company <name> "A" .
+_:membership.company <slug> "a" .
+_:membership.company <dgraph.type> "Companies" .`},
+		{"@if(gt(len(v1), 0))", `_:membership <company> uid(v1) .`},
+	}
+	for i, want := range expected {
+		if muConds[i].Cond != want.cond {
+			t.Errorf("mutation %d: expected Condition %s, got %s", i, want.cond, muConds[i].Cond)
+		}
+		if string(muConds[i].SetNquads) != want.set {
+			t.Errorf("mutation %d: expected Mutation %s, got %s", i, want.set, string(muConds[i].SetNquads))
+		}
+		if string(muConds[i].DelNquads) != "" {
+			t.Errorf("mutation %d: expected DelNquads to be empty, got %s", i, string(muConds[i].DelNquads))
+		}
 	}
 	// test SetUIDs
-	err = dquely.SetUIDs(&membership, map[string]string{"membership": "0xc352", "company": "0xc353"})
+	err = dquely.SetUIDs(&membership, map[string]string{"membership": "0xc352", "membership.company": "0xc353"})
 	if err != nil {
 		t.Fatalf("dquely.SetUIDs: expect error to be nil got %v", err)
 	}
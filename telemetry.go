@@ -0,0 +1,188 @@
+package dquely
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the scope name used for the tracer and meter.
+const instrumentationName = "github.com/vibros68/dquely"
+
+// Attribute keys recorded on client spans and metrics.
+const (
+	AttrOperation     = attribute.Key("dquely.operation")
+	AttrBlock         = attribute.Key("dquely.block")
+	AttrDgraphType    = attribute.Key("dgraph.type")
+	AttrMutationSize  = attribute.Key("dquely.mutation.size")
+	AttrStatus        = attribute.Key("dquely.status")
+	AttrReadOnly      = attribute.Key("dquely.txn.read_only")
+	AttrBestEffort    = attribute.Key("dquely.txn.best_effort")
+	AttrServerLatency = attribute.Key("dgraph.latency.total_ns")
+	AttrParsingNs     = attribute.Key("dgraph.latency.parsing_ns")
+	AttrProcessingNs  = attribute.Key("dgraph.latency.processing_ns")
+	AttrEncodingNs    = attribute.Key("dgraph.latency.encoding_ns")
+)
+
+// Telemetry holds the OpenTelemetry providers used to instrument client operations.
+// A nil provider falls back to the global one registered with the otel package.
+type Telemetry struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+// instruments bundles the tracer and metric instruments created from a Telemetry.
+type instruments struct {
+	tracer        trace.Tracer
+	operations    metric.Int64Counter
+	duration      metric.Float64Histogram
+	mutationSize  metric.Int64Histogram
+	serverLatency metric.Float64Histogram
+}
+
+func newInstruments(tel Telemetry) (*instruments, error) {
+	tp := tel.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	mp := tel.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+
+	ins := &instruments{tracer: tp.Tracer(instrumentationName)}
+	var err error
+	ins.operations, err = meter.Int64Counter("dquely.client.operations",
+		metric.WithDescription("Number of client operations, by operation and status."))
+	if err != nil {
+		return nil, fmt.Errorf("dquely: create operations counter: %w", err)
+	}
+	ins.duration, err = meter.Float64Histogram("dquely.client.duration",
+		metric.WithDescription("Client-side duration of operations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("dquely: create duration histogram: %w", err)
+	}
+	ins.mutationSize, err = meter.Int64Histogram("dquely.client.mutation.size",
+		metric.WithDescription("Size of the N-Quads sent per mutation request."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, fmt.Errorf("dquely: create mutation size histogram: %w", err)
+	}
+	ins.serverLatency, err = meter.Float64Histogram("dquely.client.server_latency",
+		metric.WithDescription("Server latency reported by Dgraph in api.Response.Latency."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("dquely: create server latency histogram: %w", err)
+	}
+	return ins, nil
+}
+
+// SetTelemetry instruments the client with the given providers. Operations started
+// afterwards emit spans and metrics through them.
+func (d *Dgo) SetTelemetry(tel Telemetry) error {
+	ins, err := newInstruments(tel)
+	if err != nil {
+		return err
+	}
+	d.ins.Store(ins)
+	return nil
+}
+
+// instruments returns the client instruments, falling back to the global providers.
+func (d *Dgo) instruments() *instruments {
+	if ins := d.ins.Load(); ins != nil {
+		return ins
+	}
+	// The global providers never fail to create instruments.
+	ins, _ := newInstruments(Telemetry{})
+	d.ins.CompareAndSwap(nil, ins)
+	return d.ins.Load()
+}
+
+// globalInstruments are the instruments of clients other than *Dgo, built once from
+// the global providers.
+var globalInstruments = sync.OnceValue(func() *instruments {
+	ins, _ := newInstruments(Telemetry{})
+	return ins
+})
+
+// clientInstruments returns the instruments of c when it is a *Dgo, and instruments
+// built from the global providers otherwise.
+func clientInstruments(c Client) *instruments {
+	if d, ok := c.(*Dgo); ok {
+		return d.instruments()
+	}
+	return globalInstruments()
+}
+
+// operation tracks a single instrumented client call.
+type operation struct {
+	ins   *instruments
+	span  trace.Span
+	start time.Time
+	attrs []attribute.KeyValue
+}
+
+// startOperation opens a span named "dquely.<name>" and returns the derived context.
+func (d *Dgo) startOperation(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *operation) {
+	return d.instruments().start(ctx, name, attrs...)
+}
+
+// start opens a span named "dquely.<name>" and returns the derived context.
+func (ins *instruments) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *operation) {
+	attrs = append([]attribute.KeyValue{AttrOperation.String(name)}, attrs...)
+	ctx, span := ins.tracer.Start(ctx, "dquely."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	return ctx, &operation{ins: ins, span: span, start: time.Now(), attrs: attrs}
+}
+
+// recordMutations annotates the operation with the total N-Quad payload size.
+func (o *operation) recordMutations(ctx context.Context, mus []*api.Mutation) {
+	size := 0
+	for _, mu := range mus {
+		size += len(mu.SetNquads) + len(mu.DelNquads) + len(mu.SetJson) + len(mu.DeleteJson)
+	}
+	o.span.SetAttributes(AttrMutationSize.Int(size))
+	o.ins.mutationSize.Record(ctx, int64(size), metric.WithAttributes(o.attrs...))
+}
+
+// recordResponse annotates the operation with the server latency reported by Dgraph.
+func (o *operation) recordResponse(ctx context.Context, resp *api.Response) {
+	if resp == nil || resp.Latency == nil {
+		return
+	}
+	l := resp.Latency
+	o.span.SetAttributes(
+		AttrServerLatency.Int64(int64(l.TotalNs)),
+		AttrParsingNs.Int64(int64(l.ParsingNs)),
+		AttrProcessingNs.Int64(int64(l.ProcessingNs)),
+		AttrEncodingNs.Int64(int64(l.EncodingNs)),
+	)
+	o.ins.serverLatency.Record(ctx, float64(l.TotalNs)/float64(time.Second), metric.WithAttributes(o.attrs...))
+}
+
+// end closes the span, marking it as failed when err is non-nil, and records the
+// operation counter and duration.
+func (o *operation) end(ctx context.Context, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+		o.span.RecordError(err)
+		o.span.SetStatus(codes.Error, err.Error())
+	}
+	o.span.End()
+	attrs := metric.WithAttributes(append(o.attrs, AttrStatus.String(status))...)
+	o.ins.operations.Add(ctx, 1, attrs)
+	o.ins.duration.Record(ctx, time.Since(o.start).Seconds(), attrs)
+}
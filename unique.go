@@ -0,0 +1,393 @@
+package dquely
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A field tagged `unique` is unique on its own. Fields tagged `unique=<name>` with the
+// same name form a composite key: only the combination of their values must be
+// unique. The `fold` and `trim` options normalize a unique value before it is compared,
+// lower-casing and trimming it. The normalized value is written to a shadow predicate
+// next to the original, "<predicate>_norm", which the uniqueness queries match on:
+//
+//	type Member struct {
+//		Uid    string `dquely:"uid"`
+//		Tenant string `dquely:"tenant,unique=tenant_email"`
+//		Email  string `dquely:"email,unique=tenant_email,fold,trim"`
+//	}
+//	// filter: (eq(tenant, "acme") AND eq(email_norm, "alice@example.com"))
+
+// UniqueMode selects how unique fields are enforced.
+type UniqueMode int
+
+const (
+	// UniqueQuery checks unique values with a query and conditional mutations in the
+	// same request. It is the default.
+	UniqueQuery UniqueMode = iota
+	// UniqueServer leaves the check to the @unique directive of Dgraph v24 and later,
+	// which is race-free across concurrent transactions. Mutations are sent without
+	// the uniqueness query and Dgraph rejects duplicate values. Composite keys cannot
+	// be expressed with @unique and are still checked with the query.
+	UniqueServer
+)
+
+// uniqueOptions returns the composite key of a unique field's raw tag, "" when the
+// field is unique on its own, and its normalization options.
+func uniqueOptions(rawTag string) (group string, fold, trim bool) {
+	_, opts, _ := strings.Cut(rawTag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		switch {
+		case strings.HasPrefix(opt, "unique="):
+			group = strings.TrimPrefix(opt, "unique=")
+		case opt == "fold":
+			fold = true
+		case opt == "trim":
+			trim = true
+		}
+	}
+	return group, fold, trim
+}
+
+// normalizedPredicate returns the shadow predicate holding the normalized values of
+// predicate.
+func normalizedPredicate(predicate string) string {
+	base, _, _ := strings.Cut(predicate, "@")
+	return base + "_norm"
+}
+
+// normalizedText returns the text of a unique field value as it is stored, folded
+// and trimmed as requested.
+func normalizedText(fv reflect.Value, isJSON, fold, trim bool) (string, error) {
+	var s string
+	if isJSON {
+		b, err := json.Marshal(fv.Interface())
+		if err != nil {
+			return "", err
+		}
+		s = string(b)
+	} else {
+		if fv.Kind() == reflect.Ptr {
+			fv = fv.Elem()
+		}
+		if t, ok := fv.Interface().(time.Time); ok {
+			s = t.UTC().Format("2006-01-02T15:04:05")
+		} else {
+			s = fmt.Sprintf("%v", fv.Interface())
+		}
+	}
+	if trim {
+		s = strings.TrimSpace(s)
+	}
+	if fold {
+		s = strings.ToLower(s)
+	}
+	return s, nil
+}
+
+// normalizedNquad returns the N-quad writing the shadow predicate of field i of v, as
+// numbered by structFields, on subject, or "" when the field is not a normalized
+// unique field.
+func normalizedNquad(subject string, v reflect.Value, t reflect.Type, i int) (string, error) {
+	field := structFields(t)[i]
+	rawTag := field.Tag.Get("dquely")
+	predicate, isJSON, isUnique := parseTag(rawTag, field.Name)
+	_, fold, trim := uniqueOptions(rawTag)
+	if !isUnique || !fold && !trim {
+		return "", nil
+	}
+	fv, state := fieldValue(fieldByIndex(v, field.Index), rawTag)
+	if state != fieldPresent {
+		return "", nil
+	}
+	text, err := normalizedText(fv, isJSON, fold, trim)
+	if err != nil {
+		return "", fmt.Errorf("dquely: failed to marshal field %s as JSON: %w", field.Name, err)
+	}
+	return fmt.Sprintf("%s <%s> \"%s\" .", subject, normalizedPredicate(predicate), escapeLiteral(text)), nil
+}
+
+// normalizedDelete returns the N-quad deleting the shadow predicate of predicate on
+// subject, or "" when the field with the dquely tag rawTag is not normalized.
+func normalizedDelete(subject, rawTag, predicate string) string {
+	if _, _, isUnique := parseTag(rawTag, ""); !isUnique {
+		return ""
+	}
+	if _, fold, trim := uniqueOptions(rawTag); !fold && !trim {
+		return ""
+	}
+	return fmt.Sprintf("%s <%s> * .", subject, normalizedPredicate(predicate))
+}
+
+// uniqueKey is one uniqueness constraint of a struct value: a single unique field,
+// or the fields of a composite key, which must all match.
+type uniqueKey struct {
+	name      string
+	composite bool // declared with unique=<name>
+	members   []uniqueMember
+}
+
+// uniqueMember is one field of a uniqueKey.
+type uniqueMember struct {
+	field     string // the field's predicate
+	predicate string // the predicate compared: the shadow predicate when normalized
+	text      string // the value compared
+	value     any    // the field value
+}
+
+// filter returns the DQL filter matching the key.
+func (k uniqueKey) filter() string {
+	filters := make([]string, len(k.members))
+	for i, m := range k.members {
+		filters[i] = fmt.Sprintf("eq(%s, \"%s\")", m.predicate, escapeLiteral(m.text))
+	}
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return "(" + strings.Join(filters, " AND ") + ")"
+}
+
+// matches reports whether node, a node of a query result, holds the values of k.
+func (k uniqueKey) matches(node map[string]any) bool {
+	for _, m := range k.members {
+		if fmt.Sprint(node[m.predicate]) != m.text {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueKeys returns the uniqueness constraints of v whose fields are all non-zero,
+// in the order of their first field. Constraints with an unset field do not apply.
+func uniqueKeys(v reflect.Value, t reflect.Type) ([]uniqueKey, error) {
+	var keys []*uniqueKey
+	byName := map[string]*uniqueKey{}
+	incomplete := map[string]bool{}
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
+		if rawTag == "-" {
+			continue
+		}
+		predicate, isJSON, isUnique := parseTag(rawTag, field.Name)
+		if predicate == "uid" || !isUnique {
+			continue
+		}
+		group, fold, trim := uniqueOptions(rawTag)
+		name := group
+		if name == "" {
+			name = predicate
+		}
+		key := byName[name]
+		if key == nil {
+			key = &uniqueKey{name: name, composite: group != ""}
+			byName[name] = key
+			keys = append(keys, key)
+		}
+		fv, state := fieldValue(fieldByIndex(v, field.Index), rawTag)
+		if state != fieldPresent {
+			incomplete[name] = true
+			continue
+		}
+		text, err := normalizedText(fv, isJSON, fold, trim)
+		if err != nil {
+			return nil, fmt.Errorf("dquely: failed to marshal field %s as JSON: %w", field.Name, err)
+		}
+		m := uniqueMember{field: predicate, predicate: predicate, text: text, value: fv.Interface()}
+		if fold || trim {
+			m.predicate = normalizedPredicate(predicate)
+		}
+		key.members = append(key.members, m)
+	}
+	var out []uniqueKey
+	for _, key := range keys {
+		if !incomplete[key.name] {
+			out = append(out, *key)
+		}
+	}
+	return out, nil
+}
+
+// queryKeys returns the keys of keys that mode checks with the uniqueness query.
+func queryKeys(keys []uniqueKey, mode UniqueMode) []uniqueKey {
+	if mode != UniqueServer {
+		return keys
+	}
+	var out []uniqueKey
+	for _, key := range keys {
+		if key.composite {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// hasCompositeKey reports whether a field of t belongs to a composite key.
+func hasCompositeKey(t reflect.Type) bool {
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
+		if _, _, isUnique := parseTag(rawTag, field.Name); !isUnique {
+			continue
+		}
+		if group, _, _ := uniqueOptions(rawTag); group != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueFilter joins the filters of keys with OR.
+func uniqueFilter(keys []uniqueKey) string {
+	filters := make([]string, len(keys))
+	for i, key := range keys {
+		filters[i] = key.filter()
+	}
+	return strings.Join(filters, " OR ")
+}
+
+// uniqueSelection returns the predicates the filters of keys compare, once each.
+func uniqueSelection(keys []uniqueKey) []string {
+	var preds []string
+	for _, key := range keys {
+		for _, m := range key.members {
+			if !slices.Contains(preds, m.predicate) {
+				preds = append(preds, m.predicate)
+			}
+		}
+	}
+	return preds
+}
+
+// duplicatesBlock is the query block listing the nodes that block an insert or update
+// by holding its unique values.
+const duplicatesBlock = "duplicates"
+
+// duplicatesQuery returns the block selecting the uid and the compared predicates of
+// the nodes in the variable name.
+func duplicatesQuery(block, name string, keys []uniqueKey) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("  %s(func: uid(%s)) {\n    uid\n", block, name))
+	for _, p := range uniqueSelection(keys) {
+		sb.WriteString("    " + p + "\n")
+	}
+	sb.WriteString("  }")
+	return sb.String()
+}
+
+// DuplicateError is returned when a mutation is blocked because other nodes already
+// hold its unique values:
+//
+//	var dup *dquely.DuplicateError
+//	if errors.As(err, &dup) {
+//		// dup.Fields["email"] collided with the nodes in dup.ExistingUIDs
+//	}
+type DuplicateError struct {
+	Type         string         // dgraph.type of the model
+	Fields       map[string]any // predicate -> value of the model, for the fields that collided
+	ExistingUIDs []string       // the nodes holding those values; empty under UniqueServer
+}
+
+func (e *DuplicateError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for f := range e.Fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	msg := fmt.Sprintf("mutate failed: duplicated %s %s", e.Type, strings.Join(fields, ", "))
+	if len(e.ExistingUIDs) > 0 {
+		msg += " held by " + strings.Join(e.ExistingUIDs, ", ")
+	}
+	return msg
+}
+
+// Is makes a DuplicateError match the duplicate errors of MutateMany and Upsert.
+func (e *DuplicateError) Is(target error) bool {
+	return target == errDuplicated
+}
+
+// duplicateOf decodes the block of a response and returns the DuplicateError of data
+// when it lists nodes, or nil.
+func duplicateOf(data any, raw []byte, block string) (*DuplicateError, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var result map[string][]map[string]any
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	nodes := result[block]
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	v := reflect.ValueOf(data).Elem()
+	keys, err := uniqueKeys(v, v.Type())
+	if err != nil {
+		return nil, err
+	}
+	dup := &DuplicateError{Type: dgraphTypeOf(data), Fields: map[string]any{}}
+	for _, node := range nodes {
+		if uid, ok := node["uid"].(string); ok {
+			dup.ExistingUIDs = append(dup.ExistingUIDs, uid)
+		}
+		for _, key := range keys {
+			if key.matches(node) {
+				for _, m := range key.members {
+					dup.Fields[m.field] = m.value
+				}
+			}
+		}
+	}
+	if len(dup.Fields) == 0 {
+		// The stored values are formatted differently: report every checked key.
+		for _, key := range keys {
+			for _, m := range key.members {
+				dup.Fields[m.field] = m.value
+			}
+		}
+	}
+	return dup, nil
+}
+
+// serverDuplicate matches the error Dgraph returns when a value of a @unique
+// predicate is already taken.
+var serverDuplicate = regexp.MustCompile(`could not insert duplicate value \[(.*?)\] for predicate \[(.*?)\]`)
+
+// duplicateOfServer returns the DuplicateError of the first of items that holds the
+// value Dgraph rejected in err for a @unique predicate, or nil when err is no such
+// rejection. When no item holds the exact value, the first one writing the predicate
+// is reported.
+func duplicateOfServer(err error, items ...any) *DuplicateError {
+	m := serverDuplicate.FindStringSubmatch(err.Error())
+	if m == nil {
+		return nil
+	}
+	text, predicate := m[1], m[2]
+	var fallback *DuplicateError
+	for _, data := range items {
+		v := reflect.ValueOf(data).Elem()
+		keys, _ := uniqueKeys(v, v.Type())
+		for _, key := range keys {
+			for _, member := range key.members {
+				if member.predicate != predicate {
+					continue
+				}
+				dup := &DuplicateError{Type: dgraphTypeOf(data), Fields: map[string]any{member.field: member.value}}
+				if member.text == text {
+					return dup
+				}
+				if fallback == nil {
+					fallback = dup
+				}
+			}
+		}
+	}
+	if fallback == nil && len(items) > 0 {
+		fallback = &DuplicateError{Type: dgraphTypeOf(items[0]), Fields: map[string]any{predicate: text}}
+	}
+	return fallback
+}
@@ -290,12 +290,12 @@ func TestUpdateRelationship_4(t *testing.T) {
 	}
 	const expectedNquads = `uid(v) <name> "A" .
 uid(v) <owner> <0x2> .
-uid(v) <staffs> _:shortUser0 .
-uid(v) <staffs> _:shortUser1 .
-_:shortUser0 <name> "ShortUser1" .
-_:shortUser0 <link> <0x3> .
-_:shortUser1 <name> "ShortUser2" .
-_:shortUser1 <link> <0x4> .`
+uid(v) <staffs> _:company.staffs0 .
+uid(v) <staffs> _:company.staffs1 .
+_:company.staffs0 <name> "ShortUser1" .
+_:company.staffs0 <link> <0x3> .
+_:company.staffs1 <name> "ShortUser2" .
+_:company.staffs1 <link> <0x4> .`
 	if string(cond.SetNquads) != expectedNquads {
 		t.Errorf("expected ParseUpdate() to get Mutation %s, got %s", expectedNquads,
 			string(cond.SetNquads))
@@ -345,13 +345,13 @@ func TestUpdateRelationship_5(t *testing.T) {
 	const expectedNquads = `uid(v) <updatedAt> "2026-03-07T13:10:31" .
 uid(v) <finishedAt> "2026-03-07T13:10:31" .
 uid(v) <status> "2" .
-uid(v) <taxes> _:taxItem0 .
+uid(v) <taxes> _:order.taxes0 .
 uid(v) <finalAmount> "21000" .
-_:taxItem0 <rootAmount> "10000" .
-_:taxItem0 <taxValue> "10" .
-_:taxItem0 <amount> "5000" .
-_:taxItem0 <name> "Alice" .
-_:taxItem0 <taxOf> <0x2> .`
+_:order.taxes0 <rootAmount> "10000" .
+_:order.taxes0 <taxValue> "10" .
+_:order.taxes0 <amount> "5000" .
+_:order.taxes0 <name> "Alice" .
+_:order.taxes0 <taxOf> <0x2> .`
 	if string(cond.SetNquads) != expectedNquads {
 		t.Errorf("expected ParseUpdate() to get Mutation %s, got %s", expectedNquads,
 			string(cond.SetNquads))
@@ -0,0 +1,211 @@
+package dquely
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v250/protos/api"
+)
+
+// ConflictPolicy decides what Upsert does when a node already holds the unique
+// values of the model.
+type ConflictPolicy int
+
+const (
+	// OnConflictError fails with a duplicate error, as Mutate does.
+	OnConflictError ConflictPolicy = iota
+	// OnConflictIgnore leaves the existing node unchanged and loads its uid into the model.
+	OnConflictIgnore
+	// OnConflictUpdate writes the non-zero, non-unique fields of the model to the
+	// existing node and loads its uid into the model.
+	OnConflictUpdate
+)
+
+func (p ConflictPolicy) String() string {
+	switch p {
+	case OnConflictError:
+		return "OnConflictError"
+	case OnConflictIgnore:
+		return "OnConflictIgnore"
+	case OnConflictUpdate:
+		return "OnConflictUpdate"
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+}
+
+// upsertBlock is the query block that returns the existing node of an upsert.
+const upsertBlock = "existing"
+
+// ParseUpsert generates a single upsert request for input, a pointer to a struct with
+// an empty uid and at least one unique key whose fields are all set. The query binds
+// "v" to the nodes of the same type matching any of the keys and returns their uids
+// and compared values in the "existing" block:
+//
+//	{
+//	  existing(func: type(User)) @filter(eq(email, "alice@example.com")) {
+//	    v as uid
+//	    email
+//	  }
+//	}
+//
+// The first mutation inserts the node under @if(eq(len(v), 0)). With OnConflictUpdate a
+// second mutation writes the non-zero, non-unique fields to uid(v) under
+// @if(eq(len(v), 1)), replacing the values of list fields. Nested structs are not written.
+func ParseUpsert(input any, policy ConflictPolicy) (string, []*api.Mutation, error) {
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return "", nil, fmt.Errorf("dquely: ParseUpsert expects a pointer to struct, got %T", input)
+	}
+	if policy < OnConflictError || policy > OnConflictUpdate {
+		return "", nil, fmt.Errorf("dquely: ParseUpsert: unknown %s", policy)
+	}
+	v = v.Elem()
+	t := v.Type()
+	if !hasUIDField(t) {
+		return "", nil, fmt.Errorf("dquely: ParseUpsert requires a field tagged dquely:\"uid\" in the struct")
+	}
+	if uid := structUID(v, t); uid != "" {
+		return "", nil, fmt.Errorf("dquely: ParseUpsert requires an empty uid field, got %s", uid)
+	}
+	typeName := dgraphTypeOf(input)
+
+	keys, err := uniqueKeys(v, t)
+	if err != nil {
+		return "", nil, err
+	}
+	var updates, replaced []string
+	for _, field := range structFields(t) {
+		rawTag := field.Tag.Get("dquely")
+		if rawTag == "-" {
+			continue
+		}
+		predicate, isJSON, isUnique := parseTag(rawTag, field.Name)
+		ft := field.Type
+		fv, state := fieldValue(fieldByIndex(v, field.Index), rawTag)
+		if predicate == "uid" || isUnique || isEdgeType(ft) || state != fieldPresent {
+			continue
+		}
+		if !isJSON && isScalarList(fv.Type()) {
+			replaced = append(replaced, fmt.Sprintf("uid(v) <%s> * .", predicate))
+		}
+		for _, fv := range listValues(fv, isJSON) {
+			val, err := formatFieldValue(fv, isJSON)
+			if err != nil {
+				return "", nil, fmt.Errorf("dquely: failed to marshal field %s as JSON: %w", field.Name, err)
+			}
+			updates = append(updates, fmt.Sprintf("uid(v) <%s> %s .", predicate, val))
+		}
+	}
+	if len(keys) == 0 {
+		return "", nil, fmt.Errorf("dquely: ParseUpsert requires a complete unique key on %s", typeName)
+	}
+
+	var qb strings.Builder
+	qb.WriteString(fmt.Sprintf("{\n  %s(func: type(%s)) @filter(%s) {\n    v as uid\n",
+		upsertBlock, typeName, uniqueFilter(keys)))
+	for _, p := range uniqueSelection(keys) {
+		qb.WriteString("    " + p + "\n")
+	}
+	qb.WriteString("  }\n}")
+	query := qb.String()
+
+	var sb strings.Builder
+	if err := buildNquads(&sb, v, t, "_:"+strings.ToLower(typeName), typeName, false); err != nil {
+		return "", nil, err
+	}
+	mus := []*api.Mutation{{SetNquads: []byte(sb.String()), Cond: "@if(eq(len(v), 0))"}}
+	if policy == OnConflictUpdate && len(updates) > 0 {
+		mus = append(mus, &api.Mutation{
+			SetNquads: []byte(strings.Join(updates, "\n")),
+			DelNquads: []byte(strings.Join(replaced, "\n")),
+			Cond:      "@if(eq(len(v), 1))",
+		})
+	}
+	return query, mus, nil
+}
+
+// isEdgeType reports whether fields of type t are written as edges to other nodes.
+func isEdgeType(t reflect.Type) bool {
+	return (t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && hasUIDField(t.Elem())) ||
+		(t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct) ||
+		(t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Ptr && t.Elem().Elem().Kind() == reflect.Struct) ||
+		isInterfaceEdge(t)
+}
+
+// Upsert inserts model unless a node of its type already holds one of its unique
+// values, in which case policy decides the outcome:
+//
+//	user := &User{Name: "Alice", Email: "alice@example.com"}
+//	created, err := client.Upsert(ctx, user, dquely.OnConflictUpdate)
+//	// user.Uid is set either way; created reports whether the node is new.
+//
+// The lookup and the write are one atomic request, built by ParseUpsert. When the
+// unique values are spread over several existing nodes, nothing is written and an
+// error is returned.
+func (d *Dgo) Upsert(ctx context.Context, model any, policy ConflictPolicy) (created bool, err error) {
+	ctx, span := d.startOperation(ctx, "Upsert", AttrDgraphType.String(dgraphTypeOf(model)))
+	defer func() { span.end(ctx, err) }()
+	query, mu, err := ParseUpsert(model, policy)
+	if err == nil {
+		mu, err = d.encode(model, mu)
+	}
+	if err != nil {
+		return false, fmt.Errorf("dgo: build mutation: %w", err)
+	}
+	if d.Debug {
+		d.debugMutation(query, mu[0])
+	}
+	span.recordMutations(ctx, mu)
+	req := &api.Request{
+		Query:     query,
+		Mutations: mu,
+		CommitNow: true,
+	}
+	var resp *api.Response
+	err = d.Retry.retryCommit(ctx, "Upsert", func() (err error) {
+		resp, err = d.backend().NewTxn(TxnOptions{}).Do(ctx, req)
+		return err
+	})
+	if err != nil {
+		if dup := duplicateOfServer(err, model); dup != nil {
+			return false, dup
+		}
+		return false, fmt.Errorf("dgo: upsert: %w", err)
+	}
+	span.recordResponse(ctx, resp)
+	if d.Debug {
+		fmt.Printf("resp Uids: %+v\n", resp.Uids)
+	}
+	blankNode, err := BlankNodeName(model)
+	if err != nil {
+		return false, fmt.Errorf("dgo: inject node name: %w", err)
+	}
+	if uid, ok := resp.Uids[blankNode]; ok {
+		return true, SetUID(model, uid)
+	}
+
+	var existing map[string][]struct {
+		Uid string `json:"uid"`
+	}
+	if err := json.Unmarshal(resp.Json, &existing); err != nil {
+		return false, fmt.Errorf("dgo: upsert: decode response: %w", err)
+	}
+	nodes := existing[upsertBlock]
+	switch {
+	case len(nodes) == 0:
+		return false, errors.New("dgo: upsert: the node was neither created nor matched")
+	case len(nodes) > 1:
+		return false, fmt.Errorf("dgo: upsert: %d %s nodes hold the unique values", len(nodes), dgraphTypeOf(model))
+	case policy == OnConflictError:
+		dup, err := duplicateOf(model, resp.Json, upsertBlock)
+		if err != nil {
+			return false, fmt.Errorf("dgo: upsert: %w", err)
+		}
+		return false, dup
+	}
+	return false, SetUID(model, nodes[0].Uid)
+}
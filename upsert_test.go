@@ -0,0 +1,54 @@
+package dquely_test
+
+import (
+	"testing"
+
+	"github.com/vibros68/dquely"
+)
+
+func TestParseUpsert(t *testing.T) {
+	user := &UserWithUnique{UserName: "alice", Email: "alice@example.com", Age: 29}
+	query, mus, err := dquely.ParseUpsert(user, dquely.OnConflictUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != userUpsertQueryMock {
+		t.Errorf("expected query\n%s\ngot\n%s", userUpsertQueryMock, query)
+	}
+	if len(mus) != 2 {
+		t.Fatalf("expected 2 mutations, got %d", len(mus))
+	}
+	if mus[0].Cond != "@if(eq(len(v), 0))" || string(mus[0].SetNquads) != userUpsertCreateMock {
+		t.Errorf("unexpected insert %s\n%s", mus[0].Cond, mus[0].SetNquads)
+	}
+	if mus[1].Cond != "@if(eq(len(v), 1))" || string(mus[1].SetNquads) != userUpsertUpdateMock {
+		t.Errorf("unexpected update %s\n%s", mus[1].Cond, mus[1].SetNquads)
+	}
+
+	for _, policy := range []dquely.ConflictPolicy{dquely.OnConflictError, dquely.OnConflictIgnore} {
+		_, mus, err := dquely.ParseUpsert(user, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mus) != 1 {
+			t.Errorf("%s: expected only the insert, got %d mutations", policy, len(mus))
+		}
+	}
+}
+
+func TestParseUpsertErrors(t *testing.T) {
+	cases := map[string]any{
+		"not a pointer":    UserWithUnique{Email: "a@x"},
+		"uid set":          &UserWithUnique{Uid: "0x1", Email: "a@x"},
+		"no unique values": &UserWithUnique{Age: 3},
+		"no unique fields": &User{Name: "A"},
+	}
+	for name, input := range cases {
+		if _, _, err := dquely.ParseUpsert(input, dquely.OnConflictIgnore); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, _, err := dquely.ParseUpsert(&UserWithUnique{Email: "a@x"}, dquely.ConflictPolicy(7)); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,230 @@
+package dquely
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vibros68/dquely/internal/dql"
+)
+
+// SchemaError is one problem Validate found in a query.
+type SchemaError struct {
+	Path    string // block and field path, e.g. "people.friends.name"
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	return "dquely: " + e.Path + ": " + e.Message
+}
+
+// Validate checks the query against s before it is sent: predicates must exist,
+// functions must have the index Dgraph requires, ordering must use a sortable type,
+// nested selects must follow uid edges and ~pred needs @reverse. All problems are
+// returned, joined; each is a *SchemaError.
+func (d *DQuely) Validate(s *Schema) error {
+	if d.condVar != "" || d.isVar || (d.dgKey == "" && d.name != "") {
+		return ValidateDQL(Build(d), s)
+	}
+	return ValidateDQL(d.Query(), s)
+}
+
+// Validate checks every block of the document against s. See DQuely.Validate.
+func (doc *Document) Validate(s *Schema) error {
+	return ValidateDQL(doc.String(), s)
+}
+
+// ValidateDQL parses query text and checks it against s. See DQuely.Validate.
+func ValidateDQL(query string, s *Schema) error {
+	ast, err := dql.Parse(query)
+	if err != nil {
+		return fmt.Errorf("dquely: %w", err)
+	}
+	v := &validator{s: s}
+	for _, b := range ast.Blocks {
+		v.block(b)
+	}
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	s    *Schema
+	errs []error
+}
+
+func (v *validator) errorf(path, format string, args ...any) {
+	v.errs = append(v.errs, &SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) block(b *dql.Block) {
+	path := b.Name
+	if b.Name == "var" && b.Var != "" {
+		path = b.Var
+	}
+	if b.Func != nil {
+		v.fn(path, b.Func, true)
+	}
+	v.args(path, b.Args)
+	if b.Filter != nil {
+		v.filter(path, b.Filter)
+	}
+	v.fields(path, b.Fields)
+}
+
+func (v *validator) fields(path string, fields []*dql.Field) {
+	for _, f := range fields {
+		fpath := path + "." + f.Key()
+		if f.Func != nil {
+			v.valueFunc(fpath, f.Func)
+			continue
+		}
+		if f.Name == "uid" || f.Name == "dgraph.type" {
+			continue
+		}
+		p := v.pred(fpath, f.Name)
+		if p == nil {
+			continue
+		}
+		if f.HasBody && p.Type != "uid" && !strings.HasPrefix(f.Name, "~") {
+			v.errorf(fpath, "%s is of type %s and cannot have a nested select", p.Name, p.Type)
+			continue
+		}
+		v.args(fpath, f.Args)
+		if f.Filter != nil {
+			v.filter(fpath, f.Filter)
+		}
+		v.fields(fpath, f.Fields)
+	}
+}
+
+// valueFunc checks count(pred), val(x), expand(...) and aggregations in a selection.
+func (v *validator) valueFunc(path string, fn *dql.Func) {
+	if fn.Name != "count" || len(fn.Args) != 1 || fn.Args[0].Kind != dql.Ident || fn.Args[0].Text == "uid" {
+		return
+	}
+	p := v.pred(path, fn.Args[0].Text)
+	if p != nil && fn.Filter != nil {
+		v.filter(path, fn.Filter)
+	}
+}
+
+// pred looks up a predicate, reporting unknown predicates, ~pred without @reverse
+// and language tags without @lang.
+func (v *validator) pred(path, name string) *PredicateSchema {
+	base, lang, _ := strings.Cut(name, "@")
+	reverse := strings.HasPrefix(base, "~")
+	base = strings.TrimPrefix(base, "~")
+	p := v.s.Predicates[base]
+	switch {
+	case p == nil:
+		v.errorf(path, "predicate %s is not in the schema", base)
+	case reverse && !p.Reverse:
+		v.errorf(path, "~%s needs @reverse on %s", base, base)
+	case lang != "" && !p.Lang:
+		v.errorf(path, "%s needs @lang on %s", name, base)
+	default:
+		return p
+	}
+	return nil
+}
+
+func (v *validator) args(path string, args []dql.Arg) {
+	for _, a := range args {
+		if (a.Name != "orderasc" && a.Name != "orderdesc") || a.Value.Kind != dql.Ident {
+			continue
+		}
+		p := v.pred(path, a.Value.Text)
+		if p == nil {
+			continue
+		}
+		switch p.Type {
+		case "uid", "bool", "geo", "password":
+			v.errorf(path, "cannot %s by %s of type %s", a.Name, p.Name, p.Type)
+		}
+	}
+}
+
+func (v *validator) filter(path string, f *dql.Filter) {
+	if f.Op == dql.FilterFunc {
+		v.fn(path, f.Func, false)
+		return
+	}
+	for _, a := range f.Args {
+		v.filter(path, a)
+	}
+}
+
+// fnIndexes lists the tokenizers each function needs, wherever it is used.
+var fnIndexes = map[string][]string{
+	"allofterms": {"term"},
+	"anyofterms": {"term"},
+	"alloftext":  {"fulltext"},
+	"anyoftext":  {"fulltext"},
+	"regexp":     {"trigram"},
+	"match":      {"trigram"},
+	"ngram":      {"ngram"},
+}
+
+// fn checks a root function (root set) or a filter function.
+func (v *validator) fn(path string, fn *dql.Func, root bool) {
+	if len(fn.Args) == 0 {
+		return
+	}
+	first := fn.Args[0]
+	switch fn.Name {
+	case "uid":
+		return
+	case "type":
+		if len(v.s.Types) > 0 && first.Kind == dql.Ident && v.s.Types[first.Text] == nil {
+			v.errorf(path, "type %s is not in the schema", first.Text)
+		}
+		return
+	}
+	if first.Kind == dql.FuncCall {
+		// eq(count(pred), n) needs @count at the root; val(x) needs nothing.
+		inner := first.Func
+		if inner.Name == "count" && len(inner.Args) == 1 && inner.Args[0].Kind == dql.Ident {
+			if p := v.pred(path, inner.Args[0].Text); p != nil && root && !p.Count {
+				v.errorf(path, "%s at the root needs @count on %s", fn.Name, p.Name)
+			}
+		}
+		return
+	}
+	if first.Kind != dql.Ident {
+		return
+	}
+	p := v.pred(path, first.Text)
+	if p == nil {
+		return
+	}
+	if want, ok := fnIndexes[fn.Name]; ok {
+		if !p.Indexed(want...) {
+			v.errorf(path, "%s needs @index(%s) on %s", fn.Name, want[0], p.Name)
+		}
+		return
+	}
+	switch fn.Name {
+	case "uid_in":
+		if p.Type != "uid" {
+			v.errorf(path, "uid_in needs a uid predicate, %s is of type %s", p.Name, p.Type)
+		}
+	case "eq", "lt", "le", "gt", "ge", "between":
+		if !root || p.Type == "uid" {
+			return
+		}
+		want := []string{"exact"}
+		if p.Type == "string" && fn.Name == "eq" {
+			want = []string{"exact", "hash", "term", "fulltext"}
+		}
+		if p.Type != "string" && p.Type != "default" {
+			want = nil // any index of the type's own tokenizer
+		}
+		if !p.Indexed(want...) {
+			if want == nil {
+				v.errorf(path, "%s at the root needs an index on %s", fn.Name, p.Name)
+			} else {
+				v.errorf(path, "%s at the root needs @index(%s) on %s", fn.Name, strings.Join(want, "|"), p.Name)
+			}
+		}
+	}
+}